@@ -1,12 +1,23 @@
 package main
 
 import (
+	"context"
 	"log"
 	"os"
 
+	"github.com/Enuma3lish/LUNG_CEX/backend/internal/anchor"
+	"github.com/Enuma3lish/LUNG_CEX/backend/internal/candles"
+	"github.com/Enuma3lish/LUNG_CEX/backend/internal/conditional"
 	"github.com/Enuma3lish/LUNG_CEX/backend/internal/database"
+	"github.com/Enuma3lish/LUNG_CEX/backend/internal/deadman"
+	"github.com/Enuma3lish/LUNG_CEX/backend/internal/exchange"
+	"github.com/Enuma3lish/LUNG_CEX/backend/internal/futures"
 	"github.com/Enuma3lish/LUNG_CEX/backend/internal/handlers"
+	"github.com/Enuma3lish/LUNG_CEX/backend/internal/ledger"
 	"github.com/Enuma3lish/LUNG_CEX/backend/internal/middleware"
+	"github.com/Enuma3lish/LUNG_CEX/backend/internal/stream"
+	"github.com/Enuma3lish/LUNG_CEX/backend/pkg/blockchain"
+	"github.com/Enuma3lish/LUNG_CEX/backend/pkg/pricefeed"
 	"github.com/Enuma3lish/LUNG_CEX/backend/pkg/redis"
 	"github.com/gin-contrib/cors"
 	"github.com/gin-gonic/gin"
@@ -30,45 +41,163 @@ func main() {
 		log.Fatal("Failed to run migrations:", err)
 	}
 
+	// Give accounts that predate the ledger their opening entries
+	if err := ledger.OpenAccounts(db); err != nil {
+		log.Fatal("Failed to open ledger accounts:", err)
+	}
+
 	// Initialize Redis
 	redisClient := redis.InitRedis()
 
+	// Initialize price feed selected by PRICE_FEED
+	priceFeed, err := pricefeed.FromEnv(redisClient)
+	if err != nil {
+		log.Fatal("Failed to initialize price feed:", err)
+	}
+	if runner, ok := priceFeed.(pricefeed.Runner); ok {
+		go runner.Run(context.Background())
+	}
+
+	// Initialize matching engine and reload resting orders
+	engine := exchange.NewEngine(db, priceFeed)
+	if err := engine.Restore(); err != nil {
+		log.Fatal("Failed to restore order books:", err)
+	}
+
+	// Expire good-till-date orders once their expiry passes
+	go exchange.NewSweeper(engine).Run(context.Background())
+
+	// Build OHLCV candles from feed prices and executed trades
+	aggregator := candles.NewAggregator(db, priceFeed)
+	engine.OnTrade(aggregator.OnTrade)
+	go aggregator.Run(context.Background())
+
+	// Stream market data and private updates over WebSocket
+	hub := stream.NewHub()
+	publisher := stream.NewPublisher(db, hub, engine, aggregator, priceFeed)
+	engine.OnTrade(publisher.OnTrade)
+	go publisher.Run(context.Background())
+
+	// Start liquidation engine for leveraged futures positions
+	liquidator := futures.NewLiquidator(db, priceFeed)
+	liquidator.OnLiquidate(publisher.PositionChanged)
+	go liquidator.Run(context.Background())
+
+	// Start funding engine for perpetual futures
+	funder := futures.NewFunder(db, priceFeed, liquidator)
+	funder.OnFunding(publisher.PositionChanged)
+	go funder.Run(context.Background())
+
+	// Trigger stop, take-profit and trailing orders as prices move
+	evaluator := conditional.NewEvaluator(db, engine, priceFeed)
+	evaluator.OnClose(publisher.PositionChanged)
+	go evaluator.Run(context.Background())
+
+	// Cancel orders of API traders whose cancel-after timer runs out or
+	// whose cancel-on-disconnect session drops
+	deadmanSwitch := deadman.NewSwitch(db, engine)
+	hub.OnDisconnect(deadmanSwitch.Trip)
+	go deadmanSwitch.Run(context.Background())
+
+	// Record trades on Solana from the outbox and follow their signatures
+	// until they finalize; without a client they stay pending until one is
+	// configured
+	solanaClient, err := blockchain.NewSolanaClient()
+	if err != nil {
+		log.Printf("Warning: Failed to initialize Solana client, trades will not be anchored: %v", err)
+	} else {
+		anchorWorker := anchor.NewWorker(db, solanaClient)
+		go anchorWorker.Run(context.Background())
+		go anchorWorker.Track(context.Background())
+	}
+
+	// Periodically prove balances reconcile with the ledger
+	go ledger.NewChecker(db).Run(context.Background())
+
 	// Initialize Gin router
 	r := gin.Default()
 
 	// CORS configuration
 	r.Use(cors.New(cors.Config{
 		AllowOrigins:     []string{"http://localhost:3000"},
-		AllowMethods:     []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
-		AllowHeaders:     []string{"Origin", "Content-Type", "Authorization"},
-		ExposeHeaders:    []string{"Content-Length"},
+		AllowMethods:     []string{"GET", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"},
+		AllowHeaders:     []string{"Origin", "Content-Type", "Authorization", middleware.IdempotencyHeader},
+		ExposeHeaders:    []string{"Content-Length", "Idempotent-Replayed"},
 		AllowCredentials: true,
 	}))
 
 	// Initialize handlers
 	authHandler := handlers.NewAuthHandler(db)
-	tradeHandler := handlers.NewTradeHandler(db, redisClient)
-	portfolioHandler := handlers.NewPortfolioHandler(db, redisClient)
+	tradeHandler := handlers.NewTradeHandler(db, redisClient, engine)
+	orderHandler := handlers.NewOrderHandler(db, redisClient, engine, deadmanSwitch)
+	portfolioHandler := handlers.NewPortfolioHandler(db, redisClient, priceFeed)
+	futuresHandler := handlers.NewFuturesHandler(db, redisClient, priceFeed, publisher)
+	marketHandler := handlers.NewMarketHandler(db, redisClient, priceFeed)
+	ledgerHandler := handlers.NewLedgerHandler(db)
+	accountHandler := handlers.NewAccountHandler(db, priceFeed)
+	conditionalHandler := handlers.NewConditionalHandler(db, priceFeed)
 
 	// Public routes
 	public := r.Group("/api")
 	{
 		public.POST("/register", authHandler.Register)
 		public.POST("/login", authHandler.Login)
+
+		// Market data endpoints
+		public.GET("/market/assets", marketHandler.GetAssets)
+		public.GET("/market/markets", marketHandler.GetMarkets)
+		public.GET("/market/tickers", marketHandler.GetTickers)
+		public.GET("/market/ticker/:symbol", marketHandler.GetTicker)
+		public.GET("/market/candles", marketHandler.GetCandles)
+
+		// Anchoring proofs hold only what is already public on chain
+		public.GET("/trades/:id/proof", tradeHandler.GetTradeProof)
 	}
 
+	// WebSocket streaming; authentication is optional and only needed for
+	// the private user channel
+	r.GET("/ws", hub.ServeWS)
+
 	// Protected routes
 	protected := r.Group("/api")
-	protected.Use(middleware.AuthMiddleware())
+	protected.Use(middleware.AuthMiddleware(), middleware.Idempotency(db))
 	{
 		// Trading endpoints
 		protected.POST("/trade/buy", tradeHandler.BuyAsset)
 		protected.POST("/trade/sell", tradeHandler.SellAsset)
 		protected.GET("/trades/history", tradeHandler.GetTradeHistory)
+		protected.GET("/trades/:id/anchor", tradeHandler.GetTradeAnchor)
+
+		// Order management endpoints
+		protected.GET("/orders/open", orderHandler.GetOpenOrders)
+		protected.POST("/orders/cancel-after", orderHandler.CancelAfter)
+		protected.PATCH("/orders/:id", orderHandler.AmendOrder)
+		protected.DELETE("/orders/:id", orderHandler.CancelOrder)
+		protected.DELETE("/orders", orderHandler.CancelAll)
+
+		// Conditional order endpoints
+		protected.POST("/orders/conditional", conditionalHandler.CreateOrder)
+		protected.GET("/orders/conditional", conditionalHandler.GetOrders)
+		protected.DELETE("/orders/conditional/:id", conditionalHandler.CancelOrder)
+
+		// Futures endpoints
+		protected.POST("/futures/open", futuresHandler.OpenPosition)
+		protected.POST("/futures/close", futuresHandler.ClosePosition)
+		protected.GET("/futures/positions", futuresHandler.GetPositions)
+		protected.GET("/futures/history", futuresHandler.GetHistory)
+		protected.GET("/futures/liquidations", futuresHandler.GetLiquidations)
+		protected.GET("/futures/funding", futuresHandler.GetFunding)
 
 		// Portfolio endpoints
 		protected.GET("/portfolio", portfolioHandler.GetPortfolio)
 		protected.GET("/portfolio/holdings", portfolioHandler.GetHoldings)
+		protected.GET("/wallets", portfolioHandler.GetWallets)
+
+		// Ledger endpoints
+		protected.GET("/ledger", ledgerHandler.GetLedger)
+
+		// Account endpoints
+		protected.GET("/account/fees", accountHandler.GetFees)
 
 		// User endpoints
 		protected.GET("/user/profile", authHandler.GetProfile)
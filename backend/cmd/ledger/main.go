@@ -0,0 +1,86 @@
+// Command ledger checks the ledger's invariants and makes manual balance
+// adjustments.
+//
+//	go run ./cmd/ledger check
+//	go run ./cmd/ledger adjust -user <id> -asset USD -amount 250 -reason "Support refund"
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/Enuma3lish/LUNG_CEX/backend/internal/database"
+	"github.com/Enuma3lish/LUNG_CEX/backend/internal/ledger"
+	"github.com/Enuma3lish/LUNG_CEX/backend/internal/wallet"
+	"github.com/google/uuid"
+	"github.com/joho/godotenv"
+	"github.com/shopspring/decimal"
+)
+
+func main() {
+	if err := godotenv.Load(); err != nil {
+		log.Println("No .env file found, using environment variables")
+	}
+	if len(os.Args) < 2 {
+		usage()
+	}
+
+	db, err := database.InitDB()
+	if err != nil {
+		log.Fatal("Failed to connect to database:", err)
+	}
+
+	switch os.Args[1] {
+	case "check":
+		report, err := ledger.Check(db)
+		if err != nil {
+			log.Fatal(err)
+		}
+		for _, id := range report.UnbalancedEntries {
+			fmt.Printf("unbalanced entry %s\n", id)
+		}
+		for _, m := range report.Mismatches {
+			fmt.Printf("mismatch user %s %s: balance %s, postings %s\n", m.UserID, m.Asset, m.Balance, m.Ledger)
+		}
+		if !report.OK() {
+			os.Exit(1)
+		}
+		fmt.Printf("ok: %d users reconcile with the ledger\n", report.Users)
+
+	case "adjust":
+		fs := flag.NewFlagSet("adjust", flag.ExitOnError)
+		user := fs.String("user", "", "user ID")
+		asset := fs.String("asset", wallet.CashSymbol, "asset to adjust")
+		amount := fs.String("amount", "", "signed amount to credit")
+		reason := fs.String("reason", "", "why the balance is adjusted")
+		fs.Parse(os.Args[2:])
+
+		userID, err := uuid.Parse(*user)
+		if err != nil {
+			log.Fatal("Invalid user ID:", err)
+		}
+		value, err := decimal.NewFromString(*amount)
+		if err != nil || value.IsZero() {
+			log.Fatal("Amount must be a non-zero decimal")
+		}
+		if *reason == "" {
+			log.Fatal("A reason is required")
+		}
+
+		entry, err := ledger.Adjust(db, userID, *asset, value, *reason)
+		if err != nil {
+			log.Fatal("Adjustment failed:", err)
+		}
+		fmt.Printf("posted adjustment %s\n", entry.ID)
+
+	default:
+		usage()
+	}
+}
+
+func usage() {
+	fmt.Fprintln(os.Stderr, "usage: ledger check | ledger adjust -user <id> [-asset USD] -amount <amount> -reason <text>")
+	os.Exit(2)
+}
@@ -0,0 +1,35 @@
+// Command solanastub is a local stand-in for a Solana RPC node. It accepts
+// the transactions the trade recorder sends, checks every instruction's
+// bytes against what the TradeRecord and Memo programs expect, and rejects
+// anything malformed.
+//
+// Point SOLANA_RPC_URL at it to run the API without devnet:
+//
+//	go run ./cmd/solanastub -listen :8899 -program <program id>
+package main
+
+import (
+	"flag"
+	"log"
+	"net/http"
+
+	"github.com/Enuma3lish/LUNG_CEX/backend/internal/solanatest"
+	"github.com/gagliardetto/solana-go"
+)
+
+func main() {
+	listen := flag.String("listen", ":8899", "address to serve RPC on")
+	program := flag.String("program", "", "TradeRecord program id to accept")
+	flag.Parse()
+
+	var programID solana.PublicKey
+	if *program != "" {
+		id, err := solana.PublicKeyFromBase58(*program)
+		if err != nil {
+			log.Fatal("Invalid program id:", err)
+		}
+		programID = id
+	}
+	log.Printf("Solana RPC stub listening on %s", *listen)
+	log.Fatal(http.ListenAndServe(*listen, solanatest.NewNode(solanatest.Validate(programID))))
+}
@@ -0,0 +1,71 @@
+package anchor
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/Enuma3lish/LUNG_CEX/backend/internal/models"
+	"github.com/Enuma3lish/LUNG_CEX/backend/pkg/merkle"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// Anchoring statuses, shared by a trade and its outbox entry
+const (
+	StatusPending   = "PENDING"   // waiting to be sent
+	StatusSent      = "SENT"      // submitted, not yet known to be confirmed
+	StatusConfirmed = "CONFIRMED" // confirmed on chain
+	StatusFinalized = "FINALIZED" // finalized on chain, can no longer be rolled back
+	StatusExpired   = "EXPIRED"   // dropped before it landed, waiting to be sent again
+	StatusFailed    = "FAILED"    // gave up after too many attempts
+)
+
+// canonicalVersion starts every canonical trade, so the format can change
+// without old proofs becoming ambiguous
+const canonicalVersion = "LUNG-CEX-TRADE-V1"
+
+// Enqueue queues a trade to be recorded on chain. Call it in the
+// transaction that creates the trade, so neither is committed without the
+// other.
+func Enqueue(tx *gorm.DB, tradeID uuid.UUID) error {
+	entry := models.TradeOutbox{
+		TradeID:       tradeID,
+		Status:        StatusPending,
+		NextAttemptAt: time.Now(),
+	}
+	if err := tx.Create(&entry).Error; err != nil {
+		return fmt.Errorf("failed to queue trade for anchoring: %w", err)
+	}
+	return nil
+}
+
+// Canonical is the text a trade's leaf hash is computed over: a version
+// line, then the trade's fields one per line. Decimals are written without
+// trailing zeros and the time in RFC 3339 UTC. It leaves out who traded,
+// since proofs are public: the trade id ties it to its owner's history.
+func Canonical(trade models.Trade) string {
+	return strings.Join([]string{
+		canonicalVersion,
+		trade.ID.String(),
+		trade.MarketID.String(),
+		trade.TradeType,
+		trade.Liquidity,
+		trade.Quantity.String(),
+		trade.Price.String(),
+		trade.TotalAmount.String(),
+		trade.Fee.String(),
+		trade.FeeAssetID.String(),
+		trade.CreatedAt.UTC().Format(time.RFC3339Nano),
+	}, "\n")
+}
+
+// TradeHash is a trade's leaf in its batch's Merkle tree
+func TradeHash(trade models.Trade) merkle.Hash {
+	return merkle.Leaf([]byte(Canonical(trade)))
+}
+
+// RootMemo is the memo a batch's root is anchored with
+func RootMemo(batch models.AnchorBatch) string {
+	return fmt.Sprintf("ANCHOR:%s:%s:%d", batch.ID, batch.MerkleRoot, batch.TradeCount)
+}
@@ -0,0 +1,220 @@
+package anchor
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/Enuma3lish/LUNG_CEX/backend/internal/models"
+	"github.com/Enuma3lish/LUNG_CEX/backend/pkg/merkle"
+	"gorm.io/gorm"
+)
+
+// maxBatchSize caps the trades in one tree, so a backlog is anchored in
+// several batches
+const maxBatchSize = 1024
+
+// cutBatches groups queued trades into Merkle batches once the oldest has
+// waited a full window, returning how many batches it created
+func (w *Worker) cutBatches() (int, error) {
+	cut := 0
+	for {
+		var entries []models.TradeOutbox
+		if err := w.db.Preload("Trade").
+			Where("status IN ? AND batch_id IS NULL", sendable).
+			Order("created_at ASC, id ASC").
+			Limit(maxBatchSize).
+			Find(&entries).Error; err != nil {
+			return cut, fmt.Errorf("failed to fetch outbox: %w", err)
+		}
+		if len(entries) == 0 || time.Since(entries[0].CreatedAt) < w.window {
+			return cut, nil
+		}
+
+		ok, err := w.cutBatch(entries)
+		if err != nil || !ok {
+			return cut, err
+		}
+		cut++
+	}
+}
+
+// cutBatch builds the tree over entries and assigns each its proof. It
+// reports false without error if another worker batched one of them first.
+func (w *Worker) cutBatch(entries []models.TradeOutbox) (bool, error) {
+	leaves := make([]merkle.Hash, len(entries))
+	for i, entry := range entries {
+		leaves[i] = TradeHash(entry.Trade)
+	}
+	root, proofs := merkle.Build(leaves)
+
+	batch := models.AnchorBatch{
+		MerkleRoot:    root.String(),
+		TradeCount:    len(entries),
+		Status:        StatusPending,
+		NextAttemptAt: time.Now(),
+	}
+
+	tx := w.db.Begin()
+	if err := tx.Create(&batch).Error; err != nil {
+		tx.Rollback()
+		return false, fmt.Errorf("failed to create batch: %w", err)
+	}
+	for i, entry := range entries {
+		proof, err := json.Marshal(proofs[i])
+		if err != nil {
+			tx.Rollback()
+			return false, fmt.Errorf("failed to encode proof: %w", err)
+		}
+		result := tx.Model(&models.TradeOutbox{}).
+			Where("id = ? AND batch_id IS NULL", entry.ID).
+			Updates(map[string]interface{}{
+				"batch_id":   batch.ID,
+				"leaf_index": i,
+				"leaf_hash":  leaves[i].String(),
+				"proof":      string(proof),
+			})
+		if result.Error != nil {
+			tx.Rollback()
+			return false, fmt.Errorf("failed to assign outbox entry: %w", result.Error)
+		}
+		if result.RowsAffected == 0 {
+			tx.Rollback()
+			return false, nil
+		}
+	}
+	if err := tx.Commit().Error; err != nil {
+		return false, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	log.Printf("Batched %d trades for anchoring, root %s", batch.TradeCount, batch.MerkleRoot)
+	return true, nil
+}
+
+// sendBatches anchors the root of every batch that is due, returning how
+// many were sent
+func (w *Worker) sendBatches() (int, error) {
+	var batches []models.AnchorBatch
+	if err := w.db.Where("status IN ? AND next_attempt_at <= ?", sendable, time.Now()).
+		Order("next_attempt_at ASC").
+		Limit(batchSize).
+		Find(&batches).Error; err != nil {
+		return 0, fmt.Errorf("failed to fetch batches: %w", err)
+	}
+
+	sent := 0
+	for _, batch := range batches {
+		// Claim the batch as it was read, so another worker doesn't send
+		// it too
+		result := w.db.Model(&models.AnchorBatch{}).
+			Where("id = ? AND status = ? AND next_attempt_at = ?", batch.ID, batch.Status, batch.NextAttemptAt).
+			Update("next_attempt_at", time.Now().Add(claimLease))
+		if result.Error != nil {
+			return sent, fmt.Errorf("failed to claim batch: %w", result.Error)
+		}
+		if result.RowsAffected == 0 {
+			continue
+		}
+
+		sig, err := w.client.RecordMemo(RootMemo(batch))
+		if err != nil {
+			if err := w.retryBatch(batch, err); err != nil {
+				return sent, err
+			}
+			continue
+		}
+		if err := w.batchSent(batch, sig); err != nil {
+			return sent, err
+		}
+		sent++
+	}
+	return sent, nil
+}
+
+// batchSent records a batch's anchoring signature on the batch and every
+// trade in it
+func (w *Worker) batchSent(batch models.AnchorBatch, sig string) error {
+	now := time.Now()
+	return w.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&batch).Updates(map[string]interface{}{
+			"status":     StatusSent,
+			"attempts":   batch.Attempts + 1,
+			"signature":  sig,
+			"sent_at":    now,
+			"last_error": "",
+		}).Error; err != nil {
+			return fmt.Errorf("failed to update batch: %w", err)
+		}
+		return markBatch(tx, batch, map[string]interface{}{
+			"status":     StatusSent,
+			"attempts":   batch.Attempts + 1,
+			"signature":  sig,
+			"sent_at":    now,
+			"last_error": "",
+		}, map[string]interface{}{
+			"solana_signature": sig,
+			"anchor_status":    StatusSent,
+		})
+	})
+}
+
+// retryBatch schedules a batch's next attempt after a failed send, or
+// gives up on it and its trades once it has used all its attempts
+func (w *Worker) retryBatch(batch models.AnchorBatch, sendErr error) error {
+	attempts := batch.Attempts + 1
+	if attempts < w.maxAttempts {
+		return w.db.Transaction(func(tx *gorm.DB) error {
+			if err := tx.Model(&batch).Updates(map[string]interface{}{
+				"status":          StatusPending,
+				"attempts":        attempts,
+				"next_attempt_at": time.Now().Add(backoff(attempts)),
+				"last_error":      sendErr.Error(),
+			}).Error; err != nil {
+				return fmt.Errorf("failed to update batch: %w", err)
+			}
+			return markBatch(tx, batch, map[string]interface{}{
+				"status":     StatusPending,
+				"attempts":   attempts,
+				"last_error": sendErr.Error(),
+			}, map[string]interface{}{
+				"anchor_status": StatusPending,
+			})
+		})
+	}
+
+	log.Printf("Warning: Giving up anchoring batch %s after %d attempts: %v", batch.ID, attempts, sendErr)
+	return w.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&batch).Updates(map[string]interface{}{
+			"status":     StatusFailed,
+			"attempts":   attempts,
+			"last_error": sendErr.Error(),
+		}).Error; err != nil {
+			return fmt.Errorf("failed to update batch: %w", err)
+		}
+		return markBatch(tx, batch, map[string]interface{}{
+			"status":     StatusFailed,
+			"attempts":   attempts,
+			"last_error": sendErr.Error(),
+		}, map[string]interface{}{
+			"anchor_status": StatusFailed,
+		})
+	})
+}
+
+// markBatch applies updates to the outbox entries of a batch and, unless
+// tradeUpdates is nil, to their trades
+func markBatch(tx *gorm.DB, batch models.AnchorBatch, entryUpdates map[string]interface{}, tradeUpdates map[string]interface{}) error {
+	if err := tx.Model(&models.TradeOutbox{}).Where("batch_id = ?", batch.ID).Updates(entryUpdates).Error; err != nil {
+		return fmt.Errorf("failed to update outbox entries: %w", err)
+	}
+	if tradeUpdates == nil {
+		return nil
+	}
+	if err := tx.Model(&models.Trade{}).
+		Where("id IN (?)", tx.Model(&models.TradeOutbox{}).Select("trade_id").Where("batch_id = ?", batch.ID)).
+		Updates(tradeUpdates).Error; err != nil {
+		return fmt.Errorf("failed to update trades: %w", err)
+	}
+	return nil
+}
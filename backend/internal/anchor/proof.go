@@ -0,0 +1,79 @@
+package anchor
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/Enuma3lish/LUNG_CEX/backend/internal/models"
+	"github.com/Enuma3lish/LUNG_CEX/backend/pkg/merkle"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+var (
+	ErrTradeNotFound = errors.New("trade not found")
+	ErrNotBatched    = errors.New("trade is not in an anchoring batch yet")
+)
+
+// TradeProof is everything needed to check that a trade was committed to a
+// root anchored on Solana: hash Canonical, the trade's canonical form,
+// into the leaf, follow Proof to the root, and find Memo in the
+// transaction with Signature. It is served to anyone with the trade id,
+// which a trader shares to have the trade checked.
+type TradeProof struct {
+	TradeID    uuid.UUID     `json:"trade_id"`
+	Canonical  string        `json:"canonical"` // the leaf's preimage, see Canonical
+	LeafHash   string        `json:"leaf_hash"`
+	LeafIndex  int           `json:"leaf_index"`
+	Proof      []merkle.Step `json:"proof"`
+	BatchID    uuid.UUID     `json:"batch_id"`
+	MerkleRoot string        `json:"merkle_root"`
+	TradeCount int           `json:"trade_count"`
+	Memo       string        `json:"memo"`
+	Status     string        `json:"status"`
+	Signature  string        `json:"signature,omitempty"`
+	Verified   bool          `json:"verified"` // the trade as stored now still hashes to the root
+}
+
+// LoadProof returns the inclusion proof of a trade
+func LoadProof(db *gorm.DB, tradeID uuid.UUID) (TradeProof, error) {
+	var trade models.Trade
+	if err := db.Where("id = ?", tradeID).First(&trade).Error; err != nil {
+		return TradeProof{}, ErrTradeNotFound
+	}
+
+	var entry models.TradeOutbox
+	if err := db.Where("trade_id = ?", trade.ID).First(&entry).Error; err != nil || entry.BatchID == nil {
+		return TradeProof{}, ErrNotBatched
+	}
+	var batch models.AnchorBatch
+	if err := db.First(&batch, "id = ?", *entry.BatchID).Error; err != nil {
+		return TradeProof{}, fmt.Errorf("failed to load batch: %w", err)
+	}
+
+	var steps []merkle.Step
+	if err := json.Unmarshal([]byte(entry.Proof), &steps); err != nil {
+		return TradeProof{}, fmt.Errorf("failed to decode proof: %w", err)
+	}
+	root, err := merkle.ParseHash(batch.MerkleRoot)
+	if err != nil {
+		return TradeProof{}, fmt.Errorf("failed to decode root: %w", err)
+	}
+	leaf := TradeHash(trade)
+
+	return TradeProof{
+		TradeID:    trade.ID,
+		Canonical:  Canonical(trade),
+		LeafHash:   entry.LeafHash,
+		LeafIndex:  entry.LeafIndex,
+		Proof:      steps,
+		BatchID:    batch.ID,
+		MerkleRoot: batch.MerkleRoot,
+		TradeCount: batch.TradeCount,
+		Memo:       RootMemo(batch),
+		Status:     batch.Status,
+		Signature:  batch.Signature,
+		Verified:   leaf.String() == entry.LeafHash && merkle.Verify(leaf, steps, root),
+	}, nil
+}
@@ -0,0 +1,87 @@
+package anchor
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Enuma3lish/LUNG_CEX/backend/internal/models"
+	"github.com/Enuma3lish/LUNG_CEX/backend/internal/testdb"
+	"github.com/Enuma3lish/LUNG_CEX/backend/pkg/merkle"
+	"github.com/shopspring/decimal"
+)
+
+// A third party given only the proof can rebuild the leaf from its
+// canonical form and follow the path to the anchored root
+func TestProofRebuildsLeaf(t *testing.T) {
+	db := testdb.Open(t)
+	userID := testdb.User(t, db)
+
+	var market models.Market
+	if err := db.Where("symbol = ?", "BTC-USD").First(&market).Error; err != nil {
+		t.Fatalf("market not found: %v", err)
+	}
+
+	var entries []models.TradeOutbox
+	for i := 0; i < 3; i++ {
+		trade := models.Trade{
+			UserID:       userID,
+			MarketID:     market.ID,
+			AssetID:      market.BaseAssetID,
+			QuoteAssetID: market.QuoteAssetID,
+			TradeType:    "BUY",
+			Liquidity:    "TAKER",
+			Quantity:     decimal.RequireFromString("0.5"),
+			Price:        decimal.NewFromInt(int64(45000 + i)),
+			TotalAmount:  decimal.NewFromInt(int64(45000 + i)).Div(decimal.NewFromInt(2)),
+			Fee:          decimal.RequireFromString("0.0005"),
+			FeeAssetID:   market.BaseAssetID,
+			CreatedAt:    time.Date(2024, 1, 15, 10, 30, i, 123456000, time.UTC),
+		}
+		if err := db.Create(&trade).Error; err != nil {
+			t.Fatalf("failed to create trade: %v", err)
+		}
+		if err := Enqueue(db, trade.ID); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := db.Preload("Trade").Order("created_at ASC").Find(&entries).Error; err != nil {
+		t.Fatal(err)
+	}
+	if ok, err := (&Worker{db: db}).cutBatch(entries); err != nil || !ok {
+		t.Fatalf("failed to batch trades: %v", err)
+	}
+
+	for _, entry := range entries {
+		proof, err := LoadProof(db, entry.TradeID)
+		if err != nil {
+			t.Fatalf("failed to load proof: %v", err)
+		}
+		if !proof.Verified {
+			t.Errorf("proof of %s is not verified", entry.TradeID)
+		}
+
+		fields := strings.Split(proof.Canonical, "\n")
+		if len(fields) != 11 || fields[0] != canonicalVersion || fields[1] != entry.TradeID.String() || fields[2] != market.ID.String() {
+			t.Fatalf("canonical form %q doesn't describe trade %s", proof.Canonical, entry.TradeID)
+		}
+		if strings.Contains(proof.Canonical, userID.String()) {
+			t.Errorf("canonical form %q names the trader", proof.Canonical)
+		}
+
+		// SHA-256(0x00 || canonical), as API.md tells a checker to compute it
+		sum := sha256.Sum256(append([]byte{0x00}, proof.Canonical...))
+		if leaf := hex.EncodeToString(sum[:]); leaf != proof.LeafHash {
+			t.Errorf("leaf rebuilt from the canonical form is %s, proof has %s", leaf, proof.LeafHash)
+		}
+		root, err := merkle.ParseHash(proof.MerkleRoot)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !merkle.Verify(sum, proof.Proof, root) {
+			t.Errorf("rebuilt leaf of %s doesn't lead to the root", entry.TradeID)
+		}
+	}
+}
@@ -0,0 +1,195 @@
+package anchor
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/Enuma3lish/LUNG_CEX/backend/internal/models"
+	"github.com/Enuma3lish/LUNG_CEX/backend/pkg/blockchain"
+	"gorm.io/gorm"
+)
+
+// unsettled are the statuses of signatures that may still change on chain
+var unsettled = []string{StatusSent, StatusConfirmed}
+
+// Track checks sent signatures on every tick until ctx is cancelled
+func (w *Worker) Track(ctx context.Context) {
+	ticker := time.NewTicker(w.confirmInterval)
+	defer ticker.Stop()
+
+	log.Printf("Anchoring confirmation tracker started (interval %s, expiry %s)", w.confirmInterval, w.expiry)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if _, err := w.TrackOnce(); err != nil {
+				log.Printf("Warning: Anchoring confirmation run failed: %v", err)
+			}
+		}
+	}
+}
+
+// TrackOnce looks up every signature that is not yet final, marking it
+// confirmed, finalized or expired as the cluster reports, and returns how
+// many changed status. Expired and failed sends are queued to be sent again.
+// A signature that can't be looked up is skipped until the next run, and
+// counted in the error returned once the rest have been tracked.
+func (w *Worker) TrackOnce() (int, error) {
+	changed, failed := 0, 0
+
+	var entries []models.TradeOutbox
+	result := w.db.Where("status IN ? AND batch_id IS NULL", unsettled).
+		FindInBatches(&entries, batchSize, func(_ *gorm.DB, _ int) error {
+			for _, entry := range entries {
+				ok, err := w.trackTrade(entry)
+				if err != nil {
+					log.Printf("Warning: Failed to track anchoring of trade %s: %v", entry.TradeID, err)
+					failed++
+					continue
+				}
+				if ok {
+					changed++
+				}
+			}
+			return nil
+		})
+	if result.Error != nil {
+		return changed, fmt.Errorf("failed to fetch outbox: %w", result.Error)
+	}
+
+	var batches []models.AnchorBatch
+	result = w.db.Where("status IN ?", unsettled).
+		FindInBatches(&batches, batchSize, func(_ *gorm.DB, _ int) error {
+			for _, batch := range batches {
+				ok, err := w.trackBatch(batch)
+				if err != nil {
+					log.Printf("Warning: Failed to track anchoring batch %s: %v", batch.ID, err)
+					failed++
+					continue
+				}
+				if ok {
+					changed++
+				}
+			}
+			return nil
+		})
+	if result.Error != nil {
+		return changed, fmt.Errorf("failed to fetch batches: %w", result.Error)
+	}
+
+	if failed > 0 {
+		return changed, fmt.Errorf("failed to track %d signatures", failed)
+	}
+	return changed, nil
+}
+
+// transition is the status change a signature's status calls for, or nil
+// if it calls for none
+func (w *Worker) transition(current string, sentAt *time.Time, confirmedAt *time.Time, status string) map[string]interface{} {
+	now := time.Now()
+	switch status {
+	case blockchain.TxFinalized:
+		updates := map[string]interface{}{"status": StatusFinalized, "finalized_at": now}
+		if confirmedAt == nil {
+			updates["confirmed_at"] = now
+		}
+		return updates
+	case blockchain.TxConfirmed:
+		if current == StatusConfirmed {
+			return nil
+		}
+		return map[string]interface{}{"status": StatusConfirmed, "confirmed_at": now}
+	case blockchain.TxUnknown:
+		// The blockhash it was signed with has lapsed, so it can no longer
+		// land and is safe to send again
+		if sentAt == nil || time.Since(*sentAt) < w.expiry {
+			return nil
+		}
+		return map[string]interface{}{"status": StatusExpired, "expired_at": now, "next_attempt_at": now}
+	}
+	return nil
+}
+
+// trackTrade looks up a trade's signature and applies its status to the
+// entry and trade, reporting whether it changed
+func (w *Worker) trackTrade(entry models.TradeOutbox) (bool, error) {
+	status, err := w.client.GetTransactionStatus(entry.Signature)
+	if err != nil {
+		return false, fmt.Errorf("failed to get status of %s: %w", entry.Signature, err)
+	}
+	if status == blockchain.TxFailed {
+		return true, w.retry(entry, fmt.Errorf("transaction %s failed on chain", entry.Signature))
+	}
+	updates := w.transition(entry.Status, entry.SentAt, entry.ConfirmedAt, status)
+	if updates == nil {
+		return false, nil
+	}
+
+	changed := false
+	err = w.db.Transaction(func(tx *gorm.DB) error {
+		// Only move the entry on from the state it was read in, in case
+		// another tracker got there first
+		result := tx.Model(&models.TradeOutbox{}).
+			Where("id = ? AND status = ? AND signature = ?", entry.ID, entry.Status, entry.Signature).
+			Updates(updates)
+		if result.Error != nil {
+			return fmt.Errorf("failed to update outbox entry: %w", result.Error)
+		}
+		if result.RowsAffected == 0 {
+			return nil
+		}
+		if err := tx.Model(&models.Trade{}).Where("id = ?", entry.TradeID).Update("anchor_status", updates["status"]).Error; err != nil {
+			return fmt.Errorf("failed to update trade: %w", err)
+		}
+		changed = true
+		return nil
+	})
+	if changed && updates["status"] == StatusExpired {
+		log.Printf("Warning: Anchoring signature %s for trade %s expired, sending again", entry.Signature, entry.TradeID)
+	}
+	return changed, err
+}
+
+// trackBatch looks up a batch's signature and applies its status to the
+// batch and every trade in it, reporting whether it changed
+func (w *Worker) trackBatch(batch models.AnchorBatch) (bool, error) {
+	status, err := w.client.GetTransactionStatus(batch.Signature)
+	if err != nil {
+		return false, fmt.Errorf("failed to get status of %s: %w", batch.Signature, err)
+	}
+	if status == blockchain.TxFailed {
+		return true, w.retryBatch(batch, fmt.Errorf("transaction %s failed on chain", batch.Signature))
+	}
+	updates := w.transition(batch.Status, batch.SentAt, batch.ConfirmedAt, status)
+	if updates == nil {
+		return false, nil
+	}
+
+	changed := false
+	err = w.db.Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(&models.AnchorBatch{}).
+			Where("id = ? AND status = ? AND signature = ?", batch.ID, batch.Status, batch.Signature).
+			Updates(updates)
+		if result.Error != nil {
+			return fmt.Errorf("failed to update batch: %w", result.Error)
+		}
+		if result.RowsAffected == 0 {
+			return nil
+		}
+		if err := markBatch(tx, batch, updates, map[string]interface{}{
+			"anchor_status": updates["status"],
+		}); err != nil {
+			return err
+		}
+		changed = true
+		return nil
+	})
+	if changed && updates["status"] == StatusExpired {
+		log.Printf("Warning: Anchoring signature %s for batch %s expired, sending again", batch.Signature, batch.ID)
+	}
+	return changed, err
+}
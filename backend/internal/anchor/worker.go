@@ -0,0 +1,246 @@
+package anchor
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/Enuma3lish/LUNG_CEX/backend/internal/models"
+	"github.com/Enuma3lish/LUNG_CEX/backend/pkg/blockchain"
+	"gorm.io/gorm"
+)
+
+const (
+	defaultSendInterval = 2 * time.Second
+	defaultBatchWindow  = 30 * time.Second
+	defaultMaxAttempts  = 10
+	batchSize           = 100
+
+	defaultConfirmInterval = 5 * time.Second
+	// A signature the cluster still doesn't know defaultExpiry after it was
+	// sent has outlived its blockhash and was dropped
+	defaultExpiry = 2 * time.Minute
+
+	// A claimed entry is retried after claimLease if the worker dies
+	// before recording the outcome
+	claimLease = time.Minute
+
+	// Retries back off exponentially from baseBackoff up to maxBackoff
+	baseBackoff = 5 * time.Second
+	maxBackoff  = 10 * time.Minute
+)
+
+// Worker sends queued trades to Solana, retrying failed sends with
+// exponential backoff until they succeed or run out of attempts. Trades
+// are batched into Merkle trees over a window and only each tree's root
+// is sent; with a zero window every trade is recorded on its own. Sent
+// signatures are then tracked until they finalize, and sent again if they
+// expire.
+type Worker struct {
+	db              *gorm.DB
+	client          *blockchain.SolanaClient
+	interval        time.Duration
+	window          time.Duration
+	maxAttempts     int
+	confirmInterval time.Duration
+	expiry          time.Duration
+}
+
+func NewWorker(db *gorm.DB, client *blockchain.SolanaClient) *Worker {
+	interval := defaultSendInterval
+	if v, err := time.ParseDuration(os.Getenv("ANCHOR_INTERVAL")); err == nil && v > 0 {
+		interval = v
+	}
+	window := defaultBatchWindow
+	if v, err := time.ParseDuration(os.Getenv("ANCHOR_BATCH_WINDOW")); err == nil && v >= 0 {
+		window = v
+	}
+	maxAttempts := defaultMaxAttempts
+	if v, err := strconv.Atoi(os.Getenv("ANCHOR_MAX_ATTEMPTS")); err == nil && v > 0 {
+		maxAttempts = v
+	}
+	confirmInterval := defaultConfirmInterval
+	if v, err := time.ParseDuration(os.Getenv("ANCHOR_CONFIRM_INTERVAL")); err == nil && v > 0 {
+		confirmInterval = v
+	}
+	expiry := defaultExpiry
+	if v, err := time.ParseDuration(os.Getenv("ANCHOR_EXPIRY")); err == nil && v > 0 {
+		expiry = v
+	}
+
+	return &Worker{
+		db:              db,
+		client:          client,
+		interval:        interval,
+		window:          window,
+		maxAttempts:     maxAttempts,
+		confirmInterval: confirmInterval,
+		expiry:          expiry,
+	}
+}
+
+// Run sends due trades on every tick until ctx is cancelled
+func (w *Worker) Run(ctx context.Context) {
+	ticker := time.NewTicker(w.interval)
+	defer ticker.Stop()
+
+	log.Printf("Trade anchoring worker started (interval %s, batch window %s)", w.interval, w.window)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if _, err := w.RunOnce(); err != nil {
+				log.Printf("Warning: Trade anchoring run failed: %v", err)
+			}
+		}
+	}
+}
+
+// RunOnce batches queued trades whose window has passed and sends what is
+// due, returning how many transactions were sent
+func (w *Worker) RunOnce() (int, error) {
+	sent := 0
+	if w.window == 0 {
+		n, err := w.sendTrades()
+		if err != nil {
+			return n, err
+		}
+		sent += n
+	} else if _, err := w.cutBatches(); err != nil {
+		return 0, err
+	}
+
+	// Batches cut before batching was turned off are still sent
+	n, err := w.sendBatches()
+	return sent + n, err
+}
+
+// sendable are the statuses of entries and batches waiting to be sent
+var sendable = []string{StatusPending, StatusExpired}
+
+// sendTrades records every unbatched trade that is due on its own,
+// returning how many were sent
+func (w *Worker) sendTrades() (int, error) {
+	var entries []models.TradeOutbox
+	if err := w.db.Preload("Trade.Market").
+		Where("status IN ? AND batch_id IS NULL AND next_attempt_at <= ?", sendable, time.Now()).
+		Order("next_attempt_at ASC").
+		Limit(batchSize).
+		Find(&entries).Error; err != nil {
+		return 0, fmt.Errorf("failed to fetch outbox: %w", err)
+	}
+
+	sent := 0
+	for _, entry := range entries {
+		// Claim the entry as it was read, so another worker doesn't send
+		// it too
+		result := w.db.Model(&models.TradeOutbox{}).
+			Where("id = ? AND status = ? AND next_attempt_at = ?", entry.ID, entry.Status, entry.NextAttemptAt).
+			Update("next_attempt_at", time.Now().Add(claimLease))
+		if result.Error != nil {
+			return sent, fmt.Errorf("failed to claim outbox entry: %w", result.Error)
+		}
+		if result.RowsAffected == 0 {
+			continue
+		}
+
+		trade := entry.Trade
+		sig, err := w.client.RecordTradeOnChain(blockchain.TradeRecord{
+			UserID:      trade.UserID,
+			AssetSymbol: trade.Market.Symbol,
+			TradeType:   trade.TradeType,
+			Quantity:    trade.Quantity,
+			Price:       trade.Price,
+			Timestamp:   trade.CreatedAt,
+		})
+		if err != nil {
+			if err := w.retry(entry, err); err != nil {
+				return sent, err
+			}
+			continue
+		}
+		if err := w.sent(entry, sig); err != nil {
+			return sent, err
+		}
+		sent++
+	}
+	return sent, nil
+}
+
+// sent records a successful send on the entry and its trade
+func (w *Worker) sent(entry models.TradeOutbox, sig string) error {
+	now := time.Now()
+	return w.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&entry).Updates(map[string]interface{}{
+			"status":     StatusSent,
+			"attempts":   entry.Attempts + 1,
+			"signature":  sig,
+			"sent_at":    now,
+			"last_error": "",
+		}).Error; err != nil {
+			return fmt.Errorf("failed to update outbox entry: %w", err)
+		}
+		if err := tx.Model(&models.Trade{}).Where("id = ?", entry.TradeID).Updates(map[string]interface{}{
+			"solana_signature": sig,
+			"anchor_status":    StatusSent,
+		}).Error; err != nil {
+			return fmt.Errorf("failed to update trade: %w", err)
+		}
+		return nil
+	})
+}
+
+// retry schedules the entry's next attempt after a failed send, or gives
+// up on it once it has used all its attempts
+func (w *Worker) retry(entry models.TradeOutbox, sendErr error) error {
+	attempts := entry.Attempts + 1
+	if attempts < w.maxAttempts {
+		return w.db.Transaction(func(tx *gorm.DB) error {
+			if err := tx.Model(&entry).Updates(map[string]interface{}{
+				"status":          StatusPending,
+				"attempts":        attempts,
+				"next_attempt_at": time.Now().Add(backoff(attempts)),
+				"last_error":      sendErr.Error(),
+			}).Error; err != nil {
+				return fmt.Errorf("failed to update outbox entry: %w", err)
+			}
+			if err := tx.Model(&models.Trade{}).Where("id = ?", entry.TradeID).Update("anchor_status", StatusPending).Error; err != nil {
+				return fmt.Errorf("failed to update trade: %w", err)
+			}
+			return nil
+		})
+	}
+
+	log.Printf("Warning: Giving up anchoring trade %s after %d attempts: %v", entry.TradeID, attempts, sendErr)
+	return w.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&entry).Updates(map[string]interface{}{
+			"status":     StatusFailed,
+			"attempts":   attempts,
+			"last_error": sendErr.Error(),
+		}).Error; err != nil {
+			return fmt.Errorf("failed to update outbox entry: %w", err)
+		}
+		if err := tx.Model(&models.Trade{}).Where("id = ?", entry.TradeID).Update("anchor_status", StatusFailed).Error; err != nil {
+			return fmt.Errorf("failed to update trade: %w", err)
+		}
+		return nil
+	})
+}
+
+// backoff is the wait before the attempt after the given number of
+// failures
+func backoff(failures int) time.Duration {
+	wait := baseBackoff
+	for i := 1; i < failures && wait < maxBackoff; i++ {
+		wait *= 2
+	}
+	if wait > maxBackoff {
+		wait = maxBackoff
+	}
+	return wait
+}
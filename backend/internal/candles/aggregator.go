@@ -0,0 +1,257 @@
+package candles
+
+import (
+	"context"
+	"log"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/Enuma3lish/LUNG_CEX/backend/internal/exchange"
+	"github.com/Enuma3lish/LUNG_CEX/backend/internal/models"
+	"github.com/Enuma3lish/LUNG_CEX/backend/pkg/pricefeed"
+	"github.com/Enuma3lish/LUNG_CEX/backend/pkg/utils"
+	"github.com/google/uuid"
+	"github.com/shopspring/decimal"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Intervals maps the supported candle intervals to their durations
+var Intervals = map[string]time.Duration{
+	"1m": time.Minute,
+	"5m": 5 * time.Minute,
+	"1h": time.Hour,
+	"1d": 24 * time.Hour,
+}
+
+const (
+	defaultSampleInterval = time.Second
+	defaultFlushInterval  = 5 * time.Second
+)
+
+type key struct {
+	symbol   string
+	interval string
+}
+
+// Aggregator builds OHLCV candles for every asset from sampled feed prices
+// and executed trades. Open candles are kept in memory and periodically
+// upserted to Postgres.
+type Aggregator struct {
+	db             *gorm.DB
+	priceFeed      pricefeed.PriceFeed
+	sampleInterval time.Duration
+	flushInterval  time.Duration
+
+	mu         sync.Mutex
+	assets     map[string]models.Asset
+	usdMarkets map[string]string // market symbol to base symbol
+	current    map[key]*models.Candle
+	dirty      map[key]bool
+}
+
+func NewAggregator(db *gorm.DB, priceFeed pricefeed.PriceFeed) *Aggregator {
+	sampleInterval := defaultSampleInterval
+	if v, err := time.ParseDuration(os.Getenv("CANDLE_SAMPLE_INTERVAL")); err == nil && v > 0 {
+		sampleInterval = v
+	}
+
+	flushInterval := defaultFlushInterval
+	if v, err := time.ParseDuration(os.Getenv("CANDLE_FLUSH_INTERVAL")); err == nil && v > 0 {
+		flushInterval = v
+	}
+
+	return &Aggregator{
+		db:             db,
+		priceFeed:      priceFeed,
+		sampleInterval: sampleInterval,
+		flushInterval:  flushInterval,
+		assets:         make(map[string]models.Asset),
+		usdMarkets:     make(map[string]string),
+		current:        make(map[key]*models.Candle),
+		dirty:          make(map[key]bool),
+	}
+}
+
+// Run samples the price feed and flushes candles until ctx is cancelled
+func (a *Aggregator) Run(ctx context.Context) {
+	var assets []models.Asset
+	if err := a.db.Find(&assets).Error; err != nil {
+		log.Printf("Warning: Candle aggregator failed to load assets: %v", err)
+		return
+	}
+	var markets []models.Market
+	if err := a.db.Preload("BaseAsset").Preload("QuoteAsset").Find(&markets).Error; err != nil {
+		log.Printf("Warning: Candle aggregator failed to load markets: %v", err)
+		return
+	}
+	a.mu.Lock()
+	for _, asset := range assets {
+		a.assets[asset.Symbol] = asset
+	}
+	for _, market := range markets {
+		if market.QuoteAsset.Symbol == pricefeed.USD {
+			a.usdMarkets[market.Symbol] = market.BaseAsset.Symbol
+		}
+	}
+	a.mu.Unlock()
+
+	sample := time.NewTicker(a.sampleInterval)
+	defer sample.Stop()
+	flush := time.NewTicker(a.flushInterval)
+	defer flush.Stop()
+
+	log.Printf("Candle aggregator started for %d assets (sample %s, flush %s)", len(assets), a.sampleInterval, a.flushInterval)
+
+	for {
+		select {
+		case <-ctx.Done():
+			a.Flush()
+			return
+		case now := <-sample.C:
+			for _, asset := range assets {
+				price, err := a.priceFeed.Price(asset.Symbol)
+				if err != nil {
+					continue
+				}
+				a.record(asset.Symbol, now, utils.FeedPrice(price, asset.TickSize), decimal.Zero)
+			}
+		case <-flush.C:
+			a.Flush()
+		}
+	}
+}
+
+// OnTrade folds an execution's fills into the candles. It is registered
+// as an exchange.TradeListener. Candles are in USD, so only fills on the
+// base asset's USD market count.
+func (a *Aggregator) OnTrade(symbol string, exec *exchange.Execution) {
+	a.mu.Lock()
+	base, ok := a.usdMarkets[symbol]
+	a.mu.Unlock()
+	if !ok {
+		return
+	}
+
+	for _, trade := range exec.Trades {
+		a.record(base, trade.CreatedAt, trade.Price, trade.Quantity)
+	}
+}
+
+// record updates every interval's open candle with a price observation.
+// Candles are loaded and saved outside the lock, so a slow query doesn't
+// hold up trades and samples for other assets.
+func (a *Aggregator) record(symbol string, at time.Time, price decimal.Decimal, volume decimal.Decimal) {
+	a.mu.Lock()
+	asset, ok := a.assets[symbol]
+	var missing []string
+	if ok {
+		for interval, d := range Intervals {
+			candle := a.current[key{symbol: symbol, interval: interval}]
+			if candle == nil || !candle.OpenTime.Equal(at.UTC().Truncate(d)) {
+				missing = append(missing, interval)
+			}
+		}
+	}
+	a.mu.Unlock()
+	if !ok {
+		return
+	}
+
+	// Resume candles persisted before a restart
+	loaded := make(map[string]*models.Candle, len(missing))
+	for _, interval := range missing {
+		loaded[interval] = a.load(asset.ID, interval, at.UTC().Truncate(Intervals[interval]))
+	}
+
+	var closed []models.Candle
+	a.mu.Lock()
+	for interval, d := range Intervals {
+		k := key{symbol: symbol, interval: interval}
+		openTime := at.UTC().Truncate(d)
+
+		candle := a.current[k]
+		if candle == nil || !candle.OpenTime.Equal(openTime) {
+			if candle != nil && a.dirty[k] {
+				// Persist the candle that just closed before replacing it
+				closed = append(closed, *candle)
+				delete(a.dirty, k)
+			}
+			candle = loaded[interval]
+			if candle == nil {
+				candle = &models.Candle{
+					AssetID:  asset.ID,
+					Interval: interval,
+					OpenTime: openTime,
+					Open:     price,
+					High:     price,
+					Low:      price,
+					Close:    price,
+				}
+			}
+			a.current[k] = candle
+		}
+
+		candle.High = decimal.Max(candle.High, price)
+		candle.Low = decimal.Min(candle.Low, price)
+		candle.Close = price
+		if volume.IsPositive() {
+			candle.Volume = candle.Volume.Add(volume)
+			candle.TradeCount++
+		}
+		a.dirty[k] = true
+	}
+	a.mu.Unlock()
+
+	for i := range closed {
+		a.save(&closed[i])
+	}
+}
+
+// Current returns the open candle for a symbol and interval
+func (a *Aggregator) Current(symbol string, interval string) (models.Candle, bool) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	candle, ok := a.current[key{symbol: symbol, interval: interval}]
+	if !ok {
+		return models.Candle{}, false
+	}
+	return *candle, true
+}
+
+// load resumes a candle persisted before a restart
+func (a *Aggregator) load(assetID uuid.UUID, interval string, openTime time.Time) *models.Candle {
+	var candle models.Candle
+	bucket := models.Candle{AssetID: assetID, Interval: interval, OpenTime: openTime}
+	if err := a.db.Where(&bucket).First(&candle).Error; err != nil {
+		return nil
+	}
+	return &candle
+}
+
+// Flush upserts every candle changed since the last flush
+func (a *Aggregator) Flush() {
+	a.mu.Lock()
+	changed := make([]models.Candle, 0, len(a.dirty))
+	for k := range a.dirty {
+		changed = append(changed, *a.current[k])
+		delete(a.dirty, k)
+	}
+	a.mu.Unlock()
+
+	for i := range changed {
+		a.save(&changed[i])
+	}
+}
+
+func (a *Aggregator) save(candle *models.Candle) {
+	err := a.db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "asset_id"}, {Name: "interval"}, {Name: "open_time"}},
+		DoUpdates: clause.AssignmentColumns([]string{"high", "low", "close", "volume", "trade_count", "updated_at"}),
+	}).Create(candle).Error
+	if err != nil {
+		log.Printf("Warning: Failed to save %s candle at %s: %v", candle.Interval, candle.OpenTime.Format(time.RFC3339), err)
+	}
+}
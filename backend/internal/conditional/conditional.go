@@ -0,0 +1,291 @@
+package conditional
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/Enuma3lish/LUNG_CEX/backend/internal/exchange"
+	"github.com/Enuma3lish/LUNG_CEX/backend/internal/futures"
+	"github.com/Enuma3lish/LUNG_CEX/backend/internal/models"
+	"github.com/Enuma3lish/LUNG_CEX/backend/internal/orderbook"
+	"github.com/Enuma3lish/LUNG_CEX/backend/internal/wallet"
+	"github.com/Enuma3lish/LUNG_CEX/backend/pkg/pricefeed"
+	"github.com/Enuma3lish/LUNG_CEX/backend/pkg/utils"
+	"github.com/google/uuid"
+	"github.com/shopspring/decimal"
+	"gorm.io/gorm"
+)
+
+// Conditional order kinds
+const (
+	KindStopMarket   = "STOP_MARKET"
+	KindStopLimit    = "STOP_LIMIT"
+	KindTakeProfit   = "TAKE_PROFIT"
+	KindTrailingStop = "TRAILING_STOP"
+)
+
+// Conditional order statuses
+const (
+	StatusActive    = "ACTIVE"
+	StatusTriggered = "TRIGGERED"
+	StatusCancelled = "CANCELLED"
+	StatusFailed    = "FAILED"
+)
+
+// Trigger conditions: the order fires once the price is at or beyond its
+// trigger on this side
+const (
+	Above = "ABOVE"
+	Below = "BELOW"
+)
+
+// Trailing offset types
+const (
+	TrailingPercent  = "PERCENT"
+	TrailingAbsolute = "ABSOLUTE"
+)
+
+var (
+	ErrNotFound             = errors.New("conditional order not found")
+	ErrNotActive            = errors.New("conditional order is not active")
+	ErrInvalidTarget        = errors.New("give either a market, side and quantity or a position")
+	ErrMarketNotFound       = errors.New("market not found")
+	ErrPositionNotFound     = errors.New("position not found")
+	ErrPositionNotOpen      = errors.New("position is not open")
+	ErrInvalidQuantity      = errors.New("quantity must be a positive multiple of the lot size")
+	ErrInsufficientQuantity = errors.New("insufficient quantity")
+	ErrInvalidTrigger       = errors.New("trigger price must be a positive multiple of the tick size")
+	ErrInvalidLimit         = errors.New("limit price is required for stop-limit orders and only accepted for them")
+	ErrInvalidTrailing      = errors.New("trailing stops need a trailing type and a positive offset, below 100 for a percent")
+	ErrWouldTrigger         = errors.New("trigger price would trigger immediately")
+	ErrPriceUnavailable     = errors.New("price unavailable")
+)
+
+// Create validates a conditional order request and stores the order. Spot
+// sells must be covered by the user's holding when created; the holding is
+// not reserved until the order triggers.
+func Create(db *gorm.DB, feed pricefeed.PriceFeed, userID uuid.UUID, req models.ConditionalOrderRequest) (*models.ConditionalOrder, error) {
+	if req.PositionID != "" {
+		if req.Market != "" || req.Side != "" || !req.Quantity.IsZero() {
+			return nil, ErrInvalidTarget
+		}
+		var position models.FuturesPosition
+		if err := db.Preload("Asset").Where("id = ? AND user_id = ?", req.PositionID, userID).First(&position).Error; err != nil {
+			return nil, ErrPositionNotFound
+		}
+		price, err := PositionPrice(feed, position)
+		if err != nil {
+			return nil, err
+		}
+		return Attach(db, position, req, price)
+	}
+
+	if req.Market == "" || req.Side == "" {
+		return nil, ErrInvalidTarget
+	}
+	var market models.Market
+	if err := db.Preload("BaseAsset").Preload("QuoteAsset").Where("symbol = ?", req.Market).First(&market).Error; err != nil {
+		return nil, ErrMarketNotFound
+	}
+	if !req.Quantity.IsPositive() || !utils.IsMultiple(req.Quantity, market.LotSize) {
+		return nil, ErrInvalidQuantity
+	}
+	if req.Side == orderbook.Sell {
+		w, err := wallet.Get(db, userID, market.BaseAssetID)
+		if err != nil {
+			return nil, err
+		}
+		if w.Available().LessThan(req.Quantity) {
+			return nil, ErrInsufficientQuantity
+		}
+	}
+	price, err := exchange.MarketPrice(feed, market)
+	if err != nil {
+		return nil, ErrPriceUnavailable
+	}
+
+	order := models.ConditionalOrder{
+		UserID:   userID,
+		MarketID: &market.ID,
+		Side:     req.Side,
+		Quantity: req.Quantity,
+	}
+	if err := build(&order, req, price, market.TickSize); err != nil {
+		return nil, err
+	}
+	if err := db.Create(&order).Error; err != nil {
+		return nil, fmt.Errorf("failed to create conditional order: %w", err)
+	}
+	order.Market = &market
+	return &order, nil
+}
+
+// Attach stores a take-profit or stop-loss that closes a whole futures
+// position. price is the position's current mark.
+func Attach(tx *gorm.DB, position models.FuturesPosition, req models.ConditionalOrderRequest, price decimal.Decimal) (*models.ConditionalOrder, error) {
+	if position.Status != futures.StatusOpen {
+		return nil, ErrPositionNotOpen
+	}
+	if req.Kind == KindStopLimit {
+		// Positions close at the mark price, never at a limit
+		return nil, ErrInvalidLimit
+	}
+
+	// A long closes by selling and a short by buying
+	side := orderbook.Sell
+	if position.PositionType == futures.Short {
+		side = orderbook.Buy
+	}
+	order := models.ConditionalOrder{
+		UserID:     position.UserID,
+		PositionID: &position.ID,
+		Side:       side,
+		Quantity:   position.Quantity,
+	}
+	if err := build(&order, req, price, position.Asset.TickSize); err != nil {
+		return nil, err
+	}
+	if err := tx.Create(&order).Error; err != nil {
+		return nil, fmt.Errorf("failed to create conditional order: %w", err)
+	}
+	return &order, nil
+}
+
+// build fills in an order's trigger from the request, given the current
+// price and the tick its prices step by
+func build(order *models.ConditionalOrder, req models.ConditionalOrderRequest, price decimal.Decimal, tick decimal.Decimal) error {
+	order.Kind = req.Kind
+	order.Status = StatusActive
+
+	if req.Kind == KindStopLimit {
+		if !req.LimitPrice.IsPositive() || !utils.IsMultiple(req.LimitPrice, tick) {
+			return ErrInvalidLimit
+		}
+		limit := req.LimitPrice
+		order.LimitPrice = &limit
+	} else if !req.LimitPrice.IsZero() {
+		return ErrInvalidLimit
+	}
+
+	// Stops fire as the price moves against the order's side, take-profits
+	// as it moves in its favour
+	order.Condition = Below
+	if order.Side == orderbook.Buy {
+		order.Condition = Above
+	}
+	if req.Kind == KindTakeProfit {
+		order.Condition = opposite(order.Condition)
+	}
+
+	if req.Kind == KindTrailingStop {
+		offset := req.TrailingOffset
+		if req.TrailingType == "" || !offset.IsPositive() || (req.TrailingType == TrailingPercent && offset.GreaterThanOrEqual(decimal.NewFromInt(100))) || !req.TriggerPrice.IsZero() {
+			return ErrInvalidTrailing
+		}
+		order.TrailingType = req.TrailingType
+		order.TrailingOffset = &offset
+		order.ExtremePrice = &price
+		order.TriggerPrice = Trail(*order, price, tick)
+		if !order.TriggerPrice.IsPositive() {
+			return ErrInvalidTrailing
+		}
+		return nil
+	}
+
+	if req.TrailingType != "" || !req.TrailingOffset.IsZero() {
+		return ErrInvalidTrailing
+	}
+	if !req.TriggerPrice.IsPositive() || !utils.IsMultiple(req.TriggerPrice, tick) {
+		return ErrInvalidTrigger
+	}
+	order.TriggerPrice = req.TriggerPrice
+	if Crossed(*order, price) {
+		return ErrWouldTrigger
+	}
+	return nil
+}
+
+// Trail is a trailing stop's trigger price for the best price it has
+// seen: below it for a sell, above it for a buy, rounded to the tick
+func Trail(order models.ConditionalOrder, extreme decimal.Decimal, tick decimal.Decimal) decimal.Decimal {
+	offset := *order.TrailingOffset
+	if order.TrailingType == TrailingPercent {
+		offset = extreme.Mul(offset).Div(decimal.NewFromInt(100))
+	}
+	if order.Side == orderbook.Sell {
+		return utils.RoundToStep(extreme.Sub(offset), tick)
+	}
+	return utils.RoundToStep(extreme.Add(offset), tick)
+}
+
+// Crossed reports whether price has reached an order's trigger
+func Crossed(order models.ConditionalOrder, price decimal.Decimal) bool {
+	if order.Condition == Above {
+		return price.GreaterThanOrEqual(order.TriggerPrice)
+	}
+	return price.LessThanOrEqual(order.TriggerPrice)
+}
+
+// PositionPrice is the mark price a position's conditional orders are
+// evaluated and closed at. The position's asset must be loaded.
+func PositionPrice(feed pricefeed.PriceFeed, position models.FuturesPosition) (decimal.Decimal, error) {
+	price, err := feed.Price(position.Asset.Symbol)
+	if err != nil {
+		return decimal.Zero, ErrPriceUnavailable
+	}
+	return utils.FeedPrice(price, position.Asset.TickSize), nil
+}
+
+// Cancel cancels one of a user's active conditional orders
+func Cancel(db *gorm.DB, userID uuid.UUID, id uuid.UUID) error {
+	result := db.Model(&models.ConditionalOrder{}).
+		Where("id = ? AND user_id = ? AND status = ?", id, userID, StatusActive).
+		Update("status", StatusCancelled)
+	if result.Error != nil {
+		return fmt.Errorf("failed to cancel conditional order: %w", result.Error)
+	}
+	if result.RowsAffected > 0 {
+		return nil
+	}
+
+	var count int64
+	if err := db.Model(&models.ConditionalOrder{}).Where("id = ? AND user_id = ?", id, userID).Count(&count).Error; err != nil {
+		return fmt.Errorf("failed to find conditional order: %w", err)
+	}
+	if count == 0 {
+		return ErrNotFound
+	}
+	return ErrNotActive
+}
+
+// CancelAll cancels all of a user's active conditional orders that could
+// place an order, returning how many it cancelled. Take-profits and
+// stop-losses attached to a futures position stay armed: they can only
+// close the position, never add to it.
+func CancelAll(db *gorm.DB, userID uuid.UUID) (int64, error) {
+	result := db.Model(&models.ConditionalOrder{}).
+		Where("user_id = ? AND position_id IS NULL AND status = ?", userID, StatusActive).
+		Update("status", StatusCancelled)
+	if result.Error != nil {
+		return 0, fmt.Errorf("failed to cancel conditional orders: %w", result.Error)
+	}
+	return result.RowsAffected, nil
+}
+
+// CancelForPosition cancels a position's active conditional orders once
+// it has closed
+func CancelForPosition(tx *gorm.DB, positionID uuid.UUID) error {
+	if err := tx.Model(&models.ConditionalOrder{}).
+		Where("position_id = ? AND status = ?", positionID, StatusActive).
+		Update("status", StatusCancelled).Error; err != nil {
+		return fmt.Errorf("failed to cancel position conditional orders: %w", err)
+	}
+	return nil
+}
+
+func opposite(condition string) string {
+	if condition == Above {
+		return Below
+	}
+	return Above
+}
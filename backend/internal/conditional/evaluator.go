@@ -0,0 +1,265 @@
+package conditional
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"github.com/Enuma3lish/LUNG_CEX/backend/internal/exchange"
+	"github.com/Enuma3lish/LUNG_CEX/backend/internal/futures"
+	"github.com/Enuma3lish/LUNG_CEX/backend/internal/models"
+	"github.com/Enuma3lish/LUNG_CEX/backend/pkg/pricefeed"
+	"github.com/shopspring/decimal"
+	"gorm.io/gorm"
+)
+
+const defaultEvaluationInterval = time.Second
+
+// Evaluator periodically checks active conditional orders against the
+// price feed. A triggered spot order is placed through the engine; a
+// triggered position order closes the position at its mark price.
+type Evaluator struct {
+	db        *gorm.DB
+	engine    *exchange.Engine
+	priceFeed pricefeed.PriceFeed
+	interval  time.Duration
+	listeners []futures.PositionListener
+}
+
+func NewEvaluator(db *gorm.DB, engine *exchange.Engine, priceFeed pricefeed.PriceFeed) *Evaluator {
+	interval := defaultEvaluationInterval
+	if v, err := time.ParseDuration(os.Getenv("CONDITIONAL_INTERVAL")); err == nil && v > 0 {
+		interval = v
+	}
+
+	return &Evaluator{
+		db:        db,
+		engine:    engine,
+		priceFeed: priceFeed,
+		interval:  interval,
+	}
+}
+
+// OnClose registers a listener for positions closed by a trigger.
+// Register listeners before calling Run.
+func (e *Evaluator) OnClose(listener futures.PositionListener) {
+	e.listeners = append(e.listeners, listener)
+}
+
+// Run evaluates conditional orders on every tick until ctx is cancelled
+func (e *Evaluator) Run(ctx context.Context) {
+	ticker := time.NewTicker(e.interval)
+	defer ticker.Stop()
+
+	log.Printf("Conditional order evaluator started (interval %s)", e.interval)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if _, err := e.RunOnce(); err != nil {
+				log.Printf("Warning: Conditional order run failed: %v", err)
+			}
+		}
+	}
+}
+
+// RunOnce evaluates every active conditional order once, returning how
+// many triggered. An order that fails is logged and skipped until the next
+// run, so it can't hold up the rest, and counted in the error returned.
+func (e *Evaluator) RunOnce() (int, error) {
+	var orders []models.ConditionalOrder
+	if err := e.db.Preload("Market.BaseAsset").Preload("Market.QuoteAsset").Preload("Position.Asset").
+		Where("status = ?", StatusActive).
+		Order("created_at ASC").
+		Find(&orders).Error; err != nil {
+		return 0, fmt.Errorf("failed to fetch conditional orders: %w", err)
+	}
+
+	// Price each market and contract once so every order sees the same price
+	prices := make(map[string]decimal.Decimal)
+	triggered, failed := 0, 0
+	for _, order := range orders {
+		if order.Position != nil && order.Position.Status != futures.StatusOpen {
+			// The position was closed some other way
+			e.finish(order, StatusCancelled, "")
+			continue
+		}
+
+		symbol, tick := e.target(order)
+		price, ok := prices[symbol]
+		if !ok {
+			var err error
+			if order.Position != nil {
+				price, err = PositionPrice(e.priceFeed, *order.Position)
+			} else {
+				price, err = exchange.MarketPrice(e.priceFeed, *order.Market)
+			}
+			if err != nil {
+				log.Printf("Warning: No price for %s conditional orders: %v", symbol, err)
+				continue
+			}
+			prices[symbol] = price
+		}
+
+		if order.Kind == KindTrailingStop {
+			if err := e.follow(&order, price, tick); err != nil {
+				log.Printf("Warning: Failed to follow trailing stop %s: %v", order.ID, err)
+				failed++
+				continue
+			}
+		}
+		if !Crossed(order, price) {
+			continue
+		}
+
+		ok, err := e.trigger(order, price)
+		if ok {
+			triggered++
+		}
+		if err != nil {
+			log.Printf("Warning: Failed to trigger conditional order %s: %v", order.ID, err)
+			failed++
+		}
+	}
+
+	if failed > 0 {
+		return triggered, fmt.Errorf("failed to evaluate %d of %d conditional orders", failed, len(orders))
+	}
+	return triggered, nil
+}
+
+// target names what an order is priced on and the tick its prices step by
+func (e *Evaluator) target(order models.ConditionalOrder) (string, decimal.Decimal) {
+	if order.Position != nil {
+		return order.Position.Asset.Symbol, order.Position.Asset.TickSize
+	}
+	return order.Market.Symbol, order.Market.TickSize
+}
+
+// follow moves a trailing stop's trigger after the price makes a new best
+func (e *Evaluator) follow(order *models.ConditionalOrder, price decimal.Decimal, tick decimal.Decimal) error {
+	extreme := *order.ExtremePrice
+	if order.Condition == Below && price.GreaterThan(extreme) || order.Condition == Above && price.LessThan(extreme) {
+		extreme = price
+	} else {
+		return nil
+	}
+
+	order.ExtremePrice = &extreme
+	order.TriggerPrice = Trail(*order, extreme, tick)
+	if err := e.db.Model(&models.ConditionalOrder{}).
+		Where("id = ? AND status = ?", order.ID, StatusActive).
+		Updates(map[string]interface{}{
+			"extreme_price": extreme,
+			"trigger_price": order.TriggerPrice,
+		}).Error; err != nil {
+		return fmt.Errorf("failed to update trailing stop: %w", err)
+	}
+	return nil
+}
+
+// errClaimed rolls back an execution whose order was claimed elsewhere
+var errClaimed = errors.New("conditional order is no longer active")
+
+// trigger claims an order and executes it in one transaction, so the order
+// is never left TRIGGERED without having run. Orders claimed elsewhere,
+// e.g. cancelled meanwhile, are skipped.
+func (e *Evaluator) trigger(order models.ConditionalOrder, price decimal.Decimal) (bool, error) {
+	if order.Position != nil {
+		return e.closePosition(order, price)
+	}
+
+	req := models.TradeRequest{
+		Market:    order.Market.Symbol,
+		OrderType: exchange.OrderTypeMarket,
+		Quantity:  order.Quantity,
+	}
+	if order.LimitPrice != nil {
+		req.OrderType = exchange.OrderTypeLimit
+		req.Price = *order.LimitPrice
+	}
+	_, err := e.engine.PlaceOrderWith(order.UserID, order.Side, req, func(tx *gorm.DB, placed models.Order) error {
+		return claim(tx, order, map[string]interface{}{"order_id": placed.ID})
+	})
+	if errors.Is(err, errClaimed) {
+		return false, nil
+	}
+	if err != nil {
+		// Failing to place the order is the user's outcome, not the run's
+		e.finish(order, StatusFailed, err.Error())
+	}
+	return true, nil
+}
+
+// claim marks an active order triggered, with any extra columns
+func claim(tx *gorm.DB, order models.ConditionalOrder, columns map[string]interface{}) error {
+	columns["status"] = StatusTriggered
+	columns["triggered_at"] = time.Now()
+	result := tx.Model(&models.ConditionalOrder{}).
+		Where("id = ? AND status = ?", order.ID, StatusActive).
+		Updates(columns)
+	if result.Error != nil {
+		return fmt.Errorf("failed to claim conditional order: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return errClaimed
+	}
+	return nil
+}
+
+// closePosition claims a triggered order, settles its position at price
+// and cancels the position's other conditional orders, all in one
+// transaction. The position is locked and reloaded first, since funding
+// may have changed its margin since the order was loaded. An order that
+// can't be executed is marked failed.
+func (e *Evaluator) closePosition(order models.ConditionalOrder, price decimal.Decimal) (bool, error) {
+	var position models.FuturesPosition
+	err := e.db.Transaction(func(tx *gorm.DB) error {
+		if err := claim(tx, order, map[string]interface{}{}); err != nil {
+			return err
+		}
+		var err error
+		if position, err = futures.Lock(tx, order.Position.ID); err != nil {
+			return err
+		}
+		position.Asset = order.Position.Asset
+		if err := futures.Settle(tx, &position, price, futures.StatusClosed); err != nil {
+			return err
+		}
+		return CancelForPosition(tx, position.ID)
+	})
+	switch {
+	case errors.Is(err, errClaimed):
+		return false, nil
+	case errors.Is(err, futures.ErrPositionNotOpen):
+		e.finish(order, StatusCancelled, "")
+		return false, nil
+	case err != nil:
+		e.finish(order, StatusFailed, err.Error())
+		return true, err
+	}
+
+	log.Printf("%s closed %s position %s at %s", order.Kind, position.PositionType, position.ID, price)
+	for _, listener := range e.listeners {
+		listener(position)
+	}
+	return true, nil
+}
+
+// finish records the final status of an order that is still active, so
+// a cancel that got there first stands
+func (e *Evaluator) finish(order models.ConditionalOrder, status string, reason string) {
+	if len(reason) > 255 {
+		reason = reason[:255]
+	}
+	if err := e.db.Model(&models.ConditionalOrder{}).
+		Where("id = ? AND status = ?", order.ID, StatusActive).
+		Updates(map[string]interface{}{"status": status, "error": reason}).Error; err != nil {
+		log.Printf("Warning: Failed to update conditional order %s: %v", order.ID, err)
+	}
+}
@@ -6,8 +6,11 @@ import (
 	"os"
 
 	"github.com/Enuma3lish/LUNG_CEX/backend/internal/models"
+	"github.com/google/uuid"
+	"github.com/shopspring/decimal"
 	"gorm.io/driver/postgres"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 	"gorm.io/gorm/logger"
 )
 
@@ -40,9 +43,22 @@ func RunMigrations(db *gorm.DB) error {
 	err := db.AutoMigrate(
 		&models.User{},
 		&models.Asset{},
-		&models.Holding{},
+		&models.Market{},
+		&models.Wallet{},
+		&models.Order{},
 		&models.Trade{},
+		&models.TradeOutbox{},
+		&models.AnchorBatch{},
 		&models.FuturesPosition{},
+		&models.ConditionalOrder{},
+		&models.CancelTimer{},
+		&models.IdempotencyKey{},
+		&models.LiquidationEvent{},
+		&models.FundingRate{},
+		&models.FundingPayment{},
+		&models.Candle{},
+		&models.JournalEntry{},
+		&models.Posting{},
 	)
 
 	if err != nil {
@@ -54,20 +70,35 @@ func RunMigrations(db *gorm.DB) error {
 		return fmt.Errorf("failed to seed assets: %w", err)
 	}
 
+	if err := seedMarkets(db); err != nil {
+		return fmt.Errorf("failed to seed markets: %w", err)
+	}
+
+	// Move balances kept before per-asset wallets into wallets
+	if err := migrateWallets(db); err != nil {
+		return fmt.Errorf("failed to migrate wallets: %w", err)
+	}
+
+	if err := backfillMarkets(db); err != nil {
+		return fmt.Errorf("failed to backfill markets: %w", err)
+	}
+
 	log.Println("Database migrations completed")
 	return nil
 }
 
 func seedAssets(db *gorm.DB) error {
+	cent := decimal.RequireFromString("0.01")
 	assets := []models.Asset{
-		{Symbol: "USDC", Name: "USD Coin", AssetType: "SPOT"},
-		{Symbol: "USDT", Name: "Tether USD", AssetType: "SPOT"},
-		{Symbol: "BTC", Name: "Bitcoin", AssetType: "SPOT"},
-		{Symbol: "ETH", Name: "Ethereum", AssetType: "SPOT"},
-		{Symbol: "SOL", Name: "Solana", AssetType: "SPOT"},
-		{Symbol: "BTC-PERP", Name: "Bitcoin Perpetual Futures", AssetType: "FUTURES"},
-		{Symbol: "ETH-PERP", Name: "Ethereum Perpetual Futures", AssetType: "FUTURES"},
-		{Symbol: "SOL-PERP", Name: "Solana Perpetual Futures", AssetType: "FUTURES"},
+		{Symbol: "USD", Name: "US Dollar", AssetType: "FIAT", TickSize: cent, LotSize: cent},
+		{Symbol: "USDC", Name: "USD Coin", AssetType: "SPOT", TickSize: cent, LotSize: cent},
+		{Symbol: "USDT", Name: "Tether USD", AssetType: "SPOT", TickSize: cent, LotSize: cent},
+		{Symbol: "BTC", Name: "Bitcoin", AssetType: "SPOT", TickSize: cent, LotSize: decimal.RequireFromString("0.00001")},
+		{Symbol: "ETH", Name: "Ethereum", AssetType: "SPOT", TickSize: cent, LotSize: decimal.RequireFromString("0.0001")},
+		{Symbol: "SOL", Name: "Solana", AssetType: "SPOT", TickSize: cent, LotSize: decimal.RequireFromString("0.001")},
+		{Symbol: "BTC-PERP", Name: "Bitcoin Perpetual Futures", AssetType: "FUTURES", TickSize: cent, LotSize: decimal.RequireFromString("0.00001")},
+		{Symbol: "ETH-PERP", Name: "Ethereum Perpetual Futures", AssetType: "FUTURES", TickSize: cent, LotSize: decimal.RequireFromString("0.0001")},
+		{Symbol: "SOL-PERP", Name: "Solana Perpetual Futures", AssetType: "FUTURES", TickSize: cent, LotSize: decimal.RequireFromString("0.001")},
 	}
 
 	for _, asset := range assets {
@@ -79,12 +110,192 @@ func seedAssets(db *gorm.DB) error {
 				return err
 			}
 			log.Printf("Created asset: %s", asset.Symbol)
+			continue
+		}
+
+		// Keep trading rules of existing assets in step with the seed
+		if !existing.TickSize.Equal(asset.TickSize) || !existing.LotSize.Equal(asset.LotSize) {
+			if err := db.Model(&existing).Updates(map[string]interface{}{
+				"tick_size": asset.TickSize,
+				"lot_size":  asset.LotSize,
+			}).Error; err != nil {
+				return err
+			}
+			log.Printf("Updated trading rules for asset: %s", asset.Symbol)
 		}
 	}
 
 	return nil
 }
 
+// seedMarket is the trading rules of a market between two seeded assets
+type seedMarket struct {
+	Base        string
+	Quote       string
+	TickSize    string
+	LotSize     string
+	MinNotional string
+	MakerFee    string
+	TakerFee    string
+}
+
+func seedMarkets(db *gorm.DB) error {
+	markets := []seedMarket{
+		{"BTC", "USD", "0.01", "0.00001", "1", "0.001", "0.002"},
+		{"ETH", "USD", "0.01", "0.0001", "1", "0.001", "0.002"},
+		{"SOL", "USD", "0.01", "0.001", "1", "0.001", "0.002"},
+		{"USDC", "USD", "0.0001", "0.01", "1", "0.0001", "0.0002"},
+		{"USDT", "USD", "0.0001", "0.01", "1", "0.0001", "0.0002"},
+		{"BTC", "USDC", "0.01", "0.00001", "1", "0.001", "0.002"},
+		{"ETH", "USDC", "0.01", "0.0001", "1", "0.001", "0.002"},
+		{"SOL", "USDC", "0.01", "0.001", "1", "0.001", "0.002"},
+		{"BTC", "USDT", "0.01", "0.00001", "1", "0.001", "0.002"},
+		{"ETH", "USDT", "0.01", "0.0001", "1", "0.001", "0.002"},
+		{"SOL", "USDT", "0.01", "0.001", "1", "0.001", "0.002"},
+		{"ETH", "BTC", "0.00001", "0.0001", "0.0001", "0.001", "0.002"},
+		{"SOL", "BTC", "0.0000001", "0.001", "0.0001", "0.001", "0.002"},
+		{"SOL", "ETH", "0.000001", "0.001", "0.001", "0.001", "0.002"},
+	}
+
+	var assets []models.Asset
+	if err := db.Find(&assets).Error; err != nil {
+		return err
+	}
+	ids := make(map[string]uuid.UUID, len(assets))
+	for _, asset := range assets {
+		ids[asset.Symbol] = asset.ID
+	}
+
+	for _, m := range markets {
+		market := models.Market{
+			Symbol:       m.Base + "-" + m.Quote,
+			BaseAssetID:  ids[m.Base],
+			QuoteAssetID: ids[m.Quote],
+			TickSize:     decimal.RequireFromString(m.TickSize),
+			LotSize:      decimal.RequireFromString(m.LotSize),
+			MinNotional:  decimal.RequireFromString(m.MinNotional),
+			MakerFeeRate: decimal.RequireFromString(m.MakerFee),
+			TakerFeeRate: decimal.RequireFromString(m.TakerFee),
+			Status:       "ACTIVE",
+		}
+
+		var existing models.Market
+		result := db.Where("symbol = ?", market.Symbol).First(&existing)
+
+		if result.Error == gorm.ErrRecordNotFound {
+			if err := db.Create(&market).Error; err != nil {
+				return err
+			}
+			log.Printf("Created market: %s", market.Symbol)
+			continue
+		}
+
+		// Keep trading rules in step with the seed, but leave the status and
+		// fee rates to operators
+		if !existing.TickSize.Equal(market.TickSize) || !existing.LotSize.Equal(market.LotSize) || !existing.MinNotional.Equal(market.MinNotional) {
+			if err := db.Model(&existing).Updates(map[string]interface{}{
+				"tick_size":    market.TickSize,
+				"lot_size":     market.LotSize,
+				"min_notional": market.MinNotional,
+			}).Error; err != nil {
+				return err
+			}
+			log.Printf("Updated trading rules for market: %s", market.Symbol)
+		}
+	}
+
+	return nil
+}
+
+// backfillMarkets links orders and trades from before markets to the
+// market of their asset pair
+func backfillMarkets(db *gorm.DB) error {
+	for _, table := range []string{"orders", "trades"} {
+		if err := db.Exec("UPDATE " + table + " SET market_id = markets.id FROM markets" +
+			" WHERE " + table + ".market_id IS NULL" +
+			" AND markets.base_asset_id = " + table + ".asset_id" +
+			" AND markets.quote_asset_id = " + table + ".quote_asset_id").Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// migrateWallets converts a database from before per-asset wallets: the
+// users' USD balance columns and the holdings table become wallets, and
+// orders and trades without a quote asset were priced in USD
+func migrateWallets(db *gorm.DB) error {
+	var usd models.Asset
+	if err := db.Where("symbol = ?", "USD").First(&usd).Error; err != nil {
+		return fmt.Errorf("cash asset missing: %w", err)
+	}
+
+	return db.Transaction(func(tx *gorm.DB) error {
+		migrator := tx.Migrator()
+
+		if migrator.HasColumn("users", "balance") {
+			locked := "0"
+			if migrator.HasColumn("users", "locked_balance") {
+				locked = "locked_balance"
+			}
+			var users []struct {
+				ID            uuid.UUID
+				Balance       decimal.Decimal
+				LockedBalance decimal.Decimal
+			}
+			if err := tx.Table("users").Select("id, COALESCE(balance, 0) AS balance, " + locked + " AS locked_balance").Scan(&users).Error; err != nil {
+				return err
+			}
+			for _, u := range users {
+				w := models.Wallet{UserID: u.ID, AssetID: usd.ID, Balance: u.Balance, Locked: u.LockedBalance}
+				if err := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&w).Error; err != nil {
+					return err
+				}
+			}
+			for _, column := range []string{"balance", "locked_balance"} {
+				if migrator.HasColumn("users", column) {
+					if err := migrator.DropColumn("users", column); err != nil {
+						return err
+					}
+				}
+			}
+			log.Printf("Moved %d user balances into USD wallets", len(users))
+		}
+
+		if migrator.HasTable("holdings") {
+			locked := "0"
+			if migrator.HasColumn("holdings", "locked_quantity") {
+				locked = "locked_quantity"
+			}
+			var holdings []struct {
+				UserID         uuid.UUID
+				AssetID        uuid.UUID
+				Quantity       decimal.Decimal
+				LockedQuantity decimal.Decimal
+				AvgPrice       decimal.Decimal
+			}
+			if err := tx.Table("holdings").Select("user_id, asset_id, quantity, " + locked + " AS locked_quantity, avg_price").Scan(&holdings).Error; err != nil {
+				return err
+			}
+			for _, h := range holdings {
+				w := models.Wallet{UserID: h.UserID, AssetID: h.AssetID, Balance: h.Quantity, Locked: h.LockedQuantity, AvgPrice: h.AvgPrice}
+				if err := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&w).Error; err != nil {
+					return err
+				}
+			}
+			if err := migrator.DropTable("holdings"); err != nil {
+				return err
+			}
+			log.Printf("Moved %d holdings into wallets", len(holdings))
+		}
+
+		if err := tx.Model(&models.Order{}).Where("quote_asset_id IS NULL").Update("quote_asset_id", usd.ID).Error; err != nil {
+			return err
+		}
+		return tx.Model(&models.Trade{}).Where("quote_asset_id IS NULL").Update("quote_asset_id", usd.ID).Error
+	})
+}
+
 func getEnv(key, defaultValue string) string {
 	value := os.Getenv(key)
 	if value == "" {
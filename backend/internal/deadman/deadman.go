@@ -0,0 +1,131 @@
+package deadman
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"github.com/Enuma3lish/LUNG_CEX/backend/internal/conditional"
+	"github.com/Enuma3lish/LUNG_CEX/backend/internal/exchange"
+	"github.com/Enuma3lish/LUNG_CEX/backend/internal/models"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const defaultCheckInterval = time.Second
+
+// Switch cancels a user's resting orders and armed conditional orders when
+// they stop checking in: either a cancel-after timer runs out, or a
+// WebSocket session that asked for cancel-on-disconnect drops. Timers are
+// kept in the database so they survive a restart.
+type Switch struct {
+	db       *gorm.DB
+	engine   *exchange.Engine
+	interval time.Duration
+}
+
+func NewSwitch(db *gorm.DB, engine *exchange.Engine) *Switch {
+	interval := defaultCheckInterval
+	if v, err := time.ParseDuration(os.Getenv("CANCEL_AFTER_INTERVAL")); err == nil && v > 0 {
+		interval = v
+	}
+
+	return &Switch{db: db, engine: engine, interval: interval}
+}
+
+// Arm sets a user's timer to fire timeout from now, replacing any earlier
+// timer. A zero timeout disarms it and returns nil.
+func (s *Switch) Arm(userID uuid.UUID, timeout time.Duration) (*models.CancelTimer, error) {
+	if timeout <= 0 {
+		if err := s.db.Delete(&models.CancelTimer{}, "user_id = ?", userID).Error; err != nil {
+			return nil, fmt.Errorf("failed to disarm cancel timer: %w", err)
+		}
+		return nil, nil
+	}
+
+	timer := models.CancelTimer{
+		UserID:    userID,
+		Timeout:   int(timeout / time.Second),
+		TriggerAt: time.Now().Add(timeout),
+	}
+	if err := s.db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "user_id"}},
+		DoUpdates: clause.AssignmentColumns([]string{"timeout", "trigger_at", "updated_at"}),
+	}).Create(&timer).Error; err != nil {
+		return nil, fmt.Errorf("failed to arm cancel timer: %w", err)
+	}
+	return &timer, nil
+}
+
+// Trip cancels all of a user's orders now. It is the listener for
+// cancel-on-disconnect sessions dropping and leaves any timer armed.
+func (s *Switch) Trip(userID uuid.UUID) {
+	s.cancel(userID, "session disconnected")
+}
+
+// Run fires expired timers on every tick until ctx is cancelled
+func (s *Switch) Run(ctx context.Context) {
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+
+	log.Printf("Cancel-after switch started (interval %s)", s.interval)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if _, err := s.RunOnce(); err != nil {
+				log.Printf("Warning: Cancel-after run failed: %v", err)
+			}
+		}
+	}
+}
+
+// RunOnce fires every timer that has run out, returning how many fired
+func (s *Switch) RunOnce() (int, error) {
+	var timers []models.CancelTimer
+	if err := s.db.Where("trigger_at <= ?", time.Now()).Find(&timers).Error; err != nil {
+		return 0, fmt.Errorf("failed to fetch cancel timers: %w", err)
+	}
+
+	fired := 0
+	for _, timer := range timers {
+		// Claim the timer as it was read; a refresh since then moved
+		// trigger_at and keeps it armed
+		result := s.db.Where("user_id = ? AND trigger_at = ?", timer.UserID, timer.TriggerAt).Delete(&models.CancelTimer{})
+		if result.Error != nil {
+			return fired, fmt.Errorf("failed to claim cancel timer: %w", result.Error)
+		}
+		if result.RowsAffected == 0 {
+			continue
+		}
+		s.cancel(timer.UserID, "cancel-after timer expired")
+		fired++
+	}
+	return fired, nil
+}
+
+// cancel cancels a user's resting orders, and their conditional orders so
+// none can trigger and place a new one. Position take-profits and
+// stop-losses stay armed to protect the positions left open.
+func (s *Switch) cancel(userID uuid.UUID, reason string) {
+	orders, err := s.engine.CancelAll(userID, "")
+	if err != nil {
+		log.Printf("Warning: Failed to cancel orders for user %s (%s): %v", userID, reason, err)
+	}
+	if len(orders) > 0 {
+		log.Printf("Cancelled %d orders for user %s: %s", len(orders), userID, reason)
+	}
+
+	cancelled, err := conditional.CancelAll(s.db, userID)
+	if err != nil {
+		log.Printf("Warning: Failed to cancel conditional orders for user %s (%s): %v", userID, reason, err)
+	}
+	if cancelled > 0 {
+		log.Printf("Cancelled %d conditional orders for user %s: %s", cancelled, userID, reason)
+	}
+}
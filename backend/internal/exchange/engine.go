@@ -0,0 +1,757 @@
+package exchange
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/Enuma3lish/LUNG_CEX/backend/internal/anchor"
+	"github.com/Enuma3lish/LUNG_CEX/backend/internal/fees"
+	"github.com/Enuma3lish/LUNG_CEX/backend/internal/ledger"
+	"github.com/Enuma3lish/LUNG_CEX/backend/internal/models"
+	"github.com/Enuma3lish/LUNG_CEX/backend/internal/orderbook"
+	"github.com/Enuma3lish/LUNG_CEX/backend/internal/wallet"
+	"github.com/Enuma3lish/LUNG_CEX/backend/pkg/pricefeed"
+	"github.com/Enuma3lish/LUNG_CEX/backend/pkg/utils"
+	"github.com/google/uuid"
+	"github.com/shopspring/decimal"
+	"gorm.io/gorm"
+)
+
+// Order statuses
+const (
+	StatusOpen            = "OPEN"
+	StatusPartiallyFilled = "PARTIALLY_FILLED"
+	StatusFilled          = "FILLED"
+	StatusCancelled       = "CANCELLED"
+	StatusExpired         = "EXPIRED"
+)
+
+// Time in force: how long an order stays working
+const (
+	TimeInForceGTC = "GTC" // rests until filled or cancelled
+	TimeInForceIOC = "IOC" // fills what it can at once and cancels the rest
+	TimeInForceFOK = "FOK" // fills in full at once or is rejected
+	TimeInForceGTD = "GTD" // rests until filled, cancelled or its expiry
+)
+
+// Order types
+const (
+	OrderTypeLimit  = "LIMIT"
+	OrderTypeMarket = "MARKET"
+)
+
+// Liquidity sides of a trade. A book fill writes one MAKER and one TAKER
+// trade; a platform fill writes only the user's TAKER trade.
+const (
+	LiquidityMaker = "MAKER"
+	LiquidityTaker = "TAKER"
+)
+
+// Market statuses. Only active markets accept orders.
+const (
+	MarketActive = "ACTIVE"
+	MarketHalted = "HALTED"
+)
+
+// defaultMaxSlippageBps bounds market orders that don't specify their own
+// slippage; override with MAX_SLIPPAGE_BPS
+const defaultMaxSlippageBps = 50
+
+var (
+	ErrMarketNotFound       = errors.New("market not found")
+	ErrMarketHalted         = errors.New("market is not open for trading")
+	ErrInsufficientBalance  = errors.New("insufficient balance")
+	ErrNoHolding            = errors.New("no holding found for this asset")
+	ErrInsufficientQuantity = errors.New("insufficient quantity")
+	ErrPriceRequired        = errors.New("price is required for limit orders")
+	ErrPriceNotAllowed      = errors.New("price is only accepted for limit orders")
+	ErrPriceUnavailable     = errors.New("price unavailable")
+	ErrInvalidQuantity      = errors.New("quantity must be a positive multiple of the lot size")
+	ErrInvalidPrice         = errors.New("price must be a positive multiple of the tick size")
+	ErrBelowMinNotional     = errors.New("order value is below the market's minimum notional")
+	ErrInvalidTimeInForce   = errors.New("market orders are immediate-or-cancel or fill-or-kill")
+	ErrInvalidExpiry        = errors.New("expires_at must be in the future and is only accepted for GTD orders")
+	ErrPostOnlyNotResting   = errors.New("post-only orders must be GTC or GTD limit orders")
+	ErrPostOnlyWouldTake    = errors.New("post-only order would take liquidity")
+	ErrFillOrKill           = errors.New("fill-or-kill order cannot be filled in full")
+	ErrReduceOnly           = errors.New("reduce-only orders can only sell an existing holding")
+	ErrDuplicateClientID    = errors.New("client_order_id is already in use")
+	ErrOrderNotFound        = errors.New("order not found")
+	ErrOrderNotOpen         = errors.New("order is not open")
+	ErrNothingToAmend       = errors.New("amendment must change the price or quantity")
+	ErrAmendBelowFilled     = errors.New("amended quantity must exceed the filled quantity")
+	ErrAmendWouldCross      = errors.New("amended price would match resting orders")
+)
+
+// Engine owns the in-memory order books and settles their matches
+// against the database
+type Engine struct {
+	db             *gorm.DB
+	priceFeed      pricefeed.PriceFeed
+	maxSlippageBps int
+
+	mu        sync.Mutex
+	books     map[string]*orderbook.Book
+	listeners []TradeListener
+}
+
+// Execution is the outcome of placing an order
+type Execution struct {
+	Market      models.Market
+	Order       models.Order
+	Trades      []models.Trade  // fills on the submitting user's side, one per fill
+	MakerTrades []models.Trade  // fills on the resting orders' side
+	Balance     decimal.Decimal // the submitter's quote balance afterwards
+}
+
+// TradeListener is called with every committed execution that produced
+// trades. Listeners run synchronously, after the market's book is
+// unlocked, and must not block.
+type TradeListener func(symbol string, exec *Execution)
+
+func NewEngine(db *gorm.DB, priceFeed pricefeed.PriceFeed) *Engine {
+	maxSlippageBps := defaultMaxSlippageBps
+	if v, err := strconv.Atoi(os.Getenv("MAX_SLIPPAGE_BPS")); err == nil && v > 0 {
+		maxSlippageBps = v
+	}
+
+	return &Engine{
+		db:             db,
+		priceFeed:      priceFeed,
+		maxSlippageBps: maxSlippageBps,
+		books:          make(map[string]*orderbook.Book),
+	}
+}
+
+// OnTrade registers a listener for committed executions
+func (e *Engine) OnTrade(listener TradeListener) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	e.listeners = append(e.listeners, listener)
+}
+
+// Book returns the order book for a symbol, creating it if needed
+func (e *Engine) Book(symbol string) *orderbook.Book {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	book, ok := e.books[symbol]
+	if !ok {
+		book = orderbook.NewBook(symbol)
+		e.books[symbol] = book
+	}
+	return book
+}
+
+// FindBook returns the order book for a symbol without creating one
+func (e *Engine) FindBook(symbol string) (*orderbook.Book, bool) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	book, ok := e.books[symbol]
+	return book, ok
+}
+
+// Restore rebuilds the order books from resting orders in the database
+func (e *Engine) Restore() error {
+	var orders []models.Order
+	if err := e.db.Preload("Market").
+		Where("status IN ?", []string{StatusOpen, StatusPartiallyFilled}).
+		Order("COALESCE(requeued_at, created_at) ASC").
+		Find(&orders).Error; err != nil {
+		return fmt.Errorf("failed to load resting orders: %w", err)
+	}
+
+	for _, order := range orders {
+		book := e.Book(order.Market.Symbol)
+		book.Lock()
+		book.Add(bookOrder(order))
+		book.Unlock()
+	}
+
+	log.Printf("Restored %d resting orders", len(orders))
+	return nil
+}
+
+// MarketSymbol names the market trading base against quote, e.g. ETH-BTC
+func MarketSymbol(base string, quote string) string {
+	return base + "-" + quote
+}
+
+// pair is the market an order trades on with its assets loaded
+type pair struct {
+	models.Market
+	QuoteUSD decimal.Decimal // USD price of the quote, for cost basis
+}
+
+// step is what amounts of the quote asset are rounded to
+func (p pair) step() decimal.Decimal {
+	return p.QuoteAsset.LotSize
+}
+
+// OrderHook runs in the transaction that places an order, once the order
+// is created. An error it returns rolls the whole placement back.
+type OrderHook func(tx *gorm.DB, order models.Order) error
+
+// PlaceOrder reserves funds for an order and matches it against the book.
+// Limit orders rest any remainder. Market orders are priced by the server:
+// they sweep the book no further than the client's slippage from the
+// current price, and the platform fills the rest at that price.
+func (e *Engine) PlaceOrder(userID uuid.UUID, side string, req models.TradeRequest) (*Execution, error) {
+	return e.PlaceOrderWith(userID, side, req, nil)
+}
+
+// PlaceOrderWith places an order like PlaceOrder, running hook in the same
+// transaction, so what the hook writes commits exactly when the order does
+func (e *Engine) PlaceOrderWith(userID uuid.UUID, side string, req models.TradeRequest, hook OrderHook) (*Execution, error) {
+	orderType := req.OrderType
+	if orderType == "" {
+		orderType = OrderTypeMarket
+		if !req.Price.IsZero() {
+			orderType = OrderTypeLimit
+		}
+	}
+	if orderType == OrderTypeLimit && req.Price.IsZero() {
+		return nil, ErrPriceRequired
+	}
+	if orderType == OrderTypeMarket && !req.Price.IsZero() {
+		return nil, ErrPriceNotAllowed
+	}
+	tif, err := timeInForce(orderType, req)
+	if err != nil {
+		return nil, err
+	}
+	// Spot has no short positions, so only a sell can reduce one
+	if req.ReduceOnly && side != orderbook.Sell {
+		return nil, ErrReduceOnly
+	}
+
+	symbol := req.Market
+	if symbol == "" {
+		quote := req.QuoteSymbol
+		if quote == "" {
+			quote = wallet.CashSymbol
+		}
+		symbol = MarketSymbol(req.AssetSymbol, quote)
+	}
+	p, err := e.pair(symbol)
+	if err != nil {
+		return nil, err
+	}
+
+	// Orders must sit on the market's lot and tick grid
+	if !req.Quantity.IsPositive() || !utils.IsMultiple(req.Quantity, p.LotSize) {
+		return nil, ErrInvalidQuantity
+	}
+	if orderType == OrderTypeLimit && (!req.Price.IsPositive() || !utils.IsMultiple(req.Price, p.TickSize)) {
+		return nil, ErrInvalidPrice
+	}
+
+	order := models.Order{
+		UserID:       userID,
+		MarketID:     p.ID,
+		AssetID:      p.BaseAssetID,
+		QuoteAssetID: p.QuoteAssetID,
+		Side:         side,
+		OrderType:    orderType,
+		Price:        req.Price,
+		Quantity:     req.Quantity,
+		Status:       StatusOpen,
+		TimeInForce:  tif,
+		ExpiresAt:    req.ExpiresAt,
+		PostOnly:     req.PostOnly,
+		ReduceOnly:   req.ReduceOnly,
+	}
+	if req.ClientOrderID != "" {
+		order.ClientOrderID = &req.ClientOrderID
+	}
+
+	var marketPrice decimal.Decimal
+	if orderType == OrderTypeMarket {
+		marketPrice, err = MarketPrice(e.priceFeed, p.Market)
+		if err != nil {
+			return nil, err
+		}
+		order.Price = worstPrice(side, marketPrice, e.slippage(req.MaxSlippageBps), p.TickSize)
+	}
+
+	// Market orders are sized at the current price rather than their bound
+	notional := order.Price
+	if orderType == OrderTypeMarket {
+		notional = marketPrice
+	}
+	if notional.Mul(order.Quantity).LessThan(p.MinNotional) {
+		return nil, ErrBelowMinNotional
+	}
+
+	exec, err := e.execute(p, order, marketPrice, hook)
+	if err != nil {
+		return nil, err
+	}
+
+	// Listeners run once the book is unlocked, so a slow one can't stall
+	// matching on the market
+	if len(exec.Trades) > 0 {
+		e.notify(p.Symbol, exec)
+	}
+
+	return exec, nil
+}
+
+// execute matches an order against its market's book and settles the
+// fills, holding the book's lock throughout. Makers the order mustn't
+// trade with are passed over and closed in the same transaction, see
+// closing.
+func (e *Engine) execute(p pair, order models.Order, marketPrice decimal.Decimal, hook OrderHook) (*Execution, error) {
+	book := e.Book(p.Symbol)
+	book.Lock()
+	defer book.Unlock()
+
+	now := time.Now()
+	fills, skipped := book.MatchSkipping(order.Side, order.Price, order.Quantity, func(maker *orderbook.Order) bool {
+		return closing(maker, order.UserID, now) != ""
+	})
+	stale := make([]staleMaker, len(skipped))
+	for i, maker := range skipped {
+		stale[i] = staleMaker{Order: maker, status: closing(maker, order.UserID, now)}
+	}
+	if order.PostOnly && len(fills) > 0 {
+		return nil, ErrPostOnlyWouldTake
+	}
+	if order.TimeInForce == TimeInForceFOK && order.OrderType == OrderTypeLimit && matched(fills).LessThan(order.Quantity) {
+		return nil, ErrFillOrKill
+	}
+
+	tx := e.db.Begin()
+	exec, err := e.placeOrder(tx, p, order, fills, stale, marketPrice, hook)
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+	if err := tx.Commit().Error; err != nil {
+		return nil, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	// The database is authoritative, so only touch the book once committed
+	for _, maker := range stale {
+		book.Remove(maker.ID)
+	}
+	book.Apply(fills)
+	if isResting(exec.Order.Status) {
+		book.Add(bookOrder(exec.Order))
+	}
+	return exec, nil
+}
+
+// MarketPrice is the feed price of a market's base asset in its quote
+// asset, rounded to the market's tick. The market's assets must be loaded.
+func MarketPrice(feed pricefeed.PriceFeed, market models.Market) (decimal.Decimal, error) {
+	baseUSD, err := pricefeed.USDPrice(feed, market.BaseAsset.Symbol)
+	if err != nil {
+		return decimal.Zero, ErrPriceUnavailable
+	}
+	quoteUSD, err := pricefeed.USDPrice(feed, market.QuoteAsset.Symbol)
+	if err != nil || quoteUSD <= 0 {
+		return decimal.Zero, ErrPriceUnavailable
+	}
+	return utils.RoundToStep(decimal.NewFromFloat(baseUSD).Div(decimal.NewFromFloat(quoteUSD)), market.TickSize), nil
+}
+
+// pair loads an open market and its assets
+func (e *Engine) pair(symbol string) (pair, error) {
+	var p pair
+	if err := e.db.Preload("BaseAsset").Preload("QuoteAsset").Where("symbol = ?", symbol).First(&p.Market).Error; err != nil {
+		return pair{}, ErrMarketNotFound
+	}
+	if p.Status != MarketActive {
+		return pair{}, ErrMarketHalted
+	}
+
+	quoteUSD, err := pricefeed.USDPrice(e.priceFeed, p.QuoteAsset.Symbol)
+	if err != nil {
+		return pair{}, ErrPriceUnavailable
+	}
+	p.QuoteUSD = decimal.NewFromFloat(quoteUSD)
+	return p, nil
+}
+
+func (e *Engine) notify(symbol string, exec *Execution) {
+	e.mu.Lock()
+	listeners := e.listeners
+	e.mu.Unlock()
+
+	for _, listener := range listeners {
+		listener(symbol, exec)
+	}
+}
+
+func (e *Engine) placeOrder(tx *gorm.DB, p pair, order models.Order, fills []orderbook.Fill, stale []staleMaker, marketPrice decimal.Decimal, hook OrderHook) (*Execution, error) {
+	if order.ClientOrderID != nil {
+		var count int64
+		if err := tx.Model(&models.Order{}).Where("user_id = ? AND client_order_id = ?", order.UserID, *order.ClientOrderID).Count(&count).Error; err != nil {
+			return nil, fmt.Errorf("failed to check client order id: %w", err)
+		}
+		if count > 0 {
+			return nil, ErrDuplicateClientID
+		}
+	}
+
+	// Lock every wallet the order can touch before reading any of them:
+	// both of the submitter's and both of each maker's, stale or not
+	keys := []wallet.Key{{UserID: order.UserID, AssetID: p.QuoteAssetID}, {UserID: order.UserID, AssetID: p.BaseAssetID}}
+	for _, fill := range fills {
+		keys = append(keys, wallet.Key{UserID: fill.Maker.UserID, AssetID: p.QuoteAssetID}, wallet.Key{UserID: fill.Maker.UserID, AssetID: p.BaseAssetID})
+	}
+	for _, maker := range stale {
+		keys = append(keys, wallet.Key{UserID: maker.UserID, AssetID: p.QuoteAssetID}, wallet.Key{UserID: maker.UserID, AssetID: p.BaseAssetID})
+	}
+	if err := wallet.LockAll(tx, keys); err != nil {
+		return nil, err
+	}
+
+	for _, maker := range stale {
+		if err := closeStale(tx, p, maker.ID, maker.status); err != nil {
+			return nil, err
+		}
+	}
+
+	// Reserve the funds the order can consume: quote for a buy, base for a sell
+	if order.Side == orderbook.Buy {
+		if _, err := wallet.Lock(tx, order.UserID, p.QuoteAssetID, Reserved(order.Quantity, order.Price, p.step())); err != nil {
+			if errors.Is(err, wallet.ErrInsufficientBalance) {
+				return nil, ErrInsufficientBalance
+			}
+			return nil, err
+		}
+	} else {
+		w, err := wallet.Get(tx, order.UserID, p.BaseAssetID)
+		if err != nil {
+			return nil, err
+		}
+		if w.Balance.IsZero() {
+			return nil, ErrNoHolding
+		}
+		if w.Available().LessThan(order.Quantity) {
+			return nil, ErrInsufficientQuantity
+		}
+		if _, err := wallet.Lock(tx, order.UserID, p.BaseAssetID, order.Quantity); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := tx.Create(&order).Error; err != nil {
+		return nil, fmt.Errorf("failed to create order: %w", err)
+	}
+	if hook != nil {
+		if err := hook(tx, order); err != nil {
+			return nil, err
+		}
+	}
+
+	// Fee tiers come from volume before this order, so an order's own
+	// fills don't discount each other
+	tiers := make(map[uuid.UUID]models.FeeTier)
+	tierOf := func(userID uuid.UUID) (models.FeeTier, error) {
+		if tier, ok := tiers[userID]; ok {
+			return tier, nil
+		}
+		tier, err := fees.UserTier(tx, e.priceFeed, userID)
+		if err != nil {
+			return models.FeeTier{}, err
+		}
+		tiers[userID] = tier
+		return tier, nil
+	}
+	takerTier, err := tierOf(order.UserID)
+	if err != nil {
+		return nil, err
+	}
+	takerRate := takerTier.Rate(p.TakerFeeRate)
+
+	exec := &Execution{}
+	for _, fill := range fills {
+		var maker models.Order
+		if err := tx.First(&maker, "id = ?", fill.Maker.ID).Error; err != nil {
+			return nil, fmt.Errorf("failed to load maker order: %w", err)
+		}
+		makerTier, err := tierOf(maker.UserID)
+		if err != nil {
+			return nil, err
+		}
+		makerTrade, err := e.settle(tx, p, &maker, fill.Quantity, fill.Price, LiquidityMaker, makerTier.Rate(p.MakerFeeRate))
+		if err != nil {
+			return nil, err
+		}
+		exec.MakerTrades = append(exec.MakerTrades, makerTrade)
+		if err := tx.Save(&maker).Error; err != nil {
+			return nil, fmt.Errorf("failed to update maker order: %w", err)
+		}
+
+		trade, err := e.settle(tx, p, &order, fill.Quantity, fill.Price, LiquidityTaker, takerRate)
+		if err != nil {
+			return nil, err
+		}
+		exec.Trades = append(exec.Trades, trade)
+	}
+
+	// Whatever the book couldn't absorb of a market order is filled by the
+	// platform at the server's price
+	if remaining := order.Quantity.Sub(order.FilledQuantity); order.OrderType == OrderTypeMarket && remaining.IsPositive() {
+		trade, err := e.settle(tx, p, &order, remaining, marketPrice, LiquidityTaker, takerRate)
+		if err != nil {
+			return nil, err
+		}
+		exec.Trades = append(exec.Trades, trade)
+	}
+
+	// An immediate-or-cancel limit order gives up what it couldn't fill
+	if order.TimeInForce == TimeInForceIOC && isResting(order.Status) {
+		if err := release(tx, p.step(), order); err != nil {
+			return nil, err
+		}
+		order.Status = StatusCancelled
+	}
+
+	if err := tx.Save(&order).Error; err != nil {
+		return nil, fmt.Errorf("failed to update order: %w", err)
+	}
+
+	quote, err := wallet.Get(tx, order.UserID, p.QuoteAssetID)
+	if err != nil {
+		return nil, err
+	}
+
+	exec.Market = p.Market
+	exec.Order = order
+	exec.Balance = quote.Balance
+	return exec, nil
+}
+
+// settle books one side of a fill against an order's reserved funds and
+// writes that side's trade row. Both sides of a fill use the same amount,
+// its Cost, so every asset is conserved exactly. The fee is taken at
+// feeRate out of what the side receives.
+func (e *Engine) settle(tx *gorm.DB, p pair, order *models.Order, quantity decimal.Decimal, price decimal.Decimal, liquidity string, feeRate decimal.Decimal) (models.Trade, error) {
+	amount := Cost(quantity, price, p.step())
+
+	var fee decimal.Decimal
+	feeAsset := p.BaseAsset
+	if order.Side == orderbook.Buy {
+		fee = utils.RoundToStep(quantity.Mul(feeRate), p.BaseAsset.LotSize)
+		received := quantity.Sub(fee)
+
+		// The buyer pays out of the funds reserved at its own limit price,
+		// and the fee is part of what the rest of the quantity cost
+		remaining := order.Quantity.Sub(order.FilledQuantity)
+		release := Reserved(remaining, order.Price, p.step()).Sub(Reserved(remaining.Sub(quantity), order.Price, p.step()))
+		if _, err := wallet.Adjust(tx, order.UserID, p.QuoteAssetID, amount.Neg(), release.Neg()); err != nil {
+			return models.Trade{}, err
+		}
+		if _, err := wallet.Credit(tx, order.UserID, p.BaseAssetID, received, price.Mul(p.QuoteUSD).Mul(quantity).Div(received)); err != nil {
+			return models.Trade{}, err
+		}
+	} else {
+		feeAsset = p.QuoteAsset
+		fee = utils.RoundToStep(amount.Mul(feeRate), p.step())
+
+		if _, err := wallet.Adjust(tx, order.UserID, p.BaseAssetID, quantity.Neg(), quantity.Neg()); err != nil {
+			return models.Trade{}, err
+		}
+		if _, err := wallet.Credit(tx, order.UserID, p.QuoteAssetID, amount.Sub(fee), p.QuoteUSD); err != nil {
+			return models.Trade{}, err
+		}
+	}
+
+	applyFill(order, quantity)
+
+	orderID := order.ID
+	trade := models.Trade{
+		UserID:       order.UserID,
+		MarketID:     p.ID,
+		AssetID:      p.BaseAssetID,
+		QuoteAssetID: p.QuoteAssetID,
+		OrderID:      &orderID,
+		TradeType:    order.Side,
+		Liquidity:    liquidity,
+		Quantity:     quantity,
+		Price:        price,
+		TotalAmount:  amount,
+		Fee:          fee,
+		FeeRate:      feeRate,
+		FeeAssetID:   feeAsset.ID,
+		AnchorStatus: anchor.StatusPending,
+	}
+	if err := tx.Create(&trade).Error; err != nil {
+		return models.Trade{}, fmt.Errorf("failed to create trade: %w", err)
+	}
+	if err := anchor.Enqueue(tx, trade.ID); err != nil {
+		return models.Trade{}, err
+	}
+
+	// The clearing account takes the other side of each leg
+	quote, base := amount.Neg(), quantity
+	if order.Side == orderbook.Sell {
+		quote, base = amount, quantity.Neg()
+	}
+	if _, err := ledger.Post(tx, ledger.EntryTrade, trade.ID.String(),
+		fmt.Sprintf("%s %s %s @ %s %s", order.Side, quantity, p.BaseAsset.Symbol, price, p.QuoteAsset.Symbol),
+		ledger.Wallet(order.UserID, p.QuoteAsset.Symbol, quote),
+		ledger.Wallet(order.UserID, p.BaseAsset.Symbol, base),
+		ledger.Platform(ledger.AccountClearing, p.QuoteAsset.Symbol, quote.Neg()),
+		ledger.Platform(ledger.AccountClearing, p.BaseAsset.Symbol, base.Neg()),
+	); err != nil {
+		return models.Trade{}, err
+	}
+	if fee.IsPositive() {
+		if _, err := ledger.Post(tx, ledger.EntryFee, trade.ID.String(),
+			fmt.Sprintf("%s fee on %s %s %s", liquidity, order.Side, quantity, p.BaseAsset.Symbol),
+			ledger.Wallet(order.UserID, feeAsset.Symbol, fee.Neg()),
+			ledger.Platform(ledger.AccountFees, feeAsset.Symbol, fee),
+		); err != nil {
+			return models.Trade{}, err
+		}
+	}
+	return trade, nil
+}
+
+// staleMaker is a resting order matching passed over, and the status it
+// is closed with
+type staleMaker struct {
+	*orderbook.Order
+	status string
+}
+
+// closing is the status a resting order is closed with when a taker
+// reaches it, or "" if the taker may trade with it. A GTD order past its
+// expiry that the sweeper hasn't reached yet is expired, and the taker's
+// own order is cancelled, so nobody trades with themselves.
+func closing(maker *orderbook.Order, taker uuid.UUID, now time.Time) string {
+	if maker.ExpiresAt != nil && !maker.ExpiresAt.After(now) {
+		return StatusExpired
+	}
+	if maker.UserID == taker {
+		return StatusCancelled
+	}
+	return ""
+}
+
+// closeStale closes a resting order matching passed over, releasing what
+// it reserved
+func closeStale(tx *gorm.DB, p pair, id uuid.UUID, status string) error {
+	var order models.Order
+	if err := tx.First(&order, "id = ?", id).Error; err != nil {
+		return fmt.Errorf("failed to load resting order: %w", err)
+	}
+	if err := release(tx, p.step(), order); err != nil {
+		return err
+	}
+	if err := tx.Model(&order).Update("status", status).Error; err != nil {
+		return fmt.Errorf("failed to close resting order: %w", err)
+	}
+	return nil
+}
+
+// slippage returns the fractional slippage a market order accepts
+func (e *Engine) slippage(requestedBps int) decimal.Decimal {
+	bps := e.maxSlippageBps
+	if requestedBps > 0 {
+		bps = requestedBps
+	}
+	return decimal.New(int64(bps), -4)
+}
+
+// Cost is the quote paid for quantity at price, rounded up to the quote's
+// step. Fills and reservations are both rounded this way, so an order
+// filled at its limit price spends exactly what it reserved.
+func Cost(quantity decimal.Decimal, price decimal.Decimal, step decimal.Decimal) decimal.Decimal {
+	return utils.CeilToStep(quantity.Mul(price), step)
+}
+
+// Reserved is the quote held for the unfilled part of a buy order, its
+// Cost at the limit price. Releasing the difference between successive
+// fills' reservations returns exactly what was locked.
+func Reserved(remaining decimal.Decimal, price decimal.Decimal, step decimal.Decimal) decimal.Decimal {
+	return Cost(remaining, price, step)
+}
+
+// release unlocks what a resting order still reserves: quote at its limit
+// price for a buy, base for a sell
+func release(tx *gorm.DB, step decimal.Decimal, order models.Order) error {
+	remaining := order.Quantity.Sub(order.FilledQuantity)
+	if order.Side == orderbook.Buy {
+		_, err := wallet.Adjust(tx, order.UserID, order.QuoteAssetID, decimal.Zero, Reserved(remaining, order.Price, step).Neg())
+		return err
+	}
+	_, err := wallet.Adjust(tx, order.UserID, order.AssetID, decimal.Zero, remaining.Neg())
+	return err
+}
+
+// timeInForce validates an order's time in force, expiry and post-only
+// flag, returning the time in force with its default filled in
+func timeInForce(orderType string, req models.TradeRequest) (string, error) {
+	tif := req.TimeInForce
+	if tif == "" {
+		tif = TimeInForceGTC
+		if orderType == OrderTypeMarket {
+			tif = TimeInForceIOC
+		}
+	}
+	if orderType == OrderTypeMarket && tif != TimeInForceIOC && tif != TimeInForceFOK {
+		return "", ErrInvalidTimeInForce
+	}
+	if (tif == TimeInForceGTD) != (req.ExpiresAt != nil) || (req.ExpiresAt != nil && !req.ExpiresAt.After(time.Now())) {
+		return "", ErrInvalidExpiry
+	}
+	if req.PostOnly && tif != TimeInForceGTC && tif != TimeInForceGTD {
+		return "", ErrPostOnlyNotResting
+	}
+	return tif, nil
+}
+
+// matched is the total quantity of planned fills
+func matched(fills []orderbook.Fill) decimal.Decimal {
+	total := decimal.Zero
+	for _, f := range fills {
+		total = total.Add(f.Quantity)
+	}
+	return total
+}
+
+func applyFill(order *models.Order, quantity decimal.Decimal) {
+	order.FilledQuantity = order.FilledQuantity.Add(quantity)
+	if order.FilledQuantity.GreaterThanOrEqual(order.Quantity) {
+		order.Status = StatusFilled
+	} else {
+		order.Status = StatusPartiallyFilled
+	}
+}
+
+// worstPrice is the furthest from the market price a market order may
+// fill, rounded to the tick inside the slippage bound
+func worstPrice(side string, marketPrice decimal.Decimal, slippage decimal.Decimal, tickSize decimal.Decimal) decimal.Decimal {
+	if side == orderbook.Buy {
+		return utils.FloorToStep(marketPrice.Mul(decimal.NewFromInt(1).Add(slippage)), tickSize)
+	}
+	return utils.CeilToStep(marketPrice.Mul(decimal.NewFromInt(1).Sub(slippage)), tickSize)
+}
+
+func isResting(status string) bool {
+	return status == StatusOpen || status == StatusPartiallyFilled
+}
+
+func bookOrder(order models.Order) *orderbook.Order {
+	return &orderbook.Order{
+		ID:        order.ID,
+		UserID:    order.UserID,
+		Side:      order.Side,
+		Price:     order.Price,
+		Remaining: order.Quantity.Sub(order.FilledQuantity),
+		ExpiresAt: order.ExpiresAt,
+	}
+}
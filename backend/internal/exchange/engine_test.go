@@ -0,0 +1,424 @@
+package exchange
+
+import (
+	"errors"
+	"fmt"
+	"math/rand"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Enuma3lish/LUNG_CEX/backend/internal/ledger"
+	"github.com/Enuma3lish/LUNG_CEX/backend/internal/models"
+	"github.com/Enuma3lish/LUNG_CEX/backend/internal/orderbook"
+	"github.com/Enuma3lish/LUNG_CEX/backend/internal/testdb"
+	"github.com/Enuma3lish/LUNG_CEX/backend/internal/wallet"
+	"github.com/Enuma3lish/LUNG_CEX/backend/pkg/pricefeed"
+	"github.com/google/uuid"
+	"github.com/shopspring/decimal"
+	"gorm.io/gorm"
+)
+
+func d(s string) decimal.Decimal {
+	return decimal.RequireFromString(s)
+}
+
+func newEngine(t *testing.T) (*Engine, *gorm.DB) {
+	db := testdb.Open(t)
+	return NewEngine(db, pricefeed.NewStatic(pricefeed.DefaultPrices)), db
+}
+
+func limit(market string, quantity string, price string) models.TradeRequest {
+	return models.TradeRequest{Market: market, OrderType: OrderTypeLimit, Quantity: d(quantity), Price: d(price)}
+}
+
+func checkLedger(t *testing.T, db *gorm.DB) {
+	t.Helper()
+
+	report, err := ledger.Check(db)
+	if err != nil {
+		t.Fatalf("ledger check failed: %v", err)
+	}
+	if !report.OK() {
+		t.Errorf("ledger drifted from balances: %+v", report)
+	}
+}
+
+// A buy reserves quote at its limit price; each fill must release exactly
+// that fill's share of the reservation, whatever price it filled at
+func TestSettleReleasesReservation(t *testing.T) {
+	e, db := newEngine(t)
+	userID := testdb.User(t, db)
+	p, err := e.pair("SOL-USD")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	order := models.Order{
+		UserID:       userID,
+		MarketID:     p.ID,
+		AssetID:      p.BaseAssetID,
+		QuoteAssetID: p.QuoteAssetID,
+		Side:         orderbook.Buy,
+		OrderType:    OrderTypeLimit,
+		Price:        d("101"),
+		Quantity:     d("1"),
+		Status:       StatusOpen,
+		TimeInForce:  TimeInForceGTC,
+	}
+	err = db.Transaction(func(tx *gorm.DB) error {
+		if _, err := wallet.Lock(tx, userID, p.QuoteAssetID, Reserved(order.Quantity, order.Price, p.step())); err != nil {
+			return err
+		}
+		return tx.Create(&order).Error
+	})
+	if err != nil {
+		t.Fatalf("failed to place order: %v", err)
+	}
+
+	fills := []struct {
+		quantity, price       string
+		wantSpent, wantLocked string
+	}{
+		{"0.4", "100", "40", "60.6"},
+		{"0.333", "99.99", "73.3", "26.97"}, // 0.333 * 99.99 = 33.29667 rounds up to 33.30
+		{"0.267", "100.01", "100.01", "0"},  // 26.70267 rounds up to 26.71, and the last fill releases the rest
+	}
+	for _, fill := range fills {
+		err := db.Transaction(func(tx *gorm.DB) error {
+			_, err := e.settle(tx, p, &order, d(fill.quantity), d(fill.price), LiquidityTaker, p.TakerFeeRate)
+			return err
+		})
+		if err != nil {
+			t.Fatalf("failed to settle %s @ %s: %v", fill.quantity, fill.price, err)
+		}
+
+		cash := testdb.Wallet(t, db, userID, wallet.CashSymbol)
+		if want := wallet.InitialDeposit.Sub(d(fill.wantSpent)); !cash.Balance.Equal(want) {
+			t.Errorf("after %s @ %s: balance %s, want %s", fill.quantity, fill.price, cash.Balance, want)
+		}
+		if !cash.Locked.Equal(d(fill.wantLocked)) {
+			t.Errorf("after %s @ %s: locked %s, want %s", fill.quantity, fill.price, cash.Locked, fill.wantLocked)
+		}
+	}
+	if order.Status != StatusFilled {
+		t.Errorf("order status %s, want %s", order.Status, StatusFilled)
+	}
+}
+
+// Crossing through the book fills at the maker's price, keeps the rest of
+// the taker's reservation for what rests, and cancelling returns it
+func TestPlaceOrderReleasesReservation(t *testing.T) {
+	e, db := newEngine(t)
+	maker, taker := testdb.User(t, db), testdb.User(t, db)
+	testdb.Fund(t, db, maker, "SOL", "10")
+
+	if _, err := e.PlaceOrder(maker, orderbook.Sell, limit("SOL-USD", "1", "100")); err != nil {
+		t.Fatalf("failed to place maker order: %v", err)
+	}
+	if sol := testdb.Wallet(t, db, maker, "SOL"); !sol.Locked.Equal(d("1")) {
+		t.Errorf("maker locked %s SOL, want 1", sol.Locked)
+	}
+
+	exec, err := e.PlaceOrder(taker, orderbook.Buy, limit("SOL-USD", "1.5", "101"))
+	if err != nil {
+		t.Fatalf("failed to place taker order: %v", err)
+	}
+	if len(exec.Trades) != 1 || !exec.Trades[0].Price.Equal(d("100")) || !exec.Trades[0].Quantity.Equal(d("1")) {
+		t.Fatalf("unexpected taker trades: %+v", exec.Trades)
+	}
+	if exec.Order.Status != StatusPartiallyFilled {
+		t.Errorf("taker order status %s, want %s", exec.Order.Status, StatusPartiallyFilled)
+	}
+
+	cash := testdb.Wallet(t, db, taker, wallet.CashSymbol)
+	if want := wallet.InitialDeposit.Sub(d("100")); !cash.Balance.Equal(want) {
+		t.Errorf("taker balance %s, want %s", cash.Balance, want)
+	}
+	if want := Reserved(d("0.5"), d("101"), d("0.01")); !cash.Locked.Equal(want) {
+		t.Errorf("taker locked %s, want %s for the resting half", cash.Locked, want)
+	}
+
+	sol := testdb.Wallet(t, db, maker, "SOL")
+	if !sol.Balance.Equal(d("9")) || !sol.Locked.IsZero() {
+		t.Errorf("maker SOL balance %s locked %s, want 9 and 0", sol.Balance, sol.Locked)
+	}
+	// The maker receives 100 less the 0.1% maker fee
+	if usd := testdb.Wallet(t, db, maker, wallet.CashSymbol); !usd.Balance.Equal(wallet.InitialDeposit.Add(d("99.9"))) {
+		t.Errorf("maker cash balance %s, want %s", usd.Balance, wallet.InitialDeposit.Add(d("99.9")))
+	}
+
+	if _, err := e.CancelOrder(taker, exec.Order.ID); err != nil {
+		t.Fatalf("failed to cancel: %v", err)
+	}
+	cash = testdb.Wallet(t, db, taker, wallet.CashSymbol)
+	if !cash.Locked.IsZero() || !cash.Balance.Equal(wallet.InitialDeposit.Sub(d("100"))) {
+		t.Errorf("after cancel taker balance %s locked %s, want %s and 0", cash.Balance, cash.Locked, wallet.InitialDeposit.Sub(d("100")))
+	}
+	if _, ok := e.Book("SOL-USD").Get(exec.Order.ID); ok {
+		t.Error("cancelled order is still on the book")
+	}
+
+	checkLedger(t, db)
+}
+
+// A buy filled in odd pieces at and below its limit spends what each fill
+// costs and leaves nothing locked, the reservation and the fills being
+// rounded the same way
+func TestFullFillReleasesAllLocked(t *testing.T) {
+	e, db := newEngine(t)
+	maker, taker := testdb.User(t, db), testdb.User(t, db)
+	testdb.Fund(t, db, maker, "SOL", "10")
+
+	for _, m := range []struct{ quantity, price string }{
+		{"0.333", "99.99"},  // 33.29667 costs 33.30
+		{"0.266", "100"},    // 26.60
+		{"0.401", "100.01"}, // 40.10401 costs 40.11
+	} {
+		if _, err := e.PlaceOrder(maker, orderbook.Sell, limit("SOL-USD", m.quantity, m.price)); err != nil {
+			t.Fatalf("failed to place maker order: %v", err)
+		}
+	}
+
+	exec, err := e.PlaceOrder(taker, orderbook.Buy, limit("SOL-USD", "1", "100.01"))
+	if err != nil {
+		t.Fatalf("failed to place taker order: %v", err)
+	}
+	if exec.Order.Status != StatusFilled || len(exec.Trades) != 3 {
+		t.Fatalf("taker %s with %d trades, want filled in 3", exec.Order.Status, len(exec.Trades))
+	}
+
+	spent := decimal.Zero
+	for _, trade := range exec.Trades {
+		if want := Cost(trade.Quantity, trade.Price, d("0.01")); !trade.TotalAmount.Equal(want) {
+			t.Errorf("%s @ %s cost %s, want %s", trade.Quantity, trade.Price, trade.TotalAmount, want)
+		}
+		spent = spent.Add(trade.TotalAmount)
+	}
+	cash := testdb.Wallet(t, db, taker, wallet.CashSymbol)
+	if !cash.Locked.IsZero() {
+		t.Errorf("taker locked %s after a full fill, want 0", cash.Locked)
+	}
+	if want := wallet.InitialDeposit.Sub(d("100.01")); !spent.Equal(d("100.01")) || !cash.Balance.Equal(want) {
+		t.Errorf("taker spent %s leaving %s, want 100.01 leaving %s", spent, cash.Balance, want)
+	}
+
+	checkLedger(t, db)
+}
+
+// A GTD maker whose expiry passed before the sweeper reached it is expired
+// by the taker that would have matched it, which trades with the next
+// maker instead
+func TestExpiredMakerDoesNotTrade(t *testing.T) {
+	e, db := newEngine(t)
+	stale, live, taker := testdb.User(t, db), testdb.User(t, db), testdb.User(t, db)
+	testdb.Fund(t, db, stale, "SOL", "10")
+	testdb.Fund(t, db, live, "SOL", "10")
+
+	gtd := limit("SOL-USD", "1", "100")
+	gtd.TimeInForce = TimeInForceGTD
+	expiresAt := time.Now().Add(time.Hour)
+	gtd.ExpiresAt = &expiresAt
+	expiring, err := e.PlaceOrder(stale, orderbook.Sell, gtd)
+	if err != nil {
+		t.Fatalf("failed to place GTD order: %v", err)
+	}
+	if _, err := e.PlaceOrder(live, orderbook.Sell, limit("SOL-USD", "1", "101")); err != nil {
+		t.Fatalf("failed to place maker order: %v", err)
+	}
+
+	// Let the GTD order's expiry pass without a sweep
+	past := time.Now().Add(-time.Second)
+	if err := db.Model(&models.Order{}).Where("id = ?", expiring.Order.ID).Update("expires_at", past).Error; err != nil {
+		t.Fatal(err)
+	}
+	resting, _ := e.Book("SOL-USD").Get(expiring.Order.ID)
+	resting.ExpiresAt = &past
+
+	exec, err := e.PlaceOrder(taker, orderbook.Buy, limit("SOL-USD", "1", "101"))
+	if err != nil {
+		t.Fatalf("failed to place taker order: %v", err)
+	}
+	if len(exec.Trades) != 1 || !exec.Trades[0].Price.Equal(d("101")) {
+		t.Fatalf("taker trades %+v, want one fill at the live maker's 101", exec.Trades)
+	}
+
+	var order models.Order
+	if err := db.First(&order, "id = ?", expiring.Order.ID).Error; err != nil {
+		t.Fatal(err)
+	}
+	if order.Status != StatusExpired || !order.FilledQuantity.IsZero() {
+		t.Errorf("stale order %s with %s filled, want %s and nothing", order.Status, order.FilledQuantity, StatusExpired)
+	}
+	if sol := testdb.Wallet(t, db, stale, "SOL"); !sol.Balance.Equal(d("10")) || !sol.Locked.IsZero() {
+		t.Errorf("stale maker SOL balance %s locked %s, want 10 and 0", sol.Balance, sol.Locked)
+	}
+	if _, ok := e.Book("SOL-USD").Get(expiring.Order.ID); ok {
+		t.Error("expired order is still on the book")
+	}
+
+	checkLedger(t, db)
+}
+
+// An order that reaches its own user's resting order cancels it rather
+// than trading with it, and fills against the next maker
+func TestSelfTradePrevented(t *testing.T) {
+	e, db := newEngine(t)
+	trader, other := testdb.User(t, db), testdb.User(t, db)
+	testdb.Fund(t, db, trader, "SOL", "10")
+	testdb.Fund(t, db, other, "SOL", "10")
+
+	own, err := e.PlaceOrder(trader, orderbook.Sell, limit("SOL-USD", "1", "100"))
+	if err != nil {
+		t.Fatalf("failed to place own order: %v", err)
+	}
+	if _, err := e.PlaceOrder(other, orderbook.Sell, limit("SOL-USD", "1", "101")); err != nil {
+		t.Fatalf("failed to place maker order: %v", err)
+	}
+
+	exec, err := e.PlaceOrder(trader, orderbook.Buy, limit("SOL-USD", "1", "101"))
+	if err != nil {
+		t.Fatalf("failed to place taker order: %v", err)
+	}
+	if len(exec.Trades) != 1 || !exec.Trades[0].Price.Equal(d("101")) || exec.Order.Status != StatusFilled {
+		t.Fatalf("taker %s with trades %+v, want filled once at the other maker's 101", exec.Order.Status, exec.Trades)
+	}
+	for _, trade := range exec.MakerTrades {
+		if trade.UserID == trader {
+			t.Errorf("trader was the maker of %+v", trade)
+		}
+	}
+
+	var order models.Order
+	if err := db.First(&order, "id = ?", own.Order.ID).Error; err != nil {
+		t.Fatal(err)
+	}
+	if order.Status != StatusCancelled || !order.FilledQuantity.IsZero() {
+		t.Errorf("own order %s with %s filled, want %s and nothing", order.Status, order.FilledQuantity, StatusCancelled)
+	}
+	if _, ok := e.Book("SOL-USD").Get(own.Order.ID); ok {
+		t.Error("cancelled own order is still on the book")
+	}
+
+	// The 1 SOL bought arrives less the 0.2% taker fee, and the cancelled
+	// sell no longer holds any
+	sol := testdb.Wallet(t, db, trader, "SOL")
+	if !sol.Balance.Equal(d("10.998")) || !sol.Locked.IsZero() {
+		t.Errorf("trader SOL balance %s locked %s, want 10.998 and 0", sol.Balance, sol.Locked)
+	}
+	if cash := testdb.Wallet(t, db, trader, wallet.CashSymbol); !cash.Locked.IsZero() {
+		t.Errorf("trader cash locked %s after a full fill, want 0", cash.Locked)
+	}
+
+	checkLedger(t, db)
+}
+
+// Many traders placing and cancelling crossing orders on shared wallets at
+// once must never overdraw a wallet or let balances drift from the ledger
+func TestConcurrentOrders(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping concurrency test in short mode")
+	}
+	e, db := newEngine(t)
+
+	const (
+		traders = 8
+		workers = 24
+		orders  = 600
+	)
+	markets := []string{"SOL-USD", "SOL-USDC"}
+	users := make([]uuid.UUID, traders)
+	for i := range users {
+		users[i] = testdb.User(t, db)
+		testdb.Fund(t, db, users[i], "SOL", "40")
+		testdb.Fund(t, db, users[i], "USDC", "4000")
+	}
+
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func(seed int64) {
+			defer wg.Done()
+			rng := rand.New(rand.NewSource(seed))
+			for range jobs {
+				userID := users[rng.Intn(len(users))]
+				market := markets[rng.Intn(len(markets))]
+
+				// Cancel now and then, so releases race with fills
+				if rng.Intn(20) == 0 {
+					if _, err := e.CancelAll(userID, market); err != nil {
+						t.Errorf("failed to cancel orders on %s: %v", market, err)
+					}
+					continue
+				}
+
+				side := orderbook.Buy
+				if rng.Intn(2) == 0 {
+					side = orderbook.Sell
+				}
+				// Prices straddle 100 so most orders cross something
+				req := limit(market,
+					decimal.New(int64(rng.Intn(30)+10), -1).String(),
+					decimal.New(int64(9990+rng.Intn(21)), -2).String())
+				switch rng.Intn(10) {
+				case 0:
+					req.OrderType, req.Price = OrderTypeMarket, decimal.Zero
+				case 1:
+					req.TimeInForce = TimeInForceIOC
+				}
+
+				_, err := e.PlaceOrder(userID, side, req)
+				if err != nil && !errors.Is(err, ErrInsufficientBalance) &&
+					!errors.Is(err, ErrInsufficientQuantity) && !errors.Is(err, ErrNoHolding) {
+					t.Errorf("failed to place %s %s %s @ %s: %v", side, req.Quantity, market, req.Price, err)
+				}
+			}
+		}(int64(w))
+	}
+	for i := 0; i < orders; i++ {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+
+	var trades int64
+	if err := db.Model(&models.Trade{}).Count(&trades).Error; err != nil {
+		t.Fatal(err)
+	}
+	if trades == 0 {
+		t.Fatal("no orders matched")
+	}
+
+	// What each wallet has locked is exactly what its resting orders reserve
+	var resting []models.Order
+	if err := db.Preload("QuoteAsset").Where("status IN ?", []string{StatusOpen, StatusPartiallyFilled}).Find(&resting).Error; err != nil {
+		t.Fatal(err)
+	}
+	reserved := make(map[string]decimal.Decimal)
+	for _, order := range resting {
+		remaining := order.Quantity.Sub(order.FilledQuantity)
+		if order.Side == orderbook.Buy {
+			key := fmt.Sprintf("%s/%s", order.UserID, order.QuoteAssetID)
+			reserved[key] = reserved[key].Add(Reserved(remaining, order.Price, order.QuoteAsset.LotSize))
+		} else {
+			key := fmt.Sprintf("%s/%s", order.UserID, order.AssetID)
+			reserved[key] = reserved[key].Add(remaining)
+		}
+	}
+
+	var wallets []models.Wallet
+	if err := db.Find(&wallets).Error; err != nil {
+		t.Fatal(err)
+	}
+	for _, w := range wallets {
+		if w.Locked.IsNegative() || w.Balance.LessThan(w.Locked) {
+			t.Errorf("wallet %s of user %s has balance %s and locked %s", w.AssetID, w.UserID, w.Balance, w.Locked)
+		}
+		if want := reserved[fmt.Sprintf("%s/%s", w.UserID, w.AssetID)]; !w.Locked.Equal(want) {
+			t.Errorf("wallet %s of user %s locks %s, but its resting orders reserve %s", w.AssetID, w.UserID, w.Locked, want)
+		}
+	}
+
+	checkLedger(t, db)
+}
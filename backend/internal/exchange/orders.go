@@ -0,0 +1,219 @@
+package exchange
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/Enuma3lish/LUNG_CEX/backend/internal/models"
+	"github.com/Enuma3lish/LUNG_CEX/backend/internal/orderbook"
+	"github.com/Enuma3lish/LUNG_CEX/backend/internal/wallet"
+	"github.com/Enuma3lish/LUNG_CEX/backend/pkg/utils"
+	"github.com/google/uuid"
+	"github.com/shopspring/decimal"
+)
+
+// CancelOrder cancels one of a user's resting orders
+func (e *Engine) CancelOrder(userID uuid.UUID, id uuid.UUID) (models.Order, error) {
+	var count int64
+	if err := e.db.Model(&models.Order{}).Where("id = ? AND user_id = ?", id, userID).Count(&count).Error; err != nil {
+		return models.Order{}, fmt.Errorf("failed to find order: %w", err)
+	}
+	if count == 0 {
+		return models.Order{}, ErrOrderNotFound
+	}
+	return e.closeOrder(id, StatusCancelled)
+}
+
+// CancelAll cancels a user's resting orders, only on one market when
+// symbol is given, and returns the orders it cancelled
+func (e *Engine) CancelAll(userID uuid.UUID, symbol string) ([]models.Order, error) {
+	query := e.db.Model(&models.Order{}).Where("user_id = ? AND status IN ?", userID, []string{StatusOpen, StatusPartiallyFilled})
+	if symbol != "" {
+		var market models.Market
+		if err := e.db.Where("symbol = ?", symbol).First(&market).Error; err != nil {
+			return nil, ErrMarketNotFound
+		}
+		query = query.Where("market_id = ?", market.ID)
+	}
+
+	var ids []uuid.UUID
+	if err := query.Order("created_at ASC").Pluck("id", &ids).Error; err != nil {
+		return nil, fmt.Errorf("failed to fetch open orders: %w", err)
+	}
+
+	cancelled := []models.Order{}
+	for _, id := range ids {
+		order, err := e.closeOrder(id, StatusCancelled)
+		if err != nil {
+			// Filled since it was fetched
+			if errors.Is(err, ErrOrderNotOpen) {
+				continue
+			}
+			return cancelled, err
+		}
+		cancelled = append(cancelled, order)
+	}
+	return cancelled, nil
+}
+
+// AmendOrder changes a resting order's limit price or total quantity and
+// adjusts its reservation to match. Reducing the quantity at the same
+// price keeps the order's place in the queue; any other change sends it
+// to the back of its price level. An amended order never matches, so a
+// price that would cross the book is rejected.
+func (e *Engine) AmendOrder(userID uuid.UUID, id uuid.UUID, req models.AmendOrderRequest) (models.Order, error) {
+	var order models.Order
+	if err := e.db.Preload("Market.QuoteAsset").Where("id = ? AND user_id = ?", id, userID).First(&order).Error; err != nil {
+		return models.Order{}, ErrOrderNotFound
+	}
+	market := order.Market
+	if market.Status != MarketActive {
+		return models.Order{}, ErrMarketHalted
+	}
+
+	book := e.Book(market.Symbol)
+	book.Lock()
+	defer book.Unlock()
+
+	// Fills happen under the book lock, so re-read the order now that no
+	// more can land
+	tx := e.db.Begin()
+	if err := tx.First(&order, "id = ?", id).Error; err != nil {
+		tx.Rollback()
+		return models.Order{}, ErrOrderNotFound
+	}
+	if !isResting(order.Status) {
+		tx.Rollback()
+		return models.Order{}, ErrOrderNotOpen
+	}
+
+	price, quantity := order.Price, order.Quantity
+	if !req.Price.IsZero() {
+		price = req.Price
+	}
+	if !req.Quantity.IsZero() {
+		quantity = req.Quantity
+	}
+	if err := validateAmend(market, order, price, quantity); err != nil {
+		tx.Rollback()
+		return models.Order{}, err
+	}
+	remaining := quantity.Sub(order.FilledQuantity)
+	if len(book.Match(order.Side, price, remaining)) > 0 {
+		tx.Rollback()
+		return models.Order{}, ErrAmendWouldCross
+	}
+
+	// Move the reservation by the difference between what the order held
+	// and what it needs now
+	step := market.QuoteAsset.LotSize
+	held := order.Quantity.Sub(order.FilledQuantity)
+	reserveAsset, delta := order.AssetID, remaining.Sub(held)
+	if order.Side == orderbook.Buy {
+		reserveAsset, delta = order.QuoteAssetID, Reserved(remaining, price, step).Sub(Reserved(held, order.Price, step))
+	}
+	if _, err := wallet.Adjust(tx, order.UserID, reserveAsset, decimal.Zero, delta); err != nil {
+		tx.Rollback()
+		if errors.Is(err, wallet.ErrInsufficientBalance) {
+			if order.Side == orderbook.Buy {
+				return models.Order{}, ErrInsufficientBalance
+			}
+			return models.Order{}, ErrInsufficientQuantity
+		}
+		return models.Order{}, err
+	}
+
+	keepsPriority := price.Equal(order.Price) && quantity.LessThan(order.Quantity)
+	order.Price = price
+	order.Quantity = quantity
+	if !keepsPriority {
+		now := time.Now()
+		order.RequeuedAt = &now
+	}
+	if err := tx.Model(&order).Updates(map[string]interface{}{
+		"price":       order.Price,
+		"quantity":    order.Quantity,
+		"requeued_at": order.RequeuedAt,
+	}).Error; err != nil {
+		tx.Rollback()
+		return models.Order{}, fmt.Errorf("failed to update order: %w", err)
+	}
+	if err := tx.Commit().Error; err != nil {
+		return models.Order{}, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	if keepsPriority {
+		book.Resize(order.ID, remaining)
+	} else {
+		book.Remove(order.ID)
+		book.Add(bookOrder(order))
+	}
+
+	order.Market = market
+	return order, nil
+}
+
+// validateAmend checks an order's amended price and quantity against its
+// market's rules and what has already filled
+func validateAmend(market models.Market, order models.Order, price decimal.Decimal, quantity decimal.Decimal) error {
+	if price.Equal(order.Price) && quantity.Equal(order.Quantity) {
+		return ErrNothingToAmend
+	}
+	if !price.IsPositive() || !utils.IsMultiple(price, market.TickSize) {
+		return ErrInvalidPrice
+	}
+	if !quantity.IsPositive() || !utils.IsMultiple(quantity, market.LotSize) {
+		return ErrInvalidQuantity
+	}
+	if !quantity.GreaterThan(order.FilledQuantity) {
+		return ErrAmendBelowFilled
+	}
+	if price.Mul(quantity).LessThan(market.MinNotional) {
+		return ErrBelowMinNotional
+	}
+	return nil
+}
+
+// closeOrder takes a resting order off its book, releases the funds it
+// still reserves and records status as why it stopped working
+func (e *Engine) closeOrder(id uuid.UUID, status string) (models.Order, error) {
+	var order models.Order
+	if err := e.db.Preload("Market.QuoteAsset").First(&order, "id = ?", id).Error; err != nil {
+		return models.Order{}, ErrOrderNotFound
+	}
+	market := order.Market
+
+	book := e.Book(market.Symbol)
+	book.Lock()
+	defer book.Unlock()
+
+	// Fills happen under the book lock, so re-read the order now that no
+	// more can land
+	tx := e.db.Begin()
+	if err := tx.First(&order, "id = ?", id).Error; err != nil {
+		tx.Rollback()
+		return models.Order{}, ErrOrderNotFound
+	}
+	if !isResting(order.Status) {
+		tx.Rollback()
+		return models.Order{}, ErrOrderNotOpen
+	}
+
+	if err := release(tx, market.QuoteAsset.LotSize, order); err != nil {
+		tx.Rollback()
+		return models.Order{}, err
+	}
+	order.Status = status
+	if err := tx.Model(&order).Update("status", status).Error; err != nil {
+		tx.Rollback()
+		return models.Order{}, fmt.Errorf("failed to update order: %w", err)
+	}
+	if err := tx.Commit().Error; err != nil {
+		return models.Order{}, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	book.Remove(order.ID)
+	order.Market = market
+	return order, nil
+}
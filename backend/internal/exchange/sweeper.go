@@ -0,0 +1,77 @@
+package exchange
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"github.com/Enuma3lish/LUNG_CEX/backend/internal/models"
+	"github.com/google/uuid"
+)
+
+const defaultSweepInterval = time.Second
+
+// Sweeper periodically expires good-till-date orders whose expiry has
+// passed, taking them off the book and releasing their reserved funds.
+// Matching never trades with an expired order either, expiring any it
+// reaches first, so the sweep only decides how soon the funds come back.
+type Sweeper struct {
+	engine   *Engine
+	interval time.Duration
+}
+
+func NewSweeper(engine *Engine) *Sweeper {
+	interval := defaultSweepInterval
+	if v, err := time.ParseDuration(os.Getenv("ORDER_EXPIRY_INTERVAL")); err == nil && v > 0 {
+		interval = v
+	}
+
+	return &Sweeper{engine: engine, interval: interval}
+}
+
+// Run expires orders on every tick until ctx is cancelled
+func (s *Sweeper) Run(ctx context.Context) {
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+
+	log.Printf("Order expiry sweeper started (interval %s)", s.interval)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if _, err := s.RunOnce(); err != nil {
+				log.Printf("Warning: Order expiry run failed: %v", err)
+			}
+		}
+	}
+}
+
+// RunOnce expires every resting GTD order past its expiry, returning how
+// many were expired
+func (s *Sweeper) RunOnce() (int, error) {
+	var ids []uuid.UUID
+	if err := s.engine.db.Model(&models.Order{}).
+		Where("status IN ? AND time_in_force = ? AND expires_at <= ?",
+			[]string{StatusOpen, StatusPartiallyFilled}, TimeInForceGTD, time.Now()).
+		Pluck("id", &ids).Error; err != nil {
+		return 0, fmt.Errorf("failed to fetch expired orders: %w", err)
+	}
+
+	expired := 0
+	for _, id := range ids {
+		if _, err := s.engine.closeOrder(id, StatusExpired); err != nil {
+			// Filled or cancelled since it was fetched
+			if errors.Is(err, ErrOrderNotOpen) {
+				continue
+			}
+			return expired, err
+		}
+		expired++
+	}
+	return expired, nil
+}
@@ -0,0 +1,80 @@
+package fees
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/Enuma3lish/LUNG_CEX/backend/internal/models"
+	"github.com/Enuma3lish/LUNG_CEX/backend/pkg/pricefeed"
+	"github.com/Enuma3lish/LUNG_CEX/backend/pkg/utils"
+	"github.com/google/uuid"
+	"github.com/shopspring/decimal"
+	"gorm.io/gorm"
+)
+
+// VolumeWindow is how far back a user's trading volume counts toward
+// their tier
+const VolumeWindow = 30 * 24 * time.Hour
+
+// Tiers are ordered by volume; a user is in the highest tier they reach
+var Tiers = []models.FeeTier{
+	{Level: 0, MinVolume: decimal.Zero, Discount: decimal.Zero},
+	{Level: 1, MinVolume: decimal.NewFromInt(50000), Discount: decimal.RequireFromString("0.1")},
+	{Level: 2, MinVolume: decimal.NewFromInt(250000), Discount: decimal.RequireFromString("0.2")},
+	{Level: 3, MinVolume: decimal.NewFromInt(1000000), Discount: decimal.RequireFromString("0.3")},
+	{Level: 4, MinVolume: decimal.NewFromInt(5000000), Discount: decimal.RequireFromString("0.5")},
+}
+
+// TierFor returns the tier a volume qualifies for, and the next tier up
+// if there is one
+func TierFor(volume decimal.Decimal) (models.FeeTier, *models.FeeTier) {
+	current := Tiers[0]
+	for i, tier := range Tiers {
+		if volume.LessThan(tier.MinVolume) {
+			next := Tiers[i]
+			return current, &next
+		}
+		current = tier
+	}
+	return current, nil
+}
+
+// quoteVolume is a user's traded amount in one quote asset
+type quoteVolume struct {
+	Symbol string
+	Total  decimal.Decimal
+}
+
+// Volume is a user's trading volume in USD over the trailing window.
+// Amounts in other quote assets are valued at the quote's current price.
+func Volume(db *gorm.DB, feed pricefeed.PriceFeed, userID uuid.UUID) (decimal.Decimal, error) {
+	var volumes []quoteVolume
+	if err := db.Model(&models.Trade{}).
+		Select("assets.symbol, SUM(trades.total_amount) AS total").
+		Joins("JOIN assets ON assets.id = trades.quote_asset_id").
+		Where("trades.user_id = ? AND trades.created_at >= ?", userID, time.Now().Add(-VolumeWindow)).
+		Group("assets.symbol").
+		Scan(&volumes).Error; err != nil {
+		return decimal.Zero, fmt.Errorf("failed to sum trading volume: %w", err)
+	}
+
+	total := decimal.Zero
+	for _, v := range volumes {
+		price, err := pricefeed.USDPrice(feed, v.Symbol)
+		if err != nil {
+			return decimal.Zero, err
+		}
+		total = total.Add(v.Total.Mul(decimal.NewFromFloat(price)))
+	}
+	return utils.RoundCents(total), nil
+}
+
+// UserTier looks up the tier a user's trailing volume earns
+func UserTier(db *gorm.DB, feed pricefeed.PriceFeed, userID uuid.UUID) (models.FeeTier, error) {
+	volume, err := Volume(db, feed, userID)
+	if err != nil {
+		return models.FeeTier{}, err
+	}
+	tier, _ := TierFor(volume)
+	return tier, nil
+}
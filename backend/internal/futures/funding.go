@@ -0,0 +1,293 @@
+package futures
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/Enuma3lish/LUNG_CEX/backend/internal/ledger"
+	"github.com/Enuma3lish/LUNG_CEX/backend/internal/models"
+	"github.com/Enuma3lish/LUNG_CEX/backend/internal/wallet"
+	"github.com/Enuma3lish/LUNG_CEX/backend/pkg/pricefeed"
+	"github.com/Enuma3lish/LUNG_CEX/backend/pkg/utils"
+	"github.com/google/uuid"
+	"github.com/shopspring/decimal"
+	"gorm.io/gorm"
+)
+
+const defaultFundingInterval = 8 * time.Hour
+
+var defaultFundingRateCap = decimal.RequireFromString("0.0075")
+
+// fundingRatePlaces matches the precision funding rates are stored with
+const fundingRatePlaces = 8
+
+// errMarginExhausted is returned for a position whose funding payment used
+// up its margin
+var errMarginExhausted = errors.New("funding payment exhausted the position's margin")
+
+// Funder periodically computes each perpetual's funding rate from its
+// premium over the spot index and exchanges payments between longs and
+// shorts. A positive rate means longs pay shorts.
+//
+// Payments come out of a position's isolated margin only. Unrealized
+// profit isn't collateral until the position closes, so a position whose
+// margin can't cover a payment pays all the margin it has and is then
+// liquidated at the mark price with none left, even when its equity could
+// have covered the rest.
+type Funder struct {
+	db         *gorm.DB
+	priceFeed  pricefeed.PriceFeed
+	liquidator *Liquidator
+	interval   time.Duration
+	rateCap    decimal.Decimal
+	listeners  []PositionListener
+}
+
+func NewFunder(db *gorm.DB, priceFeed pricefeed.PriceFeed, liquidator *Liquidator) *Funder {
+	interval := defaultFundingInterval
+	if v, err := time.ParseDuration(os.Getenv("FUNDING_INTERVAL")); err == nil && v > 0 {
+		interval = v
+	}
+
+	rateCap := defaultFundingRateCap
+	if v, err := decimal.NewFromString(os.Getenv("FUNDING_RATE_CAP")); err == nil && v.IsPositive() {
+		rateCap = v
+	}
+
+	return &Funder{
+		db:         db,
+		priceFeed:  priceFeed,
+		liquidator: liquidator,
+		interval:   interval,
+		rateCap:    rateCap,
+	}
+}
+
+// OnFunding registers a listener for positions whose margin changed with
+// a funding payment. Register listeners before calling Run.
+func (f *Funder) OnFunding(listener PositionListener) {
+	f.listeners = append(f.listeners, listener)
+}
+
+// IndexSymbol returns the spot symbol a perpetual tracks, e.g. BTC for BTC-PERP
+func IndexSymbol(perpSymbol string) string {
+	return strings.TrimSuffix(perpSymbol, "-PERP")
+}
+
+// FundingRate is the premium of mark over index, clamped to the rate cap
+func (f *Funder) FundingRate(markPrice decimal.Decimal, indexPrice decimal.Decimal) decimal.Decimal {
+	premium := markPrice.Sub(indexPrice).Div(indexPrice).Round(fundingRatePlaces)
+	return decimal.Max(f.rateCap.Neg(), decimal.Min(f.rateCap, premium))
+}
+
+// Run applies funding at every interval boundary until ctx is cancelled.
+// The schedule follows the last recorded rate rather than process start,
+// so a restart neither repeats nor skips a funding period.
+func (f *Funder) Run(ctx context.Context) {
+	log.Printf("Funding engine started (interval %s, rate cap %s)", f.interval, f.rateCap)
+
+	for {
+		timer := time.NewTimer(time.Until(f.nextRun(time.Now())))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+			if err := f.RunOnce(); err != nil {
+				log.Printf("Warning: Funding run failed: %v", err)
+			}
+		}
+	}
+}
+
+// nextRun is the first interval boundary after the last recorded funding
+// rate, which is in the past if a boundary passed while the server was
+// down. Boundaries are aligned to the Unix epoch, so an 8h interval funds
+// at 00:00, 08:00 and 16:00 UTC.
+func (f *Funder) nextRun(now time.Time) time.Time {
+	var last models.FundingRate
+	result := f.db.Order("created_at DESC").Limit(1).Find(&last)
+	if result.Error != nil {
+		log.Printf("Warning: Failed to fetch the last funding rate: %v", result.Error)
+	}
+	if result.Error != nil || result.RowsAffected == 0 {
+		return now.Truncate(f.interval).Add(f.interval)
+	}
+	return last.CreatedAt.Truncate(f.interval).Add(f.interval)
+}
+
+// RunOnce records a funding rate for every perpetual and settles payments
+// for its open positions. A perpetual that fails is logged and skipped, so
+// it can't hold up funding for the rest.
+func (f *Funder) RunOnce() error {
+	var assets []models.Asset
+	if err := f.db.Where("asset_type = ?", "FUTURES").Find(&assets).Error; err != nil {
+		return fmt.Errorf("failed to fetch futures assets: %w", err)
+	}
+
+	failed := 0
+	for _, asset := range assets {
+		if err := f.fund(asset); err != nil {
+			log.Printf("Warning: Funding %s failed: %v", asset.Symbol, err)
+			failed++
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("funding failed for %d of %d perpetuals", failed, len(assets))
+	}
+	return nil
+}
+
+func (f *Funder) fund(asset models.Asset) error {
+	markQuote, err := f.priceFeed.Price(asset.Symbol)
+	if err != nil {
+		return fmt.Errorf("no mark price for %s: %w", asset.Symbol, err)
+	}
+	indexQuote, err := f.priceFeed.Price(IndexSymbol(asset.Symbol))
+	if err != nil {
+		return fmt.Errorf("no index price for %s: %w", asset.Symbol, err)
+	}
+	markPrice, indexPrice := utils.FeedPrice(markQuote, asset.TickSize), utils.FeedPrice(indexQuote, asset.TickSize)
+
+	rate := models.FundingRate{
+		AssetID:    asset.ID,
+		Rate:       f.FundingRate(markPrice, indexPrice),
+		MarkPrice:  markPrice,
+		IndexPrice: indexPrice,
+	}
+	if err := f.db.Create(&rate).Error; err != nil {
+		return fmt.Errorf("failed to record funding rate: %w", err)
+	}
+
+	var ids []uuid.UUID
+	if err := f.db.Model(&models.FuturesPosition{}).
+		Where("asset_id = ? AND status = ?", asset.ID, StatusOpen).
+		Order("user_id ASC").
+		Pluck("id", &ids).Error; err != nil {
+		return fmt.Errorf("failed to fetch open positions: %w", err)
+	}
+
+	// Each position is paid in its own transaction, so one that fails
+	// doesn't roll back the others
+	var funded []models.FuturesPosition
+	failed := 0
+	for _, id := range ids {
+		position, err := fundPosition(f.db, id, rate)
+		switch {
+		case errors.Is(err, ErrPositionNotOpen):
+			// Closed since the positions were listed
+		case errors.Is(err, errMarginExhausted):
+			position.Asset = asset
+			f.exhausted(position, markPrice)
+		case err != nil:
+			log.Printf("Warning: Failed to fund position %s: %v", id, err)
+			failed++
+		default:
+			funded = append(funded, position)
+		}
+	}
+
+	log.Printf("Funding %s: rate %s (mark %s, index %s), %d positions", asset.Symbol, rate.Rate, markPrice, indexPrice, len(funded))
+	for _, position := range funded {
+		for _, listener := range f.listeners {
+			listener(position)
+		}
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("failed to fund %d of %d positions", failed, len(ids))
+	}
+	return nil
+}
+
+// exhausted hands a position whose funding payment used up its margin to
+// the liquidator, closing it at the mark price without the maintenance
+// check. A position in profit still realizes its gains.
+func (f *Funder) exhausted(position models.FuturesPosition, markPrice decimal.Decimal) {
+	if f.liquidator == nil {
+		log.Printf("Warning: Position %s can't cover its funding payment and no liquidator is set", position.ID)
+		return
+	}
+	if _, err := f.liquidator.liquidate(position, markPrice, true); err != nil && !errors.Is(err, ErrPositionNotOpen) {
+		log.Printf("Warning: Failed to liquidate position %s after its margin ran out: %v", position.ID, err)
+	}
+}
+
+// fundPosition moves a position's funding payment into or out of its
+// isolated margin, and the owner's cash wallet with it. The position is
+// locked first, so a close, liquidation or trigger can't settle it
+// between the read and the payment. A payment the margin can't cover
+// takes the whole margin instead, and errMarginExhausted is returned once
+// that payment is committed. It returns ErrPositionNotOpen if the position
+// has closed.
+func fundPosition(db *gorm.DB, id uuid.UUID, rate models.FundingRate) (models.FuturesPosition, error) {
+	var position models.FuturesPosition
+	exhausted := false
+	err := db.Transaction(func(tx *gorm.DB) error {
+		var err error
+		if position, err = Lock(tx, id); err != nil {
+			return err
+		}
+
+		amount := utils.RoundCents(rate.Rate.Mul(position.Quantity).Mul(rate.MarkPrice))
+		if position.PositionType == Long {
+			amount = amount.Neg()
+		}
+		if amount.IsZero() {
+			return nil
+		}
+		if !position.Margin.Add(amount).IsPositive() {
+			amount = position.Margin.Neg()
+			exhausted = true
+		}
+
+		result := tx.Model(&models.FuturesPosition{}).
+			Where("id = ? AND status = ?", position.ID, StatusOpen).
+			Update("margin", gorm.Expr("margin + ?", amount))
+		if result.Error != nil {
+			return fmt.Errorf("failed to update position margin: %w", result.Error)
+		}
+		if result.RowsAffected == 0 {
+			return ErrPositionNotOpen
+		}
+		position.Margin = position.Margin.Add(amount)
+
+		cash, err := wallet.CashAsset(tx)
+		if err != nil {
+			return err
+		}
+		if _, err := wallet.Adjust(tx, position.UserID, cash.ID, amount, amount); err != nil {
+			return fmt.Errorf("failed to apply funding to position %s: %w", position.ID, err)
+		}
+
+		payment := models.FundingPayment{
+			UserID:        position.UserID,
+			PositionID:    position.ID,
+			AssetID:       position.AssetID,
+			FundingRateID: rate.ID,
+			Rate:          rate.Rate,
+			Amount:        amount,
+		}
+		if err := tx.Create(&payment).Error; err != nil {
+			return fmt.Errorf("failed to record funding payment: %w", err)
+		}
+
+		if _, err := ledger.Post(tx, ledger.EntryFunding, payment.ID.String(),
+			fmt.Sprintf("Funding at rate %s", rate.Rate),
+			ledger.Wallet(position.UserID, cash.Symbol, amount),
+			ledger.Platform(ledger.AccountFunding, cash.Symbol, amount.Neg()),
+		); err != nil {
+			return err
+		}
+		return nil
+	})
+	if err == nil && exhausted {
+		err = errMarginExhausted
+	}
+	return position, err
+}
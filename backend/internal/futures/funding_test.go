@@ -0,0 +1,224 @@
+package futures
+
+import (
+	"testing"
+	"time"
+
+	"github.com/Enuma3lish/LUNG_CEX/backend/internal/models"
+	"github.com/Enuma3lish/LUNG_CEX/backend/internal/testdb"
+	"github.com/Enuma3lish/LUNG_CEX/backend/internal/wallet"
+	"github.com/Enuma3lish/LUNG_CEX/backend/pkg/pricefeed"
+	"gorm.io/gorm"
+)
+
+func TestFundingRate(t *testing.T) {
+	f := NewFunder(nil, nil, nil)
+	tests := []struct {
+		mark, index string
+		want        string
+	}{
+		{"100", "100", "0"},
+		{"100.5", "100", "0.005"},
+		{"99.9", "100", "-0.001"},
+		{"102", "100", "0.0075"}, // clamped to the cap
+		{"90", "100", "-0.0075"},
+		{"100.01", "300", "-0.0075"},
+	}
+	for _, tt := range tests {
+		if got := f.FundingRate(d(tt.mark), d(tt.index)); !got.Equal(d(tt.want)) {
+			t.Errorf("mark %s index %s: rate %s, want %s", tt.mark, tt.index, got, tt.want)
+		}
+	}
+
+	t.Setenv("FUNDING_RATE_CAP", "0.001")
+	if got := NewFunder(nil, nil, nil).FundingRate(d("100.5"), d("100")); !got.Equal(d("0.001")) {
+		t.Errorf("rate with FUNDING_RATE_CAP=0.001 is %s, want 0.001", got)
+	}
+}
+
+// Longs pay shorts while the perpetual trades above its index, and shorts
+// pay longs below it
+func TestFundingPayments(t *testing.T) {
+	db := testdb.Open(t)
+	feed := pricefeed.NewStatic(pricefeed.DefaultPrices)
+	f := NewFunder(db, feed, NewLiquidator(db, feed))
+	var notified int
+	f.OnFunding(func(models.FuturesPosition) {
+		notified++
+	})
+
+	long := openPosition(t, db, feed, testdb.User(t, db), "SOL-PERP", Long, "10", 10)
+	short := openPosition(t, db, feed, testdb.User(t, db), "SOL-PERP", Short, "10", 10)
+
+	// 2% over the index clamps to 0.75%, on 10 * 102 of position value
+	rounds := []struct {
+		mark      string
+		rate      string
+		longPaid  string // cumulative, negative when the long received
+		shortPaid string
+	}{
+		{"102", "0.0075", "7.65", "-7.65"},
+		{"99", "-0.0075", "6.91", "-6.91"}, // 0.0075 * 10 * 99 = 0.7425 back to the long
+	}
+	for _, round := range rounds {
+		setPrice(feed, "SOL-PERP", round.mark)
+		if err := f.RunOnce(); err != nil {
+			t.Fatalf("funding at %s failed: %v", round.mark, err)
+		}
+
+		var rate models.FundingRate
+		if err := db.Where("asset_id = ?", long.AssetID).Order("created_at DESC").First(&rate).Error; err != nil {
+			t.Fatalf("no funding rate recorded: %v", err)
+		}
+		if !rate.Rate.Equal(d(round.rate)) || !rate.MarkPrice.Equal(d(round.mark)) || !rate.IndexPrice.Equal(d("100")) {
+			t.Errorf("recorded rate %s at mark %s index %s, want %s at %s and 100", rate.Rate, rate.MarkPrice, rate.IndexPrice, round.rate, round.mark)
+		}
+
+		for _, side := range []struct {
+			position models.FuturesPosition
+			paid     string
+		}{{long, round.longPaid}, {short, round.shortPaid}} {
+			position := reload(t, db, side.position)
+			want := d("100").Sub(d(side.paid))
+			if !position.Margin.Equal(want) {
+				t.Errorf("at %s %s margin %s, want %s", round.mark, position.PositionType, position.Margin, want)
+			}
+			cash := testdb.Wallet(t, db, position.UserID, wallet.CashSymbol)
+			if !cash.Locked.Equal(want) || !cash.Balance.Equal(wallet.InitialDeposit.Sub(d(side.paid))) {
+				t.Errorf("at %s %s cash balance %s locked %s, want %s and %s", round.mark, position.PositionType,
+					cash.Balance, cash.Locked, wallet.InitialDeposit.Sub(d(side.paid)), want)
+			}
+		}
+	}
+
+	var payments int64
+	if err := db.Model(&models.FundingPayment{}).Count(&payments).Error; err != nil {
+		t.Fatal(err)
+	}
+	if payments != 4 || notified != 4 {
+		t.Errorf("%d payments and %d notifications, want 4 of each", payments, notified)
+	}
+	checkLedger(t, db)
+}
+
+// A position whose margin can't cover its payment pays what margin it has
+// and is liquidated at the mark price with nothing left to refund, though
+// the liquidator would have left it open
+func TestFundingExhaustedMargin(t *testing.T) {
+	t.Setenv("FUNDING_RATE_CAP", "0.02")
+	db := testdb.Open(t)
+	feed := pricefeed.NewStatic(pricefeed.DefaultPrices)
+	l := NewLiquidator(db, feed)
+	f := NewFunder(db, feed, l)
+
+	// 10 of margin on 1000 of SOL at 100x. At 99.5 the long is 5 down,
+	// leaving 5 of equity over a maintenance margin of 4.975, but a 1.53%
+	// premium over the index of 98 costs it 15.23.
+	position := openPosition(t, db, feed, testdb.User(t, db), "SOL-PERP", Long, "10", 100)
+	setPrice(feed, "SOL-PERP", "99.5")
+	setPrice(feed, "SOL", "98")
+	if n, err := l.RunOnce(); err != nil || n != 0 {
+		t.Fatalf("liquidated %d positions (%v) before funding, want none", n, err)
+	}
+
+	if err := f.RunOnce(); err != nil {
+		t.Fatalf("funding failed: %v", err)
+	}
+
+	var payments []models.FundingPayment
+	if err := db.Where("position_id = ?", position.ID).Find(&payments).Error; err != nil {
+		t.Fatal(err)
+	}
+	if len(payments) != 1 || !payments[0].Amount.Equal(d("-10")) {
+		t.Fatalf("funding payments %+v, want one of -10", payments)
+	}
+
+	// The whole margin went to funding, so the loss settles at zero
+	checkSettled(t, db, position, "99.5", "0")
+	cash := testdb.Wallet(t, db, position.UserID, wallet.CashSymbol)
+	if want := wallet.InitialDeposit.Sub(d("10")); !cash.Balance.Equal(want) {
+		t.Errorf("cash balance %s, want %s", cash.Balance, want)
+	}
+}
+
+// Settling a position read before a funding payment releases the margin
+// the payment left, not the margin that was read
+func TestSettleAfterFunding(t *testing.T) {
+	tests := []struct {
+		side string
+		paid string // negative when the position received
+	}{
+		{Long, "7.65"},
+		{Short, "-7.65"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.side, func(t *testing.T) {
+			db := testdb.Open(t)
+			feed := pricefeed.NewStatic(pricefeed.DefaultPrices)
+			f := NewFunder(db, feed, NewLiquidator(db, feed))
+
+			position := openPosition(t, db, feed, testdb.User(t, db), "SOL-PERP", tt.side, "10", 10)
+			stale := reload(t, db, position)
+
+			setPrice(feed, "SOL-PERP", "102")
+			if err := f.RunOnce(); err != nil {
+				t.Fatalf("funding failed: %v", err)
+			}
+
+			err := db.Transaction(func(tx *gorm.DB) error {
+				return Settle(tx, &stale, d("102"), StatusClosed)
+			})
+			if err != nil {
+				t.Fatalf("settle failed: %v", err)
+			}
+			if want := d("100").Sub(d(tt.paid)); !stale.Margin.Equal(want) {
+				t.Errorf("settled with margin %s, want %s", stale.Margin, want)
+			}
+
+			pnl := PnL(stale, d("102"))
+			cash := testdb.Wallet(t, db, position.UserID, wallet.CashSymbol)
+			if want := wallet.InitialDeposit.Sub(d(tt.paid)).Add(pnl); !cash.Balance.Equal(want) || !cash.Locked.IsZero() {
+				t.Errorf("cash balance %s locked %s, want %s and 0", cash.Balance, cash.Locked, want)
+			}
+			checkLedger(t, db)
+		})
+	}
+}
+
+func TestNextFundingRun(t *testing.T) {
+	t.Setenv("FUNDING_INTERVAL", "8h")
+	db := testdb.Open(t)
+	f := NewFunder(db, nil, nil)
+	now := time.Date(2024, 1, 15, 10, 30, 0, 0, time.UTC)
+
+	// With no history, funding waits for the next boundary
+	if next := f.nextRun(now); !next.Equal(time.Date(2024, 1, 15, 16, 0, 0, 0, time.UTC)) {
+		t.Errorf("first run at %s, want 16:00", next)
+	}
+
+	var asset models.Asset
+	if err := db.Where("symbol = ?", "SOL-PERP").First(&asset).Error; err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		last time.Time
+		want time.Time
+	}{
+		// Restarted in the period already funded: wait for the next one
+		{time.Date(2024, 1, 15, 8, 0, 2, 0, time.UTC), time.Date(2024, 1, 15, 16, 0, 0, 0, time.UTC)},
+		// Down over the 08:00 boundary: fund straight away
+		{time.Date(2024, 1, 15, 0, 0, 2, 0, time.UTC), time.Date(2024, 1, 15, 8, 0, 0, 0, time.UTC)},
+	}
+	for _, tt := range tests {
+		rate := models.FundingRate{AssetID: asset.ID, Rate: d("0"), MarkPrice: d("100"), IndexPrice: d("100"), CreatedAt: tt.last}
+		if err := db.Create(&rate).Error; err != nil {
+			t.Fatal(err)
+		}
+		if next := f.nextRun(now); !next.Equal(tt.want) {
+			t.Errorf("after funding at %s, next run at %s, want %s", tt.last, next, tt.want)
+		}
+		if err := db.Delete(&rate).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+}
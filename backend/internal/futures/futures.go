@@ -0,0 +1,133 @@
+package futures
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/Enuma3lish/LUNG_CEX/backend/internal/ledger"
+	"github.com/Enuma3lish/LUNG_CEX/backend/internal/models"
+	"github.com/Enuma3lish/LUNG_CEX/backend/internal/wallet"
+	"github.com/Enuma3lish/LUNG_CEX/backend/pkg/utils"
+	"github.com/google/uuid"
+	"github.com/shopspring/decimal"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Position sides
+const (
+	Long  = "LONG"
+	Short = "SHORT"
+)
+
+// Position statuses
+const (
+	StatusOpen       = "OPEN"
+	StatusClosed     = "CLOSED"
+	StatusLiquidated = "LIQUIDATED"
+)
+
+var (
+	ErrPositionNotOpen = errors.New("position is not open")
+)
+
+// PositionListener is called with a position after a background engine
+// commits a change to it. Listeners run synchronously and must not block.
+type PositionListener func(position models.FuturesPosition)
+
+// InitialMargin is the collateral required to open a position of the given
+// size at the given leverage
+func InitialMargin(quantity decimal.Decimal, price decimal.Decimal, leverage int) decimal.Decimal {
+	return quantity.Mul(price).Div(decimal.NewFromInt(int64(leverage)))
+}
+
+// PnL is the profit or loss of a position marked at price
+func PnL(position models.FuturesPosition, price decimal.Decimal) decimal.Decimal {
+	pnl := price.Sub(position.EntryPrice).Mul(position.Quantity)
+	if position.PositionType == Short {
+		return pnl.Neg()
+	}
+	return pnl
+}
+
+// SettlementPnL is the PnL realized when closing at price. Positions use
+// isolated margin, so a loss can never exceed the position's margin.
+func SettlementPnL(position models.FuturesPosition, price decimal.Decimal) decimal.Decimal {
+	return decimal.Max(PnL(position, price), position.Margin.Neg())
+}
+
+// Lock locks an open position's row for the rest of tx and reloads it,
+// so its margin can't change under funding until tx ends. It returns
+// ErrPositionNotOpen if the position has been settled.
+func Lock(tx *gorm.DB, id uuid.UUID) (models.FuturesPosition, error) {
+	var position models.FuturesPosition
+	result := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("id = ? AND status = ?", id, StatusOpen).
+		Limit(1).
+		Find(&position)
+	if result.Error != nil {
+		return models.FuturesPosition{}, fmt.Errorf("failed to lock position: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return models.FuturesPosition{}, ErrPositionNotOpen
+	}
+	return position, nil
+}
+
+// Settle closes an open position at price with the given final status,
+// releasing its margin and realizing PnL into the owner's cash wallet. The
+// price must already be on the asset's tick. The position is locked and
+// reloaded first, so PnL and the margin released include any funding paid
+// since the caller read it. It returns ErrPositionNotOpen if the position
+// was already settled.
+func Settle(tx *gorm.DB, position *models.FuturesPosition, closePrice decimal.Decimal, status string) error {
+	locked, err := Lock(tx, position.ID)
+	if err != nil {
+		return err
+	}
+	locked.Asset = position.Asset
+	*position = locked
+
+	pnl := utils.RoundCents(SettlementPnL(*position, closePrice))
+	closedAt := time.Now()
+
+	result := tx.Model(&models.FuturesPosition{}).
+		Where("id = ? AND status = ?", position.ID, StatusOpen).
+		Updates(map[string]interface{}{
+			"status":      status,
+			"close_price": closePrice,
+			"pnl":         pnl,
+			"closed_at":   closedAt,
+		})
+	if result.Error != nil {
+		return fmt.Errorf("failed to close position: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return ErrPositionNotOpen
+	}
+
+	cash, err := wallet.CashAsset(tx)
+	if err != nil {
+		return err
+	}
+	if _, err := wallet.Adjust(tx, position.UserID, cash.ID, pnl, position.Margin.Neg()); err != nil {
+		return err
+	}
+	if !pnl.IsZero() {
+		if _, err := ledger.Post(tx, ledger.EntryRealizedPnL, position.ID.String(),
+			fmt.Sprintf("%s position %s at %s", position.PositionType, strings.ToLower(status), closePrice),
+			ledger.Wallet(position.UserID, cash.Symbol, pnl),
+			ledger.Platform(ledger.AccountFuturesPnL, cash.Symbol, pnl.Neg()),
+		); err != nil {
+			return err
+		}
+	}
+
+	position.Status = status
+	position.ClosePrice = &closePrice
+	position.PnL = &pnl
+	position.ClosedAt = &closedAt
+	return nil
+}
@@ -0,0 +1,181 @@
+package futures
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"github.com/Enuma3lish/LUNG_CEX/backend/internal/models"
+	"github.com/Enuma3lish/LUNG_CEX/backend/pkg/pricefeed"
+	"github.com/Enuma3lish/LUNG_CEX/backend/pkg/utils"
+	"github.com/shopspring/decimal"
+	"gorm.io/gorm"
+)
+
+const defaultLiquidationInterval = 5 * time.Second
+
+var defaultMaintenanceMarginRate = decimal.RequireFromString("0.005")
+
+// Liquidator periodically force-closes open positions whose equity has
+// fallen to their maintenance margin. Mark prices come from the injected
+// feed, so a pricefeed.Static makes runs deterministic.
+type Liquidator struct {
+	db                    *gorm.DB
+	priceFeed             pricefeed.PriceFeed
+	interval              time.Duration
+	maintenanceMarginRate decimal.Decimal
+	listeners             []PositionListener
+}
+
+func NewLiquidator(db *gorm.DB, priceFeed pricefeed.PriceFeed) *Liquidator {
+	interval := defaultLiquidationInterval
+	if v, err := time.ParseDuration(os.Getenv("LIQUIDATION_INTERVAL")); err == nil && v > 0 {
+		interval = v
+	}
+
+	rate := defaultMaintenanceMarginRate
+	if v, err := decimal.NewFromString(os.Getenv("MAINTENANCE_MARGIN_RATE")); err == nil && v.IsPositive() {
+		rate = v
+	}
+
+	return &Liquidator{
+		db:                    db,
+		priceFeed:             priceFeed,
+		interval:              interval,
+		maintenanceMarginRate: rate,
+	}
+}
+
+// OnLiquidate registers a listener for liquidated positions. Register
+// listeners before calling Run.
+func (l *Liquidator) OnLiquidate(listener PositionListener) {
+	l.listeners = append(l.listeners, listener)
+}
+
+// MaintenanceMargin is the minimum equity a position must keep at price
+func (l *Liquidator) MaintenanceMargin(position models.FuturesPosition, price decimal.Decimal) decimal.Decimal {
+	return position.Quantity.Mul(price).Mul(l.maintenanceMarginRate)
+}
+
+// Run checks positions on every tick until ctx is cancelled
+func (l *Liquidator) Run(ctx context.Context) {
+	ticker := time.NewTicker(l.interval)
+	defer ticker.Stop()
+
+	log.Printf("Liquidation engine started (interval %s, maintenance margin rate %s)", l.interval, l.maintenanceMarginRate)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if _, err := l.RunOnce(); err != nil {
+				log.Printf("Warning: Liquidation run failed: %v", err)
+			}
+		}
+	}
+}
+
+// RunOnce marks every open position once and liquidates those at or
+// below maintenance margin, returning how many were liquidated. A position
+// that fails to liquidate is logged and skipped, so it can't hold up the
+// rest, and counted in the error returned.
+func (l *Liquidator) RunOnce() (int, error) {
+	var positions []models.FuturesPosition
+	if err := l.db.Preload("Asset").Where("status = ?", StatusOpen).Find(&positions).Error; err != nil {
+		return 0, fmt.Errorf("failed to fetch open positions: %w", err)
+	}
+
+	// Mark each symbol once so every position sees the same price
+	prices := make(map[string]decimal.Decimal)
+	liquidated, failed := 0, 0
+	for _, position := range positions {
+		price, ok := prices[position.Asset.Symbol]
+		if !ok {
+			quote, err := l.priceFeed.Price(position.Asset.Symbol)
+			if err != nil {
+				log.Printf("Warning: No mark price for %s: %v", position.Asset.Symbol, err)
+				continue
+			}
+			price = utils.FeedPrice(quote, position.Asset.TickSize)
+			prices[position.Asset.Symbol] = price
+		}
+
+		equity := position.Margin.Add(PnL(position, price))
+		maintenance := l.MaintenanceMargin(position, price)
+		if equity.GreaterThan(maintenance) {
+			continue
+		}
+
+		ok, err := l.liquidate(position, price, false)
+		if err != nil {
+			if !errors.Is(err, ErrPositionNotOpen) {
+				log.Printf("Warning: Failed to liquidate position %s: %v", position.ID, err)
+				failed++
+			}
+			continue
+		}
+		if ok {
+			liquidated++
+		}
+	}
+
+	if failed > 0 {
+		return liquidated, fmt.Errorf("failed to liquidate %d positions", failed)
+	}
+	return liquidated, nil
+}
+
+// liquidate settles a position at price, reporting whether it did. Unless
+// forced, the locked position is checked against maintenance margin again,
+// so one that funding topped up since it was marked stays open.
+func (l *Liquidator) liquidate(position models.FuturesPosition, price decimal.Decimal, force bool) (bool, error) {
+	tx := l.db.Begin()
+
+	locked, err := Lock(tx, position.ID)
+	if err != nil {
+		tx.Rollback()
+		return false, err
+	}
+	locked.Asset = position.Asset
+	position = locked
+
+	equity := position.Margin.Add(PnL(position, price))
+	maintenance := l.MaintenanceMargin(position, price)
+	if !force && equity.GreaterThan(maintenance) {
+		tx.Rollback()
+		return false, nil
+	}
+
+	if err := Settle(tx, &position, price, StatusLiquidated); err != nil {
+		tx.Rollback()
+		return false, err
+	}
+
+	event := models.LiquidationEvent{
+		PositionID:        position.ID,
+		UserID:            position.UserID,
+		AssetID:           position.AssetID,
+		MarkPrice:         price,
+		Equity:            utils.RoundCents(equity),
+		MaintenanceMargin: utils.RoundCents(maintenance),
+		PnL:               *position.PnL,
+	}
+	if err := tx.Create(&event).Error; err != nil {
+		tx.Rollback()
+		return false, fmt.Errorf("failed to record liquidation: %w", err)
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		return false, fmt.Errorf("failed to commit liquidation: %w", err)
+	}
+
+	log.Printf("Liquidated position %s (%s %s) at %s", position.ID, position.PositionType, position.Asset.Symbol, price)
+	for _, listener := range l.listeners {
+		listener(position)
+	}
+	return true, nil
+}
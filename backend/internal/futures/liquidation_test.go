@@ -0,0 +1,253 @@
+package futures
+
+import (
+	"testing"
+
+	"github.com/Enuma3lish/LUNG_CEX/backend/internal/ledger"
+	"github.com/Enuma3lish/LUNG_CEX/backend/internal/models"
+	"github.com/Enuma3lish/LUNG_CEX/backend/internal/testdb"
+	"github.com/Enuma3lish/LUNG_CEX/backend/internal/wallet"
+	"github.com/Enuma3lish/LUNG_CEX/backend/pkg/pricefeed"
+	"github.com/Enuma3lish/LUNG_CEX/backend/pkg/utils"
+	"github.com/google/uuid"
+	"github.com/shopspring/decimal"
+	"gorm.io/gorm"
+)
+
+func d(s string) decimal.Decimal {
+	return decimal.RequireFromString(s)
+}
+
+// openPosition opens a position at the feed's price, locking its margin
+// as the futures handler does
+func openPosition(t *testing.T, db *gorm.DB, feed pricefeed.PriceFeed, userID uuid.UUID, symbol string, side string, quantity string, leverage int) models.FuturesPosition {
+	t.Helper()
+
+	var position models.FuturesPosition
+	err := db.Transaction(func(tx *gorm.DB) error {
+		var asset models.Asset
+		if err := tx.Where("symbol = ?", symbol).First(&asset).Error; err != nil {
+			return err
+		}
+		quote, err := feed.Price(symbol)
+		if err != nil {
+			return err
+		}
+		entryPrice := utils.FeedPrice(quote, asset.TickSize)
+		margin := utils.RoundCents(InitialMargin(d(quantity), entryPrice, leverage))
+
+		cash, err := wallet.CashAsset(tx)
+		if err != nil {
+			return err
+		}
+		if _, err := wallet.Lock(tx, userID, cash.ID, margin); err != nil {
+			return err
+		}
+		position = models.FuturesPosition{
+			UserID:       userID,
+			AssetID:      asset.ID,
+			PositionType: side,
+			Quantity:     d(quantity),
+			EntryPrice:   entryPrice,
+			Leverage:     leverage,
+			Margin:       margin,
+			Status:       StatusOpen,
+		}
+		if err := tx.Create(&position).Error; err != nil {
+			return err
+		}
+		position.Asset = asset
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("failed to open position: %v", err)
+	}
+	return position
+}
+
+// setPrice moves a symbol's feed price
+func setPrice(feed *pricefeed.Static, symbol string, price string) {
+	feed.Set(symbol, d(price).InexactFloat64())
+}
+
+func reload(t *testing.T, db *gorm.DB, position models.FuturesPosition) models.FuturesPosition {
+	t.Helper()
+
+	var reloaded models.FuturesPosition
+	if err := db.First(&reloaded, "id = ?", position.ID).Error; err != nil {
+		t.Fatalf("failed to reload position: %v", err)
+	}
+	return reloaded
+}
+
+func checkLedger(t *testing.T, db *gorm.DB) {
+	t.Helper()
+
+	report, err := ledger.Check(db)
+	if err != nil {
+		t.Fatalf("ledger check failed: %v", err)
+	}
+	if !report.OK() {
+		t.Errorf("ledger drifted from balances: %+v", report)
+	}
+}
+
+// checkSettled asserts a position was liquidated at price and its margin
+// released, with the PnL and any funding it was paid realized into cash
+func checkSettled(t *testing.T, db *gorm.DB, position models.FuturesPosition, price string, pnl string) {
+	t.Helper()
+
+	position = reload(t, db, position)
+	if position.Status != StatusLiquidated {
+		t.Fatalf("position status %s, want %s", position.Status, StatusLiquidated)
+	}
+	if !position.ClosePrice.Equal(d(price)) || !position.PnL.Equal(d(pnl)) {
+		t.Errorf("closed at %s with PnL %s, want %s and %s", position.ClosePrice, position.PnL, price, pnl)
+	}
+
+	var event models.LiquidationEvent
+	if err := db.First(&event, "position_id = ?", position.ID).Error; err != nil {
+		t.Fatalf("no liquidation event: %v", err)
+	}
+	if !event.MarkPrice.Equal(d(price)) || !event.PnL.Equal(d(pnl)) {
+		t.Errorf("liquidation event at %s with PnL %s, want %s and %s", event.MarkPrice, event.PnL, price, pnl)
+	}
+
+	var funding decimal.Decimal
+	if err := db.Model(&models.FundingPayment{}).Where("position_id = ?", position.ID).
+		Select("COALESCE(SUM(amount), 0)").Scan(&funding).Error; err != nil {
+		t.Fatalf("failed to sum funding payments: %v", err)
+	}
+	cash := testdb.Wallet(t, db, position.UserID, wallet.CashSymbol)
+	if want := wallet.InitialDeposit.Add(d(pnl)).Add(funding); !cash.Balance.Equal(want) || !cash.Locked.IsZero() {
+		t.Errorf("cash balance %s locked %s, want %s and 0", cash.Balance, cash.Locked, want)
+	}
+	checkLedger(t, db)
+}
+
+// A 10 SOL position at 100 with 10x leverage has 100 of margin and a
+// maintenance margin of 0.5% of its value. The long's equity 10P - 900
+// reaches 0.05P below 90.4523; the short's 1100 - 10P above 109.4527.
+func TestLiquidationThreshold(t *testing.T) {
+	tests := []struct {
+		side             string
+		safe, liquidated string
+		pnl              string
+	}{
+		{Long, "90.46", "90.45", "-95.5"},
+		{Short, "109.45", "109.46", "-94.6"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.side, func(t *testing.T) {
+			db := testdb.Open(t)
+			feed := pricefeed.NewStatic(pricefeed.DefaultPrices)
+			l := NewLiquidator(db, feed)
+			var notified []models.FuturesPosition
+			l.OnLiquidate(func(position models.FuturesPosition) {
+				notified = append(notified, position)
+			})
+
+			position := openPosition(t, db, feed, testdb.User(t, db), "SOL-PERP", tt.side, "10", 10)
+			if !position.Margin.Equal(d("100")) {
+				t.Fatalf("margin %s, want 100", position.Margin)
+			}
+
+			setPrice(feed, "SOL-PERP", tt.safe)
+			if n, err := l.RunOnce(); err != nil || n != 0 {
+				t.Fatalf("at %s liquidated %d positions (%v), want none", tt.safe, n, err)
+			}
+			if status := reload(t, db, position).Status; status != StatusOpen {
+				t.Fatalf("at %s position is %s, want it still open", tt.safe, status)
+			}
+
+			setPrice(feed, "SOL-PERP", tt.liquidated)
+			if n, err := l.RunOnce(); err != nil || n != 1 {
+				t.Fatalf("at %s liquidated %d positions (%v), want 1", tt.liquidated, n, err)
+			}
+			checkSettled(t, db, position, tt.liquidated, tt.pnl)
+			if len(notified) != 1 || notified[0].ID != position.ID {
+				t.Errorf("listeners got %d positions, want the liquidated one", len(notified))
+			}
+
+			// A settled position isn't liquidated again
+			if n, err := l.RunOnce(); err != nil || n != 0 {
+				t.Errorf("second run liquidated %d positions (%v), want none", n, err)
+			}
+		})
+	}
+}
+
+// Positions use isolated margin, so a price gap past zero equity loses
+// the margin and nothing more
+func TestLiquidationLossCappedAtMargin(t *testing.T) {
+	tests := []struct {
+		side  string
+		price string
+	}{
+		{Long, "50"},
+		{Short, "200"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.side, func(t *testing.T) {
+			db := testdb.Open(t)
+			feed := pricefeed.NewStatic(pricefeed.DefaultPrices)
+			l := NewLiquidator(db, feed)
+
+			position := openPosition(t, db, feed, testdb.User(t, db), "SOL-PERP", tt.side, "10", 10)
+			setPrice(feed, "SOL-PERP", tt.price)
+			if n, err := l.RunOnce(); err != nil || n != 1 {
+				t.Fatalf("liquidated %d positions (%v), want 1", n, err)
+			}
+			checkSettled(t, db, position, tt.price, "-100")
+		})
+	}
+}
+
+func TestSettlementPnL(t *testing.T) {
+	tests := []struct {
+		side        string
+		price       string
+		pnl, settle string
+	}{
+		{Long, "120", "200", "200"},
+		{Long, "95", "-50", "-50"},
+		{Long, "50", "-500", "-100"},
+		{Short, "90", "100", "100"},
+		{Short, "200", "-1000", "-100"},
+	}
+	for _, tt := range tests {
+		position := models.FuturesPosition{PositionType: tt.side, Quantity: d("10"), EntryPrice: d("100"), Margin: d("100")}
+		if got := PnL(position, d(tt.price)); !got.Equal(d(tt.pnl)) {
+			t.Errorf("%s at %s: PnL %s, want %s", tt.side, tt.price, got, tt.pnl)
+		}
+		if got := SettlementPnL(position, d(tt.price)); !got.Equal(d(tt.settle)) {
+			t.Errorf("%s at %s: settlement PnL %s, want %s", tt.side, tt.price, got, tt.settle)
+		}
+	}
+}
+
+// A position that can't be settled doesn't stop the rest of the run
+func TestLiquidationSkipsFailures(t *testing.T) {
+	db := testdb.Open(t)
+	feed := pricefeed.NewStatic(pricefeed.DefaultPrices)
+	l := NewLiquidator(db, feed)
+
+	broken := openPosition(t, db, feed, testdb.User(t, db), "SOL-PERP", Long, "10", 10)
+	healthy := openPosition(t, db, feed, testdb.User(t, db), "SOL-PERP", Long, "10", 10)
+
+	// Without its margin locked, releasing it fails
+	cash := testdb.Wallet(t, db, broken.UserID, wallet.CashSymbol)
+	if err := db.Model(&models.Wallet{}).Where("id = ?", cash.ID).Update("locked", 0).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	setPrice(feed, "SOL-PERP", "90")
+	n, err := l.RunOnce()
+	if err == nil || n != 1 {
+		t.Fatalf("liquidated %d positions (%v), want 1 and an error", n, err)
+	}
+	if status := reload(t, db, broken).Status; status != StatusOpen {
+		t.Errorf("broken position is %s, want it still open", status)
+	}
+	checkSettled(t, db, healthy, "90", "-100")
+}
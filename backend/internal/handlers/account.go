@@ -0,0 +1,57 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/Enuma3lish/LUNG_CEX/backend/internal/fees"
+	"github.com/Enuma3lish/LUNG_CEX/backend/internal/models"
+	"github.com/Enuma3lish/LUNG_CEX/backend/pkg/pricefeed"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+type AccountHandler struct {
+	db        *gorm.DB
+	priceFeed pricefeed.PriceFeed
+}
+
+func NewAccountHandler(db *gorm.DB, priceFeed pricefeed.PriceFeed) *AccountHandler {
+	return &AccountHandler{db: db, priceFeed: priceFeed}
+}
+
+// GetFees returns the user's trailing volume, fee tier and the rates they
+// currently pay on each market
+func (h *AccountHandler) GetFees(c *gin.Context) {
+	userID := c.MustGet("user_id").(uuid.UUID)
+
+	volume, err := fees.Volume(h.db, h.priceFeed, userID)
+	if err != nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Failed to compute trading volume"})
+		return
+	}
+	tier, next := fees.TierFor(volume)
+
+	var markets []models.Market
+	if err := h.db.Order("symbol ASC").Find(&markets).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch markets"})
+		return
+	}
+
+	rates := make([]models.MarketFees, 0, len(markets))
+	for _, market := range markets {
+		rates = append(rates, models.MarketFees{
+			Market:       market.Symbol,
+			MakerFeeRate: tier.Rate(market.MakerFeeRate),
+			TakerFeeRate: tier.Rate(market.TakerFeeRate),
+		})
+	}
+
+	c.JSON(http.StatusOK, models.FeeSchedule{
+		Volume:   volume,
+		Tier:     tier,
+		NextTier: next,
+		Tiers:    fees.Tiers,
+		Markets:  rates,
+	})
+}
@@ -5,10 +5,13 @@ import (
 	"os"
 	"time"
 
+	"github.com/Enuma3lish/LUNG_CEX/backend/internal/ledger"
 	"github.com/Enuma3lish/LUNG_CEX/backend/internal/models"
+	"github.com/Enuma3lish/LUNG_CEX/backend/internal/wallet"
 	"github.com/gin-gonic/gin"
 	"github.com/golang-jwt/jwt/v5"
 	"github.com/google/uuid"
+	"github.com/shopspring/decimal"
 	"golang.org/x/crypto/bcrypt"
 	"gorm.io/gorm"
 )
@@ -48,19 +51,49 @@ func (h *AuthHandler) Register(c *gin.Context) {
 		return
 	}
 
-	// Create user with initial balance of 10000 USD
 	user := models.User{
 		Email:    req.Email,
 		Username: req.Username,
 		Password: string(hashedPassword),
-		Balance:  10000.00,
 	}
 
-	if err := h.db.Create(&user).Error; err != nil {
+	tx := h.db.Begin()
+	if err := tx.Create(&user).Error; err != nil {
+		tx.Rollback()
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create user"})
 		return
 	}
 
+	// Fund the new user's cash wallet with the initial balance of 10000 USD,
+	// a deposit from the platform
+	cash, err := wallet.CashAsset(tx)
+	if err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create user"})
+		return
+	}
+	cashWallet, err := wallet.Adjust(tx, user.ID, cash.ID, wallet.InitialDeposit, decimal.Zero)
+	if err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create user"})
+		return
+	}
+	if _, err := ledger.Post(tx, ledger.EntryDeposit, user.ID.String(), "Initial balance",
+		ledger.Wallet(user.ID, cash.Symbol, wallet.InitialDeposit),
+		ledger.Platform(ledger.AccountDeposits, cash.Symbol, wallet.InitialDeposit.Neg()),
+	); err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create user"})
+		return
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create user"})
+		return
+	}
+	cashWallet.Asset = cash
+	user.Wallets = []models.Wallet{cashWallet}
+
 	// Generate JWT token
 	token, err := h.generateToken(user.ID, user.Email)
 	if err != nil {
@@ -83,7 +116,7 @@ func (h *AuthHandler) Login(c *gin.Context) {
 
 	// Find user
 	var user models.User
-	if err := h.db.Where("email = ?", req.Email).First(&user).Error; err != nil {
+	if err := h.db.Preload("Wallets.Asset").Where("email = ?", req.Email).First(&user).Error; err != nil {
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid credentials"})
 		return
 	}
@@ -111,7 +144,7 @@ func (h *AuthHandler) GetProfile(c *gin.Context) {
 	userID := c.MustGet("user_id").(uuid.UUID)
 
 	var user models.User
-	if err := h.db.First(&user, userID).Error; err != nil {
+	if err := h.db.Preload("Wallets.Asset").First(&user, userID).Error; err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
 		return
 	}
@@ -0,0 +1,116 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/Enuma3lish/LUNG_CEX/backend/internal/conditional"
+	"github.com/Enuma3lish/LUNG_CEX/backend/internal/models"
+	"github.com/Enuma3lish/LUNG_CEX/backend/pkg/pricefeed"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+type ConditionalHandler struct {
+	db        *gorm.DB
+	priceFeed pricefeed.PriceFeed
+}
+
+func NewConditionalHandler(db *gorm.DB, priceFeed pricefeed.PriceFeed) *ConditionalHandler {
+	return &ConditionalHandler{db: db, priceFeed: priceFeed}
+}
+
+// CreateOrder stores a stop, take-profit or trailing stop order on a
+// spot market or an open futures position
+func (h *ConditionalHandler) CreateOrder(c *gin.Context) {
+	userID := c.MustGet("user_id").(uuid.UUID)
+
+	var req models.ConditionalOrderRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	order, err := conditional.Create(h.db, h.priceFeed, userID, req)
+	if err != nil {
+		respondConditionalError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":           "Conditional order created",
+		"conditional_order": order,
+	})
+}
+
+// GetOrders returns the user's conditional orders, optionally filtered by
+// status
+func (h *ConditionalHandler) GetOrders(c *gin.Context) {
+	userID := c.MustGet("user_id").(uuid.UUID)
+
+	query := h.db.Preload("Market").Preload("Position.Asset").Where("user_id = ?", userID)
+	if status := c.Query("status"); status != "" {
+		query = query.Where("status = ?", status)
+	}
+
+	var orders []models.ConditionalOrder
+	if err := query.Order("created_at DESC").Limit(100).Find(&orders).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch conditional orders"})
+		return
+	}
+
+	c.JSON(http.StatusOK, orders)
+}
+
+// CancelOrder cancels one of the user's active conditional orders
+func (h *ConditionalHandler) CancelOrder(c *gin.Context) {
+	userID := c.MustGet("user_id").(uuid.UUID)
+
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid conditional order id"})
+		return
+	}
+
+	if err := conditional.Cancel(h.db, userID, id); err != nil {
+		respondConditionalError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Conditional order cancelled"})
+}
+
+// respondConditionalError maps conditional order errors onto HTTP responses
+func respondConditionalError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, conditional.ErrNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Conditional order not found"})
+	case errors.Is(err, conditional.ErrNotActive):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Conditional order is not active"})
+	case errors.Is(err, conditional.ErrMarketNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Market not found"})
+	case errors.Is(err, conditional.ErrPositionNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Position not found"})
+	case errors.Is(err, conditional.ErrPositionNotOpen):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Position is not open"})
+	case errors.Is(err, conditional.ErrInvalidTarget):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Give either a market, side and quantity or a position"})
+	case errors.Is(err, conditional.ErrInvalidQuantity):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Quantity must be a positive multiple of the lot size"})
+	case errors.Is(err, conditional.ErrInsufficientQuantity):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Insufficient quantity"})
+	case errors.Is(err, conditional.ErrInvalidTrigger):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Trigger price must be a positive multiple of the tick size"})
+	case errors.Is(err, conditional.ErrInvalidLimit):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Limit price is required for stop-limit orders and only accepted for them"})
+	case errors.Is(err, conditional.ErrInvalidTrailing):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Trailing stops need a trailing type and a positive offset, below 100 for a percent"})
+	case errors.Is(err, conditional.ErrWouldTrigger):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Trigger price would trigger immediately"})
+	case errors.Is(err, conditional.ErrPriceUnavailable):
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Price unavailable"})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update conditional order"})
+	}
+}
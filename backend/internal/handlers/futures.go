@@ -0,0 +1,331 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/Enuma3lish/LUNG_CEX/backend/internal/conditional"
+	"github.com/Enuma3lish/LUNG_CEX/backend/internal/futures"
+	"github.com/Enuma3lish/LUNG_CEX/backend/internal/models"
+	"github.com/Enuma3lish/LUNG_CEX/backend/internal/stream"
+	"github.com/Enuma3lish/LUNG_CEX/backend/internal/wallet"
+	"github.com/Enuma3lish/LUNG_CEX/backend/pkg/pricefeed"
+	"github.com/Enuma3lish/LUNG_CEX/backend/pkg/utils"
+	"github.com/gin-gonic/gin"
+	"github.com/go-redis/redis/v8"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+type FuturesHandler struct {
+	db          *gorm.DB
+	redisClient *redis.Client
+	priceFeed   pricefeed.PriceFeed
+	publisher   *stream.Publisher
+}
+
+func NewFuturesHandler(db *gorm.DB, redisClient *redis.Client, priceFeed pricefeed.PriceFeed, publisher *stream.Publisher) *FuturesHandler {
+	return &FuturesHandler{
+		db:          db,
+		redisClient: redisClient,
+		priceFeed:   priceFeed,
+		publisher:   publisher,
+	}
+}
+
+func (h *FuturesHandler) OpenPosition(c *gin.Context) {
+	userID := c.MustGet("user_id").(uuid.UUID)
+
+	var req models.FuturesTradeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// Start transaction
+	tx := h.db.Begin()
+	defer func() {
+		if r := recover(); r != nil {
+			tx.Rollback()
+		}
+	}()
+
+	// Find asset
+	var asset models.Asset
+	if err := tx.Where("symbol = ?", req.AssetSymbol).First(&asset).Error; err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusNotFound, gin.H{"error": "Asset not found"})
+		return
+	}
+	if asset.AssetType != "FUTURES" {
+		tx.Rollback()
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Asset is not a futures contract"})
+		return
+	}
+	if !req.Quantity.IsPositive() || !utils.IsMultiple(req.Quantity, asset.LotSize) {
+		tx.Rollback()
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Quantity must be a positive multiple of the lot size"})
+		return
+	}
+
+	// Entry price comes from the server, never the client
+	price, err := h.priceFeed.Price(asset.Symbol)
+	if err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Price unavailable"})
+		return
+	}
+	entryPrice := utils.FeedPrice(price, asset.TickSize)
+	margin := utils.RoundCents(futures.InitialMargin(req.Quantity, entryPrice, req.Leverage))
+
+	// Lock margin in the cash wallet
+	cash, err := wallet.CashAsset(tx)
+	if err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update balance"})
+		return
+	}
+	cashWallet, err := wallet.Lock(tx, userID, cash.ID, margin)
+	if err != nil {
+		tx.Rollback()
+		if errors.Is(err, wallet.ErrInsufficientBalance) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Insufficient balance"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update balance"})
+		return
+	}
+
+	position := models.FuturesPosition{
+		UserID:       userID,
+		AssetID:      asset.ID,
+		PositionType: req.PositionType,
+		Quantity:     req.Quantity,
+		EntryPrice:   entryPrice,
+		Leverage:     req.Leverage,
+		Margin:       margin,
+		Status:       futures.StatusOpen,
+	}
+
+	if err := tx.Create(&position).Error; err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to open position"})
+		return
+	}
+
+	// Attach the optional stop-loss and take-profit with the position so
+	// it never exists unprotected
+	position.Asset = asset
+	attached := []*models.ConditionalOrder{}
+	for _, protect := range []models.ConditionalOrderRequest{
+		{Kind: conditional.KindStopMarket, TriggerPrice: req.StopLoss},
+		{Kind: conditional.KindTakeProfit, TriggerPrice: req.TakeProfit},
+	} {
+		if protect.TriggerPrice.IsZero() {
+			continue
+		}
+		order, err := conditional.Attach(tx, position, protect, entryPrice)
+		if err != nil {
+			tx.Rollback()
+			respondConditionalError(c, err)
+			return
+		}
+		attached = append(attached, order)
+	}
+
+	// Commit transaction
+	if err := tx.Commit().Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to commit transaction"})
+		return
+	}
+
+	h.invalidatePortfolio(c, userID)
+
+	h.publisher.PositionChanged(position)
+	c.JSON(http.StatusOK, gin.H{
+		"message":            "Position opened successfully",
+		"position":           position,
+		"conditional_orders": attached,
+		"available_balance":  cashWallet.Available(),
+	})
+}
+
+func (h *FuturesHandler) ClosePosition(c *gin.Context) {
+	userID := c.MustGet("user_id").(uuid.UUID)
+
+	var req models.FuturesCloseRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// Start transaction
+	tx := h.db.Begin()
+	defer func() {
+		if r := recover(); r != nil {
+			tx.Rollback()
+		}
+	}()
+
+	// Find position
+	var position models.FuturesPosition
+	if err := tx.Preload("Asset").Where("id = ? AND user_id = ?", req.PositionID, userID).First(&position).Error; err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusNotFound, gin.H{"error": "Position not found"})
+		return
+	}
+	if position.Status != futures.StatusOpen {
+		tx.Rollback()
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Position is not open"})
+		return
+	}
+
+	// Release margin and realize PnL at the current price
+	price, err := h.priceFeed.Price(position.Asset.Symbol)
+	if err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Price unavailable"})
+		return
+	}
+	closePrice := utils.FeedPrice(price, position.Asset.TickSize)
+	if err := futures.Settle(tx, &position, closePrice, futures.StatusClosed); err != nil {
+		tx.Rollback()
+		switch {
+		case errors.Is(err, futures.ErrPositionNotOpen):
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Position is not open"})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to close position"})
+		}
+		return
+	}
+	if err := conditional.CancelForPosition(tx, position.ID); err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to close position"})
+		return
+	}
+
+	cash, err := wallet.CashAsset(tx)
+	if err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to close position"})
+		return
+	}
+	cashWallet, err := wallet.Get(tx, userID, cash.ID)
+	if err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to close position"})
+		return
+	}
+
+	// Commit transaction
+	if err := tx.Commit().Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to commit transaction"})
+		return
+	}
+
+	h.invalidatePortfolio(c, userID)
+	h.publisher.PositionChanged(position)
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":           "Position closed successfully",
+		"position":          position,
+		"remaining_balance": cashWallet.Balance,
+	})
+}
+
+func (h *FuturesHandler) GetPositions(c *gin.Context) {
+	userID := c.MustGet("user_id").(uuid.UUID)
+
+	var positions []models.FuturesPosition
+	if err := h.db.Preload("Asset").Where("user_id = ? AND status = ?", userID, futures.StatusOpen).Order("created_at DESC").Find(&positions).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch positions"})
+		return
+	}
+
+	positionsWithDetails := []models.FuturesPositionWithDetails{}
+	for _, position := range positions {
+		price, err := h.priceFeed.Price(position.Asset.Symbol)
+		if err != nil {
+			c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Price unavailable"})
+			return
+		}
+		markPrice := utils.FeedPrice(price, position.Asset.TickSize)
+		pnl := utils.RoundCents(futures.PnL(position, markPrice))
+
+		positionsWithDetails = append(positionsWithDetails, models.FuturesPositionWithDetails{
+			FuturesPosition: position,
+			MarkPrice:       markPrice,
+			UnrealizedPnL:   pnl,
+			PnLPercent:      utils.Percent(pnl, position.Margin),
+		})
+	}
+
+	c.JSON(http.StatusOK, positionsWithDetails)
+}
+
+func (h *FuturesHandler) GetHistory(c *gin.Context) {
+	userID := c.MustGet("user_id").(uuid.UUID)
+
+	var positions []models.FuturesPosition
+	if err := h.db.Preload("Asset").Where("user_id = ? AND status <> ?", userID, futures.StatusOpen).Order("closed_at DESC").Limit(100).Find(&positions).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch position history"})
+		return
+	}
+
+	c.JSON(http.StatusOK, positions)
+}
+
+func (h *FuturesHandler) GetLiquidations(c *gin.Context) {
+	userID := c.MustGet("user_id").(uuid.UUID)
+
+	var events []models.LiquidationEvent
+	if err := h.db.Preload("Asset").Where("user_id = ?", userID).Order("created_at DESC").Limit(100).Find(&events).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch liquidations"})
+		return
+	}
+
+	c.JSON(http.StatusOK, events)
+}
+
+// GetFunding returns recent funding rates, optionally for one symbol, and
+// the user's funding payments
+func (h *FuturesHandler) GetFunding(c *gin.Context) {
+	userID := c.MustGet("user_id").(uuid.UUID)
+
+	rateQuery := h.db.Preload("Asset").Order("created_at DESC").Limit(100)
+	paymentQuery := h.db.Preload("Asset").Where("user_id = ?", userID).Order("created_at DESC").Limit(100)
+
+	if symbol := c.Query("symbol"); symbol != "" {
+		var asset models.Asset
+		if err := h.db.Where("symbol = ? AND asset_type = ?", symbol, "FUTURES").First(&asset).Error; err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Asset not found"})
+			return
+		}
+		rateQuery = rateQuery.Where("asset_id = ?", asset.ID)
+		paymentQuery = paymentQuery.Where("asset_id = ?", asset.ID)
+	}
+
+	var rates []models.FundingRate
+	if err := rateQuery.Find(&rates).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch funding rates"})
+		return
+	}
+
+	var payments []models.FundingPayment
+	if err := paymentQuery.Find(&payments).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch funding payments"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"rates":    rates,
+		"payments": payments,
+	})
+}
+
+func (h *FuturesHandler) invalidatePortfolio(c *gin.Context, userID uuid.UUID) {
+	if h.redisClient != nil {
+		h.redisClient.Del(c, fmt.Sprintf("portfolio:%s", userID.String()))
+	}
+}
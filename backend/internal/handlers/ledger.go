@@ -0,0 +1,63 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/Enuma3lish/LUNG_CEX/backend/internal/ledger"
+	"github.com/Enuma3lish/LUNG_CEX/backend/internal/models"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+const (
+	defaultLedgerLimit = 100
+	maxLedgerLimit     = 500
+)
+
+type LedgerHandler struct {
+	db *gorm.DB
+}
+
+func NewLedgerHandler(db *gorm.DB) *LedgerHandler {
+	return &LedgerHandler{db: db}
+}
+
+// GetLedger returns the user's wallet postings newest first, each with its
+// journal entry and the wallet's balance after it. Optional asset and type
+// filters narrow the list without changing the running balances.
+func (h *LedgerHandler) GetLedger(c *gin.Context) {
+	userID := c.MustGet("user_id").(uuid.UUID)
+
+	limit := defaultLedgerLimit
+	if v := c.Query("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 || n > maxLedgerLimit {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Limit must be between 1 and 500"})
+			return
+		}
+		limit = n
+	}
+
+	// Running balances are computed over the whole wallet before filtering
+	running := h.db.Model(&models.Posting{}).
+		Select("postings.*, SUM(amount) OVER (PARTITION BY asset ORDER BY created_at, id) AS balance_after").
+		Where("user_id = ? AND account = ?", userID, ledger.AccountWallet)
+
+	query := h.db.Table("(?) AS postings", running).Preload("Entry")
+	if asset := c.Query("asset"); asset != "" {
+		query = query.Where("asset = ?", asset)
+	}
+	if entryType := c.Query("type"); entryType != "" {
+		query = query.Where("entry_id IN (?)", h.db.Model(&models.JournalEntry{}).Select("id").Where("type = ?", entryType))
+	}
+
+	var postings []models.Posting
+	if err := query.Order("created_at DESC, id DESC").Limit(limit).Find(&postings).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch ledger"})
+		return
+	}
+
+	c.JSON(http.StatusOK, postings)
+}
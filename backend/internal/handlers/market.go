@@ -0,0 +1,303 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/Enuma3lish/LUNG_CEX/backend/internal/candles"
+	"github.com/Enuma3lish/LUNG_CEX/backend/internal/exchange"
+	"github.com/Enuma3lish/LUNG_CEX/backend/internal/models"
+	"github.com/Enuma3lish/LUNG_CEX/backend/internal/wallet"
+	"github.com/Enuma3lish/LUNG_CEX/backend/pkg/pricefeed"
+	redisClient "github.com/Enuma3lish/LUNG_CEX/backend/pkg/redis"
+	"github.com/Enuma3lish/LUNG_CEX/backend/pkg/utils"
+	"github.com/gin-gonic/gin"
+	"github.com/go-redis/redis/v8"
+	"github.com/shopspring/decimal"
+	"gorm.io/gorm"
+)
+
+const (
+	defaultCandleLimit = 500
+	maxCandleLimit     = 1000
+	tickersCacheKey    = "market:tickers"
+)
+
+type MarketHandler struct {
+	db          *gorm.DB
+	redisClient *redis.Client
+	priceFeed   pricefeed.PriceFeed
+}
+
+func NewMarketHandler(db *gorm.DB, redisClientInstance *redis.Client, priceFeed pricefeed.PriceFeed) *MarketHandler {
+	return &MarketHandler{
+		db:          db,
+		redisClient: redisClientInstance,
+		priceFeed:   priceFeed,
+	}
+}
+
+// GetAssets lists every tradable asset
+func (h *MarketHandler) GetAssets(c *gin.Context) {
+	var assets []models.Asset
+	if err := h.db.Order("asset_type ASC, symbol ASC").Find(&assets).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch assets"})
+		return
+	}
+
+	c.JSON(http.StatusOK, assets)
+}
+
+// GetMarkets lists every market with its assets and trading rules
+func (h *MarketHandler) GetMarkets(c *gin.Context) {
+	var markets []models.Market
+	if err := h.db.Preload("BaseAsset").Preload("QuoteAsset").Order("symbol ASC").Find(&markets).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch markets"})
+		return
+	}
+
+	c.JSON(http.StatusOK, markets)
+}
+
+// GetTickers returns the ticker of every asset the price feed quotes
+func (h *MarketHandler) GetTickers(c *gin.Context) {
+	tickers, err := h.tickers()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch tickers"})
+		return
+	}
+
+	c.JSON(http.StatusOK, tickers)
+}
+
+func (h *MarketHandler) GetTicker(c *gin.Context) {
+	symbol := c.Param("symbol")
+
+	var asset models.Asset
+	if err := h.db.Where("symbol = ?", symbol).First(&asset).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Asset not found"})
+		return
+	}
+
+	tickers, err := h.tickers()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch tickers"})
+		return
+	}
+	for _, ticker := range tickers {
+		if ticker.Symbol == asset.Symbol {
+			c.JSON(http.StatusOK, ticker)
+			return
+		}
+	}
+
+	c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Price unavailable"})
+}
+
+// tickerStats are one asset's aggregated trades over the last 24h
+type tickerStats struct {
+	AssetID     string
+	Open        decimal.Decimal
+	High        decimal.Decimal
+	Low         decimal.Decimal
+	Volume      decimal.Decimal
+	QuoteVolume decimal.Decimal
+	TradeCount  int64
+}
+
+// tickers computes every asset's ticker from the price feed and the last
+// 24h of trades, caching the result briefly in Redis
+func (h *MarketHandler) tickers() ([]models.Ticker, error) {
+	ctx := context.Background()
+
+	if h.redisClient != nil {
+		cached, err := h.redisClient.Get(ctx, tickersCacheKey).Result()
+		if err == nil {
+			var tickers []models.Ticker
+			if err := json.Unmarshal([]byte(cached), &tickers); err == nil {
+				return tickers, nil
+			}
+		}
+	}
+
+	// Cash is what the others are priced in, so it has no ticker
+	var assets []models.Asset
+	if err := h.db.Where("symbol <> ?", wallet.CashSymbol).Order("asset_type ASC, symbol ASC").Find(&assets).Error; err != nil {
+		return nil, fmt.Errorf("failed to fetch assets: %w", err)
+	}
+	cash, err := wallet.CashAsset(h.db)
+	if err != nil {
+		return nil, err
+	}
+
+	// Count each fill once: book fills also write a MAKER trade for the
+	// resting side. Only trades priced in cash are comparable with the feed.
+	now := time.Now().UTC()
+	window := h.db.Model(&models.Trade{}).
+		Where("created_at >= ? AND quote_asset_id = ? AND (liquidity IS NULL OR liquidity <> ?)", now.Add(-24*time.Hour), cash.ID, exchange.LiquidityMaker)
+
+	var stats []tickerStats
+	if err := window.Session(&gorm.Session{}).
+		Select("asset_id, MAX(price) AS high, MIN(price) AS low, SUM(quantity) AS volume, SUM(total_amount) AS quote_volume, COUNT(*) AS trade_count").
+		Group("asset_id").
+		Scan(&stats).Error; err != nil {
+		return nil, fmt.Errorf("failed to aggregate trades: %w", err)
+	}
+
+	var opens []tickerStats
+	if err := window.Session(&gorm.Session{}).
+		Select("DISTINCT ON (asset_id) asset_id, price AS open").
+		Order("asset_id, created_at ASC").
+		Scan(&opens).Error; err != nil {
+		return nil, fmt.Errorf("failed to fetch opening trades: %w", err)
+	}
+
+	byAsset := make(map[string]tickerStats, len(stats))
+	for _, s := range stats {
+		byAsset[s.AssetID] = s
+	}
+	for _, o := range opens {
+		s := byAsset[o.AssetID]
+		s.Open = o.Open
+		byAsset[o.AssetID] = s
+	}
+
+	tickers := []models.Ticker{}
+	for _, asset := range assets {
+		price, err := h.priceFeed.Price(asset.Symbol)
+		if err != nil {
+			log.Printf("Warning: No price for %s ticker: %v", asset.Symbol, err)
+			continue
+		}
+		tickers = append(tickers, buildTicker(asset, utils.FeedPrice(price, asset.TickSize), byAsset[asset.ID.String()], now))
+	}
+
+	if h.redisClient != nil {
+		if data, err := json.Marshal(tickers); err == nil {
+			h.redisClient.Set(ctx, tickersCacheKey, data, redisClient.TickerCacheTTL)
+		}
+	}
+
+	return tickers, nil
+}
+
+// buildTicker combines the current price with 24h trade statistics. With
+// no trades in the window the price itself is the open, high and low.
+func buildTicker(asset models.Asset, price decimal.Decimal, stats tickerStats, now time.Time) models.Ticker {
+	ticker := models.Ticker{
+		Symbol:         asset.Symbol,
+		AssetType:      asset.AssetType,
+		Price:          price,
+		Open24h:        price,
+		High24h:        price,
+		Low24h:         price,
+		Volume24h:      stats.Volume,
+		QuoteVolume24h: stats.QuoteVolume,
+		TradeCount24h:  stats.TradeCount,
+		Timestamp:      now,
+	}
+
+	if stats.TradeCount > 0 {
+		ticker.Open24h = stats.Open
+		ticker.High24h = decimal.Max(ticker.High24h, stats.High)
+		ticker.Low24h = decimal.Min(ticker.Low24h, stats.Low)
+	}
+
+	ticker.Change24h = price.Sub(ticker.Open24h)
+	ticker.ChangePercent24h = utils.Percent(ticker.Change24h, ticker.Open24h)
+	return ticker
+}
+
+// GetCandles returns OHLCV candles oldest first. When more candles remain
+// in the range, next_from is the from value for the next page.
+func (h *MarketHandler) GetCandles(c *gin.Context) {
+	symbol := c.Query("symbol")
+	if symbol == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Symbol is required"})
+		return
+	}
+
+	interval := c.DefaultQuery("interval", "1h")
+	d, ok := candles.Intervals[interval]
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Interval must be one of 1m, 5m, 1h, 1d"})
+		return
+	}
+
+	to := time.Now().UTC()
+	if v := c.Query("to"); v != "" {
+		t, err := parseTime(v)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid to time"})
+			return
+		}
+		to = t
+	}
+
+	limit := defaultCandleLimit
+	if v := c.Query("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 || n > maxCandleLimit {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Limit must be between 1 and 1000"})
+			return
+		}
+		limit = n
+	}
+
+	from := to.Add(-time.Duration(limit) * d)
+	if v := c.Query("from"); v != "" {
+		t, err := parseTime(v)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid from time"})
+			return
+		}
+		from = t
+	}
+	if !from.Before(to) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "From must be before to"})
+		return
+	}
+
+	var asset models.Asset
+	if err := h.db.Where("symbol = ?", symbol).First(&asset).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Asset not found"})
+		return
+	}
+
+	var bars []models.Candle
+	if err := h.db.Where(&models.Candle{AssetID: asset.ID, Interval: interval}).
+		Where("open_time >= ? AND open_time < ?", from.Truncate(d), to).
+		Order("open_time ASC").
+		Limit(limit).
+		Find(&bars).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch candles"})
+		return
+	}
+
+	response := gin.H{
+		"symbol":   asset.Symbol,
+		"interval": interval,
+		"candles":  bars,
+	}
+	if len(bars) == limit {
+		next := bars[len(bars)-1].OpenTime.Add(d)
+		if next.Before(to) {
+			response["next_from"] = next
+		}
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+// parseTime accepts RFC 3339 timestamps or Unix seconds
+func parseTime(v string) (time.Time, error) {
+	if secs, err := strconv.ParseInt(v, 10, 64); err == nil {
+		return time.Unix(secs, 0).UTC(), nil
+	}
+	return time.Parse(time.RFC3339, v)
+}
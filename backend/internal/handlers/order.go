@@ -0,0 +1,164 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/Enuma3lish/LUNG_CEX/backend/internal/deadman"
+	"github.com/Enuma3lish/LUNG_CEX/backend/internal/exchange"
+	"github.com/Enuma3lish/LUNG_CEX/backend/internal/models"
+	"github.com/gin-gonic/gin"
+	"github.com/go-redis/redis/v8"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+type OrderHandler struct {
+	db          *gorm.DB
+	redisClient *redis.Client
+	engine      *exchange.Engine
+	deadman     *deadman.Switch
+}
+
+func NewOrderHandler(db *gorm.DB, redisClient *redis.Client, engine *exchange.Engine, deadmanSwitch *deadman.Switch) *OrderHandler {
+	return &OrderHandler{
+		db:          db,
+		redisClient: redisClient,
+		engine:      engine,
+		deadman:     deadmanSwitch,
+	}
+}
+
+// GetOpenOrders returns the user's resting orders, optionally on one market
+func (h *OrderHandler) GetOpenOrders(c *gin.Context) {
+	userID := c.MustGet("user_id").(uuid.UUID)
+
+	query := h.db.Preload("Market").
+		Where("user_id = ? AND status IN ?", userID, []string{exchange.StatusOpen, exchange.StatusPartiallyFilled})
+	if symbol := c.Query("symbol"); symbol != "" {
+		var market models.Market
+		if err := h.db.Where("symbol = ?", symbol).First(&market).Error; err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Market not found"})
+			return
+		}
+		query = query.Where("market_id = ?", market.ID)
+	}
+
+	var orders []models.Order
+	if err := query.Order("created_at DESC").Find(&orders).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch orders"})
+		return
+	}
+
+	c.JSON(http.StatusOK, orders)
+}
+
+// CancelOrder cancels a resting order and releases its reserved funds
+func (h *OrderHandler) CancelOrder(c *gin.Context) {
+	userID := c.MustGet("user_id").(uuid.UUID)
+
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid order id"})
+		return
+	}
+
+	order, err := h.engine.CancelOrder(userID, id)
+	if err != nil {
+		respondOrderError(c, err)
+		return
+	}
+	h.invalidatePortfolio(c, userID)
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Order cancelled",
+		"order":   order,
+	})
+}
+
+// CancelAll cancels every resting order, or only those on the market
+// given by symbol
+func (h *OrderHandler) CancelAll(c *gin.Context) {
+	userID := c.MustGet("user_id").(uuid.UUID)
+
+	orders, err := h.engine.CancelAll(userID, c.Query("symbol"))
+	if len(orders) > 0 {
+		h.invalidatePortfolio(c, userID)
+	}
+	if err != nil {
+		respondOrderError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": fmt.Sprintf("%d orders cancelled", len(orders)),
+		"orders":  orders,
+	})
+}
+
+// AmendOrder changes a resting order's price or quantity
+func (h *OrderHandler) AmendOrder(c *gin.Context) {
+	userID := c.MustGet("user_id").(uuid.UUID)
+
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid order id"})
+		return
+	}
+
+	var req models.AmendOrderRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	order, err := h.engine.AmendOrder(userID, id, req)
+	if err != nil {
+		respondOrderError(c, err)
+		return
+	}
+	h.invalidatePortfolio(c, userID)
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Order amended",
+		"order":   order,
+	})
+}
+
+// CancelAfter arms or refreshes the dead man's switch: unless called again
+// within timeout seconds, all of the user's resting and conditional orders
+// are cancelled. A zero timeout disarms it.
+func (h *OrderHandler) CancelAfter(c *gin.Context) {
+	userID := c.MustGet("user_id").(uuid.UUID)
+
+	var req models.CancelAfterRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	timer, err := h.deadman.Arm(userID, time.Duration(*req.Timeout)*time.Second)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to set cancel timer"})
+		return
+	}
+	if timer == nil {
+		c.JSON(http.StatusOK, gin.H{"message": "Cancel-after disarmed"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":    "Cancel-after armed",
+		"timeout":    timer.Timeout,
+		"trigger_at": timer.TriggerAt,
+		"cancels":    "Resting orders and conditional orders; take-profits and stop-losses on futures positions stay armed",
+	})
+}
+
+func (h *OrderHandler) invalidatePortfolio(c *gin.Context, userID uuid.UUID) {
+	if h.redisClient != nil {
+		h.redisClient.Del(c, fmt.Sprintf("portfolio:%s", userID.String()))
+		h.redisClient.Del(c, fmt.Sprintf("holdings:%s", userID.String()))
+	}
+}
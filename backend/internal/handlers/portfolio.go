@@ -5,26 +5,30 @@ import (
 	"encoding/json"
 	"fmt"
 	"net/http"
-	"time"
 
 	"github.com/Enuma3lish/LUNG_CEX/backend/internal/models"
+	"github.com/Enuma3lish/LUNG_CEX/backend/internal/wallet"
+	"github.com/Enuma3lish/LUNG_CEX/backend/pkg/pricefeed"
 	redisClient "github.com/Enuma3lish/LUNG_CEX/backend/pkg/redis"
 	"github.com/Enuma3lish/LUNG_CEX/backend/pkg/utils"
 	"github.com/gin-gonic/gin"
 	"github.com/go-redis/redis/v8"
 	"github.com/google/uuid"
+	"github.com/shopspring/decimal"
 	"gorm.io/gorm"
 )
 
 type PortfolioHandler struct {
 	db          *gorm.DB
 	redisClient *redis.Client
+	priceFeed   pricefeed.PriceFeed
 }
 
-func NewPortfolioHandler(db *gorm.DB, redisClientInstance *redis.Client) *PortfolioHandler {
+func NewPortfolioHandler(db *gorm.DB, redisClientInstance *redis.Client, priceFeed pricefeed.PriceFeed) *PortfolioHandler {
 	return &PortfolioHandler{
 		db:          db,
 		redisClient: redisClientInstance,
+		priceFeed:   priceFeed,
 	}
 }
 
@@ -45,36 +49,41 @@ func (h *PortfolioHandler) GetPortfolio(c *gin.Context) {
 		}
 	}
 
-	// Get user
-	var user models.User
-	if err := h.db.First(&user, userID).Error; err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
-		return
-	}
-
-	// Get holdings
-	var holdings []models.Holding
-	if err := h.db.Preload("Asset").Where("user_id = ?", userID).Find(&holdings).Error; err != nil {
+	wallets, err := wallet.List(h.db, userID)
+	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch holdings"})
 		return
 	}
 
-	// Calculate portfolio value
-	totalValue := user.Balance
+	// Calculate portfolio value in USD
+	cash := decimal.Zero
+	totalValue := decimal.Zero
 	holdingsWithDetails := []models.HoldingWithDetails{}
 
-	for _, holding := range holdings {
-		// Get current price (mock prices for now)
-		currentPrice := utils.GetMockPrice(holding.Asset.Symbol)
+	for _, w := range wallets {
+		if w.Asset.Symbol == wallet.CashSymbol {
+			cash = w.Balance
+			totalValue = totalValue.Add(w.Balance)
+			continue
+		}
+		if w.Balance.IsZero() {
+			continue
+		}
 
-		value := holding.Quantity * currentPrice
-		totalValue += value
+		currentPrice, err := h.usdPrice(w.Asset)
+		if err != nil {
+			c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Price unavailable"})
+			return
+		}
 
-		pnl := (currentPrice - holding.AvgPrice) * holding.Quantity
-		pnlPercent := ((currentPrice - holding.AvgPrice) / holding.AvgPrice) * 100
+		value := utils.RoundCents(w.Balance.Mul(currentPrice))
+		totalValue = totalValue.Add(value)
+
+		pnl := utils.RoundCents(currentPrice.Sub(w.AvgPrice).Mul(w.Balance))
+		pnlPercent := utils.Percent(currentPrice.Sub(w.AvgPrice), w.AvgPrice)
 
 		holdingsWithDetails = append(holdingsWithDetails, models.HoldingWithDetails{
-			Holding:      holding,
+			Wallet:       w,
 			CurrentPrice: currentPrice,
 			Value:        value,
 			PnL:          pnl,
@@ -82,12 +91,12 @@ func (h *PortfolioHandler) GetPortfolio(c *gin.Context) {
 		})
 	}
 
-	// Calculate overall PnL
-	overallPnL := totalValue - 10000.00 // Initial balance was 10000
+	// Calculate overall PnL against the initial deposit
+	overallPnL := totalValue.Sub(wallet.InitialDeposit)
 
 	portfolio := models.PortfolioResponse{
 		TotalValue: totalValue,
-		Cash:       user.Balance,
+		Cash:       cash,
 		Holdings:   holdingsWithDetails,
 		PnL:        overallPnL,
 	}
@@ -101,6 +110,26 @@ func (h *PortfolioHandler) GetPortfolio(c *gin.Context) {
 	c.JSON(http.StatusOK, portfolio)
 }
 
+// usdPrice values one unit of an asset in USD. Assets the feed doesn't
+// quote are valued through their last trade, at the USD price of the
+// market's quote asset.
+func (h *PortfolioHandler) usdPrice(asset models.Asset) (decimal.Decimal, error) {
+	if price, err := pricefeed.USDPrice(h.priceFeed, asset.Symbol); err == nil {
+		return utils.FeedPrice(price, asset.TickSize), nil
+	}
+
+	var trade models.Trade
+	if err := h.db.Preload("QuoteAsset").Where("asset_id = ?", asset.ID).Order("created_at DESC").First(&trade).Error; err != nil {
+		return decimal.Zero, pricefeed.ErrUnknownSymbol
+	}
+	quoteUSD, err := pricefeed.USDPrice(h.priceFeed, trade.QuoteAsset.Symbol)
+	if err != nil {
+		return decimal.Zero, err
+	}
+	return utils.RoundCents(trade.Price.Mul(decimal.NewFromFloat(quoteUSD))), nil
+}
+
+// GetHoldings returns the user's non-cash wallets with a balance
 func (h *PortfolioHandler) GetHoldings(c *gin.Context) {
 	userID := c.MustGet("user_id").(uuid.UUID)
 	ctx := context.Background()
@@ -110,7 +139,7 @@ func (h *PortfolioHandler) GetHoldings(c *gin.Context) {
 	if h.redisClient != nil {
 		cached, err := h.redisClient.Get(ctx, cacheKey).Result()
 		if err == nil {
-			var holdings []models.Holding
+			var holdings []models.Wallet
 			if err := json.Unmarshal([]byte(cached), &holdings); err == nil {
 				c.JSON(http.StatusOK, holdings)
 				return
@@ -119,11 +148,17 @@ func (h *PortfolioHandler) GetHoldings(c *gin.Context) {
 	}
 
 	// Get from database
-	var holdings []models.Holding
-	if err := h.db.Preload("Asset").Where("user_id = ?", userID).Find(&holdings).Error; err != nil {
+	wallets, err := wallet.List(h.db, userID)
+	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch holdings"})
 		return
 	}
+	holdings := []models.Wallet{}
+	for _, w := range wallets {
+		if w.Asset.Symbol != wallet.CashSymbol && !w.Balance.IsZero() {
+			holdings = append(holdings, w)
+		}
+	}
 
 	// Cache the result
 	if h.redisClient != nil {
@@ -133,3 +168,17 @@ func (h *PortfolioHandler) GetHoldings(c *gin.Context) {
 
 	c.JSON(http.StatusOK, holdings)
 }
+
+// GetWallets returns the balance, locked and available amount of each of
+// the user's wallets
+func (h *PortfolioHandler) GetWallets(c *gin.Context) {
+	userID := c.MustGet("user_id").(uuid.UUID)
+
+	wallets, err := wallet.List(h.db, userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch wallets"})
+		return
+	}
+
+	c.JSON(http.StatusOK, wallet.Balances(wallets))
+}
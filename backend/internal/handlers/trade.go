@@ -1,11 +1,14 @@
 package handlers
 
 import (
+	"errors"
 	"fmt"
 	"net/http"
 
+	"github.com/Enuma3lish/LUNG_CEX/backend/internal/anchor"
+	"github.com/Enuma3lish/LUNG_CEX/backend/internal/exchange"
 	"github.com/Enuma3lish/LUNG_CEX/backend/internal/models"
-	"github.com/Enuma3lish/LUNG_CEX/backend/pkg/blockchain"
+	"github.com/Enuma3lish/LUNG_CEX/backend/internal/orderbook"
 	"github.com/gin-gonic/gin"
 	"github.com/go-redis/redis/v8"
 	"github.com/google/uuid"
@@ -13,26 +16,28 @@ import (
 )
 
 type TradeHandler struct {
-	db            *gorm.DB
-	redisClient   *redis.Client
-	solanaClient  *blockchain.SolanaClient
+	db          *gorm.DB
+	redisClient *redis.Client
+	engine      *exchange.Engine
 }
 
-func NewTradeHandler(db *gorm.DB, redisClient *redis.Client) *TradeHandler {
-	solanaClient, err := blockchain.NewSolanaClient()
-	if err != nil {
-		// Log error but continue - blockchain integration is optional
-		fmt.Printf("Warning: Failed to initialize Solana client: %v\n", err)
-	}
-
+func NewTradeHandler(db *gorm.DB, redisClient *redis.Client, engine *exchange.Engine) *TradeHandler {
 	return &TradeHandler{
-		db:           db,
-		redisClient:  redisClient,
-		solanaClient: solanaClient,
+		db:          db,
+		redisClient: redisClient,
+		engine:      engine,
 	}
 }
 
 func (h *TradeHandler) BuyAsset(c *gin.Context) {
+	h.placeOrder(c, orderbook.Buy)
+}
+
+func (h *TradeHandler) SellAsset(c *gin.Context) {
+	h.placeOrder(c, orderbook.Sell)
+}
+
+func (h *TradeHandler) placeOrder(c *gin.Context, side string) {
 	userID := c.MustGet("user_id").(uuid.UUID)
 
 	var req models.TradeRequest
@@ -41,267 +46,157 @@ func (h *TradeHandler) BuyAsset(c *gin.Context) {
 		return
 	}
 
-	// Start transaction
-	tx := h.db.Begin()
-	defer func() {
-		if r := recover(); r != nil {
-			tx.Rollback()
-		}
-	}()
-
-	// Find asset
-	var asset models.Asset
-	if err := tx.Where("symbol = ?", req.AssetSymbol).First(&asset).Error; err != nil {
-		tx.Rollback()
-		c.JSON(http.StatusNotFound, gin.H{"error": "Asset not found"})
-		return
-	}
-
-	// Get user
-	var user models.User
-	if err := tx.First(&user, userID).Error; err != nil {
-		tx.Rollback()
-		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
-		return
-	}
-
-	// Calculate total cost
-	totalCost := req.Quantity * req.Price
-
-	// Check if user has enough balance
-	if user.Balance < totalCost {
-		tx.Rollback()
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Insufficient balance"})
-		return
-	}
-
-	// Deduct balance
-	user.Balance -= totalCost
-	if err := tx.Save(&user).Error; err != nil {
-		tx.Rollback()
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update balance"})
-		return
-	}
-
-	// Record trade on blockchain (async, non-blocking)
-	var solanaSignature string
-	if h.solanaClient != nil {
-		sig, err := h.solanaClient.RecordTradeOnChain(
-			userID,
-			req.AssetSymbol,
-			"BUY",
-			req.Quantity,
-			req.Price,
-		)
-		if err == nil {
-			solanaSignature = sig
-		}
-	}
-
-	// Create trade record
-	trade := models.Trade{
-		UserID:          userID,
-		AssetID:         asset.ID,
-		TradeType:       "BUY",
-		Quantity:        req.Quantity,
-		Price:           req.Price,
-		TotalAmount:     totalCost,
-		SolanaSignature: solanaSignature,
-	}
-
-	if err := tx.Create(&trade).Error; err != nil {
-		tx.Rollback()
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create trade"})
+	exec, err := h.engine.PlaceOrder(userID, side, req)
+	if err != nil {
+		respondOrderError(c, err)
 		return
 	}
 
-	// Update or create holding
-	var holding models.Holding
-	result := tx.Where("user_id = ? AND asset_id = ?", userID, asset.ID).First(&holding)
-
-	if result.Error == gorm.ErrRecordNotFound {
-		// Create new holding
-		holding = models.Holding{
-			UserID:   userID,
-			AssetID:  asset.ID,
-			Quantity: req.Quantity,
-			AvgPrice: req.Price,
-		}
-		if err := tx.Create(&holding).Error; err != nil {
-			tx.Rollback()
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create holding"})
-			return
+	// Invalidate cache for the submitter and every counterparty
+	if h.redisClient != nil {
+		users := map[uuid.UUID]bool{userID: true}
+		for _, trade := range exec.MakerTrades {
+			users[trade.UserID] = true
 		}
-	} else {
-		// Update existing holding (calculate new average price)
-		totalQuantity := holding.Quantity + req.Quantity
-		holding.AvgPrice = ((holding.AvgPrice * holding.Quantity) + (req.Price * req.Quantity)) / totalQuantity
-		holding.Quantity = totalQuantity
-
-		if err := tx.Save(&holding).Error; err != nil {
-			tx.Rollback()
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update holding"})
-			return
+		for id := range users {
+			h.redisClient.Del(c, fmt.Sprintf("portfolio:%s", id.String()))
+			h.redisClient.Del(c, fmt.Sprintf("holdings:%s", id.String()))
 		}
 	}
 
-	// Commit transaction
-	if err := tx.Commit().Error; err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to commit transaction"})
-		return
-	}
-
-	// Invalidate cache
-	if h.redisClient != nil {
-		h.redisClient.Del(c, fmt.Sprintf("portfolio:%s", userID.String()))
-		h.redisClient.Del(c, fmt.Sprintf("holdings:%s", userID.String()))
+	message := "Order placed"
+	switch exec.Order.Status {
+	case exchange.StatusFilled:
+		message = "Trade executed successfully"
+	case exchange.StatusPartiallyFilled:
+		message = "Order partially filled"
+	case exchange.StatusCancelled:
+		// Immediate-or-cancel leftovers are cancelled rather than rested
+		message = "Order cancelled unfilled"
+		if exec.Order.FilledQuantity.IsPositive() {
+			message = "Order partially filled, remainder cancelled"
+		}
 	}
 
 	c.JSON(http.StatusOK, gin.H{
-		"message":           "Trade executed successfully",
-		"trade":             trade,
-		"solana_signature":  solanaSignature,
-		"remaining_balance": user.Balance,
+		"message":           message,
+		"order":             exec.Order,
+		"trades":            exec.Trades,
+		"remaining_balance": exec.Balance,
 	})
 }
 
-func (h *TradeHandler) SellAsset(c *gin.Context) {
-	userID := c.MustGet("user_id").(uuid.UUID)
-
-	var req models.TradeRequest
-	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
-		return
-	}
-
-	// Start transaction
-	tx := h.db.Begin()
-	defer func() {
-		if r := recover(); r != nil {
-			tx.Rollback()
-		}
-	}()
-
-	// Find asset
-	var asset models.Asset
-	if err := tx.Where("symbol = ?", req.AssetSymbol).First(&asset).Error; err != nil {
-		tx.Rollback()
-		c.JSON(http.StatusNotFound, gin.H{"error": "Asset not found"})
-		return
-	}
-
-	// Get user
-	var user models.User
-	if err := tx.First(&user, userID).Error; err != nil {
-		tx.Rollback()
-		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
-		return
-	}
-
-	// Get holding
-	var holding models.Holding
-	if err := tx.Where("user_id = ? AND asset_id = ?", userID, asset.ID).First(&holding).Error; err != nil {
-		tx.Rollback()
+// respondOrderError maps engine errors onto HTTP responses
+func respondOrderError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, exchange.ErrMarketNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Market not found"})
+	case errors.Is(err, exchange.ErrMarketHalted):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Market is not open for trading"})
+	case errors.Is(err, exchange.ErrInsufficientBalance):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Insufficient balance"})
+	case errors.Is(err, exchange.ErrNoHolding):
 		c.JSON(http.StatusBadRequest, gin.H{"error": "No holding found for this asset"})
-		return
-	}
-
-	// Check if user has enough quantity
-	if holding.Quantity < req.Quantity {
-		tx.Rollback()
+	case errors.Is(err, exchange.ErrInsufficientQuantity):
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Insufficient quantity"})
-		return
+	case errors.Is(err, exchange.ErrPriceRequired):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Price is required for limit orders"})
+	case errors.Is(err, exchange.ErrPriceNotAllowed):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Price is only accepted for limit orders"})
+	case errors.Is(err, exchange.ErrInvalidQuantity):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Quantity must be a positive multiple of the lot size"})
+	case errors.Is(err, exchange.ErrInvalidPrice):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Price must be a positive multiple of the tick size"})
+	case errors.Is(err, exchange.ErrBelowMinNotional):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Order value is below the minimum notional"})
+	case errors.Is(err, exchange.ErrInvalidTimeInForce):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Market orders are immediate-or-cancel or fill-or-kill", "code": "INVALID_TIME_IN_FORCE"})
+	case errors.Is(err, exchange.ErrInvalidExpiry):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Expiry must be in the future and is only accepted for GTD orders", "code": "INVALID_EXPIRY"})
+	case errors.Is(err, exchange.ErrPostOnlyNotResting):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Post-only orders must be GTC or GTD limit orders", "code": "POST_ONLY_NOT_RESTING"})
+	case errors.Is(err, exchange.ErrPostOnlyWouldTake):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Post-only order would take liquidity", "code": "POST_ONLY_WOULD_TAKE"})
+	case errors.Is(err, exchange.ErrFillOrKill):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Fill-or-kill order cannot be filled in full", "code": "FOK_NOT_FILLED"})
+	case errors.Is(err, exchange.ErrReduceOnly):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Reduce-only orders can only sell an existing holding", "code": "REDUCE_ONLY"})
+	case errors.Is(err, exchange.ErrDuplicateClientID):
+		c.JSON(http.StatusConflict, gin.H{"error": "Client order ID is already in use"})
+	case errors.Is(err, exchange.ErrOrderNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Order not found"})
+	case errors.Is(err, exchange.ErrOrderNotOpen):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Order is not open"})
+	case errors.Is(err, exchange.ErrNothingToAmend):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Amendment must change the price or quantity"})
+	case errors.Is(err, exchange.ErrAmendBelowFilled):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Amended quantity must exceed the filled quantity"})
+	case errors.Is(err, exchange.ErrAmendWouldCross):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Amended price would match resting orders"})
+	case errors.Is(err, exchange.ErrPriceUnavailable):
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Price unavailable"})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to execute order"})
 	}
+}
 
-	// Calculate total proceeds
-	totalProceeds := req.Quantity * req.Price
+func (h *TradeHandler) GetTradeHistory(c *gin.Context) {
+	userID := c.MustGet("user_id").(uuid.UUID)
 
-	// Add to balance
-	user.Balance += totalProceeds
-	if err := tx.Save(&user).Error; err != nil {
-		tx.Rollback()
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update balance"})
+	var trades []models.Trade
+	if err := h.db.Preload("Market").Preload("Asset").Preload("QuoteAsset").Preload("Anchor").Where("user_id = ?", userID).Order("created_at DESC").Limit(100).Find(&trades).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch trade history"})
 		return
 	}
 
-	// Record trade on blockchain
-	var solanaSignature string
-	if h.solanaClient != nil {
-		sig, err := h.solanaClient.RecordTradeOnChain(
-			userID,
-			req.AssetSymbol,
-			"SELL",
-			req.Quantity,
-			req.Price,
-		)
-		if err == nil {
-			solanaSignature = sig
-		}
-	}
+	c.JSON(http.StatusOK, trades)
+}
 
-	// Create trade record
-	trade := models.Trade{
-		UserID:          userID,
-		AssetID:         asset.ID,
-		TradeType:       "SELL",
-		Quantity:        req.Quantity,
-		Price:           req.Price,
-		TotalAmount:     totalProceeds,
-		SolanaSignature: solanaSignature,
-	}
+// GetTradeAnchor returns the progress of recording one of the user's trades
+// on Solana
+func (h *TradeHandler) GetTradeAnchor(c *gin.Context) {
+	userID := c.MustGet("user_id").(uuid.UUID)
 
-	if err := tx.Create(&trade).Error; err != nil {
-		tx.Rollback()
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create trade"})
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid trade id"})
 		return
 	}
 
-	// Update holding
-	holding.Quantity -= req.Quantity
-
-	if holding.Quantity == 0 {
-		// Delete holding if quantity is zero
-		if err := tx.Delete(&holding).Error; err != nil {
-			tx.Rollback()
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete holding"})
-			return
-		}
-	} else {
-		if err := tx.Save(&holding).Error; err != nil {
-			tx.Rollback()
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update holding"})
-			return
-		}
-	}
-
-	// Commit transaction
-	if err := tx.Commit().Error; err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to commit transaction"})
+	var trade models.Trade
+	if err := h.db.Where("id = ? AND user_id = ?", id, userID).First(&trade).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Trade not found"})
 		return
 	}
 
-	// Invalidate cache
-	if h.redisClient != nil {
-		h.redisClient.Del(c, fmt.Sprintf("portfolio:%s", userID.String()))
-		h.redisClient.Del(c, fmt.Sprintf("holdings:%s", userID.String()))
+	var entry models.TradeOutbox
+	if err := h.db.Where("trade_id = ?", trade.ID).First(&entry).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Trade is not queued for anchoring"})
+		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{
-		"message":           "Trade executed successfully",
-		"trade":             trade,
-		"solana_signature":  solanaSignature,
-		"remaining_balance": user.Balance,
-	})
+	c.JSON(http.StatusOK, entry)
 }
 
-func (h *TradeHandler) GetTradeHistory(c *gin.Context) {
-	userID := c.MustGet("user_id").(uuid.UUID)
-
-	var trades []models.Trade
-	if err := h.db.Preload("Asset").Where("user_id = ?", userID).Order("created_at DESC").Limit(100).Find(&trades).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch trade history"})
+// GetTradeProof returns the Merkle inclusion proof tying a trade to a root
+// anchored on Solana. It is public, so anyone given a trade id can check
+// the trade was anchored.
+func (h *TradeHandler) GetTradeProof(c *gin.Context) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid trade id"})
 		return
 	}
 
-	c.JSON(http.StatusOK, trades)
+	proof, err := anchor.LoadProof(h.db, id)
+	switch {
+	case errors.Is(err, anchor.ErrTradeNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Trade not found"})
+	case errors.Is(err, anchor.ErrNotBatched):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Trade is not in an anchoring batch yet"})
+	case err != nil:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load proof"})
+	default:
+		c.JSON(http.StatusOK, proof)
+	}
 }
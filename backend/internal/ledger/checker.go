@@ -0,0 +1,204 @@
+package ledger
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"github.com/Enuma3lish/LUNG_CEX/backend/internal/models"
+	"github.com/google/uuid"
+	"github.com/shopspring/decimal"
+	"gorm.io/gorm"
+)
+
+const defaultCheckInterval = time.Hour
+
+// Mismatch is a user balance that differs from the sum of its postings
+type Mismatch struct {
+	UserID  uuid.UUID
+	Asset   string
+	Balance decimal.Decimal
+	Ledger  decimal.Decimal
+}
+
+// Report is the outcome of an invariant check
+type Report struct {
+	Users             int
+	Mismatches        []Mismatch
+	UnbalancedEntries []uuid.UUID
+}
+
+// OK reports whether every invariant held
+func (r Report) OK() bool {
+	return len(r.Mismatches) == 0 && len(r.UnbalancedEntries) == 0
+}
+
+// walletSum is the sum of one user's postings in one asset
+type walletSum struct {
+	UserID uuid.UUID
+	Asset  string
+	Total  decimal.Decimal
+}
+
+// Check proves the ledger's invariants: every journal entry balances per
+// asset, and every user wallet's balance equals the sum of its postings.
+// It reads one repeatable-read snapshot, so trades committing mid-check
+// can't show up as mismatches.
+func Check(db *gorm.DB) (Report, error) {
+	var report Report
+	err := db.Transaction(func(tx *gorm.DB) error {
+		var err error
+		report, err = check(tx)
+		return err
+	}, &sql.TxOptions{Isolation: sql.LevelRepeatableRead, ReadOnly: true})
+	return report, err
+}
+
+func check(db *gorm.DB) (Report, error) {
+	var report Report
+
+	if err := db.Model(&models.Posting{}).
+		Group("entry_id, asset").
+		Having("SUM(amount) <> 0").
+		Distinct().
+		Pluck("entry_id", &report.UnbalancedEntries).Error; err != nil {
+		return report, fmt.Errorf("failed to check journal entries: %w", err)
+	}
+
+	var sums []walletSum
+	if err := db.Model(&models.Posting{}).
+		Select("user_id, asset, SUM(amount) AS total").
+		Where("account = ? AND user_id IS NOT NULL", AccountWallet).
+		Group("user_id, asset").
+		Scan(&sums).Error; err != nil {
+		return report, fmt.Errorf("failed to sum postings: %w", err)
+	}
+	ledger := make(map[uuid.UUID]map[string]decimal.Decimal)
+	for _, s := range sums {
+		if ledger[s.UserID] == nil {
+			ledger[s.UserID] = make(map[string]decimal.Decimal)
+		}
+		ledger[s.UserID][s.Asset] = s.Total
+	}
+
+	var users int64
+	if err := db.Model(&models.User{}).Count(&users).Error; err != nil {
+		return report, fmt.Errorf("failed to count users: %w", err)
+	}
+	report.Users = int(users)
+
+	var wallets []models.Wallet
+	if err := db.Preload("Asset").Find(&wallets).Error; err != nil {
+		return report, fmt.Errorf("failed to fetch wallets: %w", err)
+	}
+
+	seen := make(map[uuid.UUID]map[string]bool)
+	for _, w := range wallets {
+		if seen[w.UserID] == nil {
+			seen[w.UserID] = make(map[string]bool)
+		}
+		seen[w.UserID][w.Asset.Symbol] = true
+		if total := ledger[w.UserID][w.Asset.Symbol]; !total.Equal(w.Balance) {
+			report.Mismatches = append(report.Mismatches, Mismatch{UserID: w.UserID, Asset: w.Asset.Symbol, Balance: w.Balance, Ledger: total})
+		}
+	}
+	// Postings for a wallet that doesn't exist must net to zero
+	for userID, assets := range ledger {
+		for asset, total := range assets {
+			if !seen[userID][asset] && !total.IsZero() {
+				report.Mismatches = append(report.Mismatches, Mismatch{UserID: userID, Asset: asset, Ledger: total})
+			}
+		}
+	}
+
+	return report, nil
+}
+
+// OpenAccounts writes an opening entry for every user who has wallets but
+// no wallet postings yet, so accounts that predate the ledger reconcile
+func OpenAccounts(db *gorm.DB) error {
+	var users []models.User
+	if err := db.Preload("Wallets.Asset").Where("NOT EXISTS (?)",
+		db.Model(&models.Posting{}).Select("1").Where("postings.user_id = users.id AND postings.account = ?", AccountWallet),
+	).Find(&users).Error; err != nil {
+		return fmt.Errorf("failed to find users without ledger accounts: %w", err)
+	}
+
+	opened := 0
+	for _, user := range users {
+		var postings []models.Posting
+		for _, w := range user.Wallets {
+			postings = append(postings,
+				Wallet(user.ID, w.Asset.Symbol, w.Balance),
+				Platform(AccountOpening, w.Asset.Symbol, w.Balance.Neg()),
+			)
+		}
+
+		_, err := Post(db, EntryOpening, user.ID.String(), "Opening balances", postings...)
+		if err == ErrEmptyEntry {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		opened++
+	}
+
+	if opened > 0 {
+		log.Printf("Opened ledger accounts for %d existing users", opened)
+	}
+	return nil
+}
+
+// Checker periodically runs Check and logs any broken invariant
+type Checker struct {
+	db       *gorm.DB
+	interval time.Duration
+}
+
+func NewChecker(db *gorm.DB) *Checker {
+	interval := defaultCheckInterval
+	if v, err := time.ParseDuration(os.Getenv("LEDGER_CHECK_INTERVAL")); err == nil && v > 0 {
+		interval = v
+	}
+
+	return &Checker{db: db, interval: interval}
+}
+
+// Run checks the ledger on every interval until ctx is cancelled
+func (c *Checker) Run(ctx context.Context) {
+	ticker := time.NewTicker(c.interval)
+	defer ticker.Stop()
+
+	log.Printf("Ledger checker started (interval %s)", c.interval)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			c.RunOnce()
+		}
+	}
+}
+
+// RunOnce checks the ledger and logs the result
+func (c *Checker) RunOnce() {
+	report, err := Check(c.db)
+	if err != nil {
+		log.Printf("Warning: Ledger check failed: %v", err)
+		return
+	}
+	for _, id := range report.UnbalancedEntries {
+		log.Printf("Warning: Journal entry %s does not balance", id)
+	}
+	for _, m := range report.Mismatches {
+		log.Printf("Warning: Ledger mismatch for user %s: %s balance %s, postings %s", m.UserID, m.Asset, m.Balance, m.Ledger)
+	}
+	if report.OK() {
+		log.Printf("Ledger check passed for %d users", report.Users)
+	}
+}
@@ -0,0 +1,126 @@
+package ledger
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/Enuma3lish/LUNG_CEX/backend/internal/models"
+	"github.com/Enuma3lish/LUNG_CEX/backend/internal/wallet"
+	"github.com/google/uuid"
+	"github.com/shopspring/decimal"
+	"gorm.io/gorm"
+)
+
+// Journal entry types
+const (
+	EntryOpening     = "OPENING"
+	EntryDeposit     = "DEPOSIT"
+	EntryTrade       = "TRADE"
+	EntryFee         = "FEE"
+	EntryFunding     = "FUNDING"
+	EntryRealizedPnL = "REALIZED_PNL"
+	EntryAdjustment  = "ADJUSTMENT"
+)
+
+// Ledger accounts. AccountWallet is a user's wallet in one asset; the rest
+// are platform accounts and carry no user.
+const (
+	AccountWallet = "WALLET"
+
+	// AccountClearing is the counterparty of every trade leg. Book fills
+	// net to zero in it; platform fills leave the platform's position.
+	AccountClearing    = "CLEARING"
+	AccountOpening     = "OPENING"
+	AccountDeposits    = "DEPOSITS"
+	AccountFees        = "FEES"
+	AccountFunding     = "FUNDING"
+	AccountFuturesPnL  = "FUTURES_PNL"
+	AccountAdjustments = "ADJUSTMENTS"
+)
+
+var (
+	ErrUnbalanced   = errors.New("journal entry does not balance")
+	ErrEmptyEntry   = errors.New("journal entry has no postings")
+	ErrUserNotFound = errors.New("user not found")
+)
+
+// Wallet is a posting to a user's wallet in an asset
+func Wallet(userID uuid.UUID, asset string, amount decimal.Decimal) models.Posting {
+	return models.Posting{UserID: &userID, Account: AccountWallet, Asset: asset, Amount: amount}
+}
+
+// Platform is a posting to one of the platform's accounts
+func Platform(account string, asset string, amount decimal.Decimal) models.Posting {
+	return models.Posting{Account: account, Asset: asset, Amount: amount}
+}
+
+// Post writes a journal entry inside tx. Zero postings are dropped, and
+// the entry is rejected unless each asset's postings sum to zero. It does
+// not touch balances: callers post alongside the change they make.
+func Post(tx *gorm.DB, entryType string, reference string, description string, postings ...models.Posting) (*models.JournalEntry, error) {
+	sums := make(map[string]decimal.Decimal)
+	var kept []models.Posting
+	for _, p := range postings {
+		if p.Amount.IsZero() {
+			continue
+		}
+		sums[p.Asset] = sums[p.Asset].Add(p.Amount)
+		kept = append(kept, p)
+	}
+	if len(kept) == 0 {
+		return nil, ErrEmptyEntry
+	}
+	for asset, sum := range sums {
+		if !sum.IsZero() {
+			return nil, fmt.Errorf("%w: %s postings sum to %s", ErrUnbalanced, asset, sum)
+		}
+	}
+
+	entry := models.JournalEntry{
+		Type:        entryType,
+		Reference:   reference,
+		Description: description,
+		Postings:    kept,
+	}
+	if err := tx.Create(&entry).Error; err != nil {
+		return nil, fmt.Errorf("failed to write journal entry: %w", err)
+	}
+	return &entry, nil
+}
+
+// Adjust credits (or, when negative, debits) a user's wallet in an asset
+// against the adjustments account, recording why. It is the only way
+// operators should change a balance by hand.
+func Adjust(db *gorm.DB, userID uuid.UUID, symbol string, amount decimal.Decimal, reason string) (*models.JournalEntry, error) {
+	tx := db.Begin()
+
+	var user models.User
+	if err := tx.First(&user, userID).Error; err != nil {
+		tx.Rollback()
+		return nil, ErrUserNotFound
+	}
+	var asset models.Asset
+	if err := tx.Where("symbol = ?", symbol).First(&asset).Error; err != nil {
+		tx.Rollback()
+		return nil, wallet.ErrAssetNotFound
+	}
+
+	if _, err := wallet.Adjust(tx, userID, asset.ID, amount, decimal.Zero); err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	entry, err := Post(tx, EntryAdjustment, "", reason,
+		Wallet(userID, asset.Symbol, amount),
+		Platform(AccountAdjustments, asset.Symbol, amount.Neg()),
+	)
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		return nil, fmt.Errorf("failed to commit adjustment: %w", err)
+	}
+	return entry, nil
+}
@@ -0,0 +1,174 @@
+package middleware
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/Enuma3lish/LUNG_CEX/backend/internal/models"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// IdempotencyHeader carries the client's key for a mutating request. A
+// JSON body's client_order_id is used when the header is absent.
+const IdempotencyHeader = "Idempotency-Key"
+
+// defaultIdempotencyTTL is how long a key is remembered; override with
+// IDEMPOTENCY_TTL
+const defaultIdempotencyTTL = 24 * time.Hour
+
+const maxIdempotencyKeyLength = 255
+
+// Idempotency makes mutating requests safe to retry. The first request
+// with a key runs and its response is stored; a retry with the same key
+// and request gets that response back instead of running again. Keys are
+// unique per user, so it must run after AuthMiddleware.
+func Idempotency(db *gorm.DB) gin.HandlerFunc {
+	ttl := defaultIdempotencyTTL
+	if v, err := time.ParseDuration(os.Getenv("IDEMPOTENCY_TTL")); err == nil && v > 0 {
+		ttl = v
+	}
+
+	return func(c *gin.Context) {
+		if c.Request.Method == http.MethodGet {
+			c.Next()
+			return
+		}
+
+		body, err := io.ReadAll(c.Request.Body)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to read request body"})
+			c.Abort()
+			return
+		}
+		c.Request.Body = io.NopCloser(bytes.NewReader(body))
+
+		key := c.GetHeader(IdempotencyHeader)
+		if key == "" {
+			key = clientOrderID(body)
+		}
+		if key == "" {
+			c.Next()
+			return
+		}
+		if len(key) > maxIdempotencyKeyLength {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Idempotency key is too long"})
+			c.Abort()
+			return
+		}
+
+		userID := c.MustGet("user_id").(uuid.UUID)
+		hash := sha256.Sum256(append([]byte(c.Request.Method+" "+c.Request.URL.Path+"\n"), body...))
+		record := models.IdempotencyKey{
+			UserID:      userID,
+			Key:         key,
+			RequestHash: hex.EncodeToString(hash[:]),
+		}
+
+		// Forget this user's expired keys, then claim the key; the unique
+		// index lets exactly one concurrent request win it
+		if err := db.Where("user_id = ? AND created_at < ?", userID, time.Now().Add(-ttl)).Delete(&models.IdempotencyKey{}).Error; err != nil {
+			log.Printf("Warning: Failed to expire idempotency keys: %v", err)
+		}
+		result := db.Clauses(clause.OnConflict{DoNothing: true}).Create(&record)
+		if result.Error != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to record idempotency key"})
+			c.Abort()
+			return
+		}
+
+		if result.RowsAffected == 0 {
+			replay(c, db, record)
+			return
+		}
+
+		recorder := &responseRecorder{ResponseWriter: c.Writer}
+		c.Writer = recorder
+		defer func() {
+			// A handler that panics never answers, so release its key for
+			// a retry before the panic carries on to the recovery handler
+			if r := recover(); r != nil {
+				release(db, record)
+				panic(r)
+			}
+		}()
+		c.Next()
+
+		// Server errors are not remembered, so the request can be retried
+		status := c.Writer.Status()
+		if status >= http.StatusInternalServerError {
+			release(db, record)
+			return
+		}
+		if err := db.Model(&record).Updates(map[string]interface{}{
+			"status_code": status,
+			"response":    recorder.body.String(),
+		}).Error; err != nil {
+			log.Printf("Warning: Failed to store idempotent response: %v", err)
+		}
+	}
+}
+
+// release forgets a claimed key whose request didn't complete
+func release(db *gorm.DB, record models.IdempotencyKey) {
+	if err := db.Delete(&models.IdempotencyKey{}, "id = ?", record.ID).Error; err != nil {
+		log.Printf("Warning: Failed to release idempotency key: %v", err)
+	}
+}
+
+// replay answers a request whose key was already used
+func replay(c *gin.Context, db *gorm.DB, record models.IdempotencyKey) {
+	var stored models.IdempotencyKey
+	if err := db.Where("user_id = ? AND key = ?", record.UserID, record.Key).First(&stored).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load idempotency key"})
+		c.Abort()
+		return
+	}
+
+	switch {
+	case stored.RequestHash != record.RequestHash:
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": "Idempotency key was already used for a different request"})
+	case stored.StatusCode == 0:
+		c.JSON(http.StatusConflict, gin.H{"error": "A request with this idempotency key is still in progress"})
+	default:
+		c.Header("Idempotent-Replayed", "true")
+		c.Data(stored.StatusCode, "application/json; charset=utf-8", []byte(stored.Response))
+	}
+	c.Abort()
+}
+
+// clientOrderID reads client_order_id from a JSON body, if present
+func clientOrderID(body []byte) string {
+	var fields struct {
+		ClientOrderID string `json:"client_order_id"`
+	}
+	if len(body) == 0 || json.Unmarshal(body, &fields) != nil {
+		return ""
+	}
+	return fields.ClientOrderID
+}
+
+// responseRecorder keeps a copy of the response body as it is written
+type responseRecorder struct {
+	gin.ResponseWriter
+	body bytes.Buffer
+}
+
+func (r *responseRecorder) Write(data []byte) (int, error) {
+	r.body.Write(data)
+	return r.ResponseWriter.Write(data)
+}
+
+func (r *responseRecorder) WriteString(s string) (int, error) {
+	r.body.WriteString(s)
+	return r.ResponseWriter.WriteString(s)
+}
@@ -0,0 +1,53 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/Enuma3lish/LUNG_CEX/backend/internal/testdb"
+	"github.com/gin-gonic/gin"
+)
+
+// A handler that panics releases its key, so a retry runs instead of
+// being told the first attempt is still in progress
+func TestIdempotencyReleasesKeyOnPanic(t *testing.T) {
+	db := testdb.Open(t)
+	userID := testdb.User(t, db)
+	gin.SetMode(gin.TestMode)
+
+	calls := 0
+	r := gin.New()
+	r.Use(gin.CustomRecovery(func(c *gin.Context, err interface{}) {
+		c.AbortWithStatus(http.StatusInternalServerError)
+	}))
+	r.Use(func(c *gin.Context) {
+		c.Set("user_id", userID)
+	}, Idempotency(db))
+	r.POST("/orders", func(c *gin.Context) {
+		calls++
+		if calls == 1 {
+			panic("handler failed")
+		}
+		c.JSON(http.StatusCreated, gin.H{"call": calls})
+	})
+
+	send := func() *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/orders", strings.NewReader(`{"quantity":"1"}`))
+		req.Header.Set(IdempotencyHeader, "retry-after-panic")
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	if w := send(); w.Code != http.StatusInternalServerError {
+		t.Fatalf("panicking request returned %d, want 500", w.Code)
+	}
+	if w := send(); w.Code != http.StatusCreated || calls != 2 {
+		t.Fatalf("retry returned %d after %d calls, want 201 from a second call", w.Code, calls)
+	}
+	if w := send(); w.Code != http.StatusCreated || w.Header().Get("Idempotent-Replayed") != "true" || calls != 2 {
+		t.Errorf("second retry returned %d (replayed %q) after %d calls, want the stored 201", w.Code, w.Header().Get("Idempotent-Replayed"), calls)
+	}
+}
@@ -4,82 +4,347 @@ import (
 	"time"
 
 	"github.com/google/uuid"
+	"github.com/shopspring/decimal"
 )
 
+func init() {
+	// Serialize decimals as JSON numbers so API clients keep receiving
+	// numeric fields
+	decimal.MarshalJSONWithoutQuotes = true
+}
+
 // User represents a user in the system
 type User struct {
 	ID        uuid.UUID `gorm:"type:uuid;primary_key;default:gen_random_uuid()" json:"id"`
 	Email     string    `gorm:"unique;not null" json:"email"`
 	Username  string    `gorm:"unique;not null" json:"username"`
 	Password  string    `gorm:"not null" json:"-"`
-	Balance   float64   `gorm:"type:decimal(20,2);default:10000.00" json:"balance"`
 	CreatedAt time.Time `json:"created_at"`
 	UpdatedAt time.Time `json:"updated_at"`
+
+	// Relationships
+	Wallets []Wallet `gorm:"foreignKey:UserID" json:"wallets,omitempty"`
 }
 
 // Asset represents tradeable assets
 type Asset struct {
-	ID        uuid.UUID `gorm:"type:uuid;primary_key;default:gen_random_uuid()" json:"id"`
-	Symbol    string    `gorm:"unique;not null" json:"symbol"` // BTC, USDC, USDT
-	Name      string    `gorm:"not null" json:"name"`
-	AssetType string    `gorm:"not null" json:"asset_type"` // SPOT, FUTURES
-	CreatedAt time.Time `json:"created_at"`
-	UpdatedAt time.Time `json:"updated_at"`
+	ID        uuid.UUID       `gorm:"type:uuid;primary_key;default:gen_random_uuid()" json:"id"`
+	Symbol    string          `gorm:"unique;not null" json:"symbol"` // USD, BTC, USDC, USDT
+	Name      string          `gorm:"not null" json:"name"`
+	AssetType string          `gorm:"not null" json:"asset_type"`                                     // FIAT, SPOT, FUTURES
+	TickSize  decimal.Decimal `gorm:"type:decimal(20,8);not null;default:0.01" json:"tick_size"`      // USD prices are multiples of this
+	LotSize   decimal.Decimal `gorm:"type:decimal(20,8);not null;default:0.00000001" json:"lot_size"` // quantities and amounts are multiples of this
+	CreatedAt time.Time       `json:"created_at"`
+	UpdatedAt time.Time       `json:"updated_at"`
 }
 
-// Holding represents user's asset holdings
-type Holding struct {
-	ID        uuid.UUID `gorm:"type:uuid;primary_key;default:gen_random_uuid()" json:"id"`
-	UserID    uuid.UUID `gorm:"type:uuid;not null" json:"user_id"`
-	AssetID   uuid.UUID `gorm:"type:uuid;not null" json:"asset_id"`
-	Quantity  float64   `gorm:"type:decimal(20,8);not null" json:"quantity"`
-	AvgPrice  float64   `gorm:"type:decimal(20,2);not null" json:"avg_price"`
-	CreatedAt time.Time `json:"created_at"`
-	UpdatedAt time.Time `json:"updated_at"`
+// Market is a trading pair: orders buy or sell the base asset for the
+// quote asset. Prices are in the quote asset.
+type Market struct {
+	ID           uuid.UUID       `gorm:"type:uuid;primary_key;default:gen_random_uuid()" json:"id"`
+	Symbol       string          `gorm:"type:varchar(32);uniqueIndex;not null" json:"symbol"` // BASE-QUOTE, e.g. ETH-BTC
+	BaseAssetID  uuid.UUID       `gorm:"type:uuid;not null;uniqueIndex:idx_market_pair" json:"base_asset_id"`
+	QuoteAssetID uuid.UUID       `gorm:"type:uuid;not null;uniqueIndex:idx_market_pair" json:"quote_asset_id"`
+	TickSize     decimal.Decimal `gorm:"type:decimal(20,8);not null" json:"tick_size"`                    // prices are multiples of this
+	LotSize      decimal.Decimal `gorm:"type:decimal(20,8);not null" json:"lot_size"`                     // quantities are multiples of this
+	MinNotional  decimal.Decimal `gorm:"type:decimal(28,8);not null;default:0" json:"min_notional"`       // smallest quantity * price, in the quote asset
+	MakerFeeRate decimal.Decimal `gorm:"type:decimal(12,8);not null;default:0.001" json:"maker_fee_rate"` // fraction of what the maker receives
+	TakerFeeRate decimal.Decimal `gorm:"type:decimal(12,8);not null;default:0.002" json:"taker_fee_rate"` // fraction of what the taker receives
+	Status       string          `gorm:"type:varchar(20);not null;default:'ACTIVE'" json:"status"`        // ACTIVE, HALTED
+	CreatedAt    time.Time       `json:"created_at"`
+	UpdatedAt    time.Time       `json:"updated_at"`
+
+	// Relationships
+	BaseAsset  Asset `gorm:"foreignKey:BaseAssetID" json:"base_asset,omitempty"`
+	QuoteAsset Asset `gorm:"foreignKey:QuoteAssetID" json:"quote_asset,omitempty"`
+}
+
+// Wallet is a user's balance of one asset. Locked is the part reserved by
+// resting orders or futures margin; the rest is available.
+type Wallet struct {
+	ID        uuid.UUID       `gorm:"type:uuid;primary_key;default:gen_random_uuid()" json:"id"`
+	UserID    uuid.UUID       `gorm:"type:uuid;not null;uniqueIndex:idx_wallet_owner" json:"user_id"`
+	AssetID   uuid.UUID       `gorm:"type:uuid;not null;uniqueIndex:idx_wallet_owner" json:"asset_id"`
+	Balance   decimal.Decimal `gorm:"type:decimal(28,8);not null;default:0" json:"balance"`
+	Locked    decimal.Decimal `gorm:"type:decimal(28,8);not null;default:0" json:"locked"`
+	AvgPrice  decimal.Decimal `gorm:"type:decimal(20,2);not null;default:0" json:"avg_price"` // average USD cost of the balance
+	CreatedAt time.Time       `json:"created_at"`
+	UpdatedAt time.Time       `json:"updated_at"`
 
 	// Relationships
-	User  User  `gorm:"foreignKey:UserID" json:"user,omitempty"`
 	Asset Asset `gorm:"foreignKey:AssetID" json:"asset,omitempty"`
 }
 
+// Available is the part of the balance not reserved
+func (w Wallet) Available() decimal.Decimal {
+	return w.Balance.Sub(w.Locked)
+}
+
+// Order represents an order submitted to the order book
+type Order struct {
+	ID             uuid.UUID       `gorm:"type:uuid;primary_key;default:gen_random_uuid()" json:"id"`
+	UserID         uuid.UUID       `gorm:"type:uuid;not null;index;uniqueIndex:idx_order_client_id,priority:1" json:"user_id"`
+	MarketID       uuid.UUID       `gorm:"type:uuid;index" json:"market_id"`
+	AssetID        uuid.UUID       `gorm:"type:uuid;not null" json:"asset_id"`
+	QuoteAssetID   uuid.UUID       `gorm:"type:uuid" json:"quote_asset_id"`            // the asset the price is in
+	Side           string          `gorm:"not null" json:"side"`                       // BUY, SELL
+	OrderType      string          `gorm:"not null;default:'LIMIT'" json:"order_type"` // LIMIT, MARKET
+	Price          decimal.Decimal `gorm:"type:decimal(20,8);not null" json:"price"`   // limit price, or worst accepted price for MARKET
+	Quantity       decimal.Decimal `gorm:"type:decimal(20,8);not null" json:"quantity"`
+	FilledQuantity decimal.Decimal `gorm:"type:decimal(20,8);not null;default:0" json:"filled_quantity"`
+	Status         string          `gorm:"not null;default:'OPEN';index" json:"status"`                 // OPEN, PARTIALLY_FILLED, FILLED, CANCELLED, EXPIRED
+	TimeInForce    string          `gorm:"type:varchar(3);not null;default:'GTC'" json:"time_in_force"` // GTC, IOC, FOK, GTD
+	ExpiresAt      *time.Time      `gorm:"index" json:"expires_at,omitempty"`                           // GTD orders only
+	PostOnly       bool            `gorm:"not null;default:false" json:"post_only"`
+	ReduceOnly     bool            `gorm:"not null;default:false" json:"reduce_only"`
+	ClientOrderID  *string         `gorm:"type:varchar(64);uniqueIndex:idx_order_client_id,priority:2" json:"client_order_id,omitempty"` // unique per user
+	RequeuedAt     *time.Time      `json:"requeued_at,omitempty"`                                                                        // when an amendment last sent the order to the back of its queue
+	CreatedAt      time.Time       `json:"created_at"`
+	UpdatedAt      time.Time       `json:"updated_at"`
+
+	// Relationships
+	User       User   `gorm:"foreignKey:UserID" json:"user,omitempty"`
+	Market     Market `gorm:"foreignKey:MarketID" json:"market,omitempty"`
+	Asset      Asset  `gorm:"foreignKey:AssetID" json:"asset,omitempty"`
+	QuoteAsset Asset  `gorm:"foreignKey:QuoteAssetID" json:"quote_asset,omitempty"`
+}
+
 // Trade represents a trade transaction
 type Trade struct {
-	ID              uuid.UUID `gorm:"type:uuid;primary_key;default:gen_random_uuid()" json:"id"`
-	UserID          uuid.UUID `gorm:"type:uuid;not null" json:"user_id"`
-	AssetID         uuid.UUID `gorm:"type:uuid;not null" json:"asset_id"`
-	TradeType       string    `gorm:"not null" json:"trade_type"` // BUY, SELL
-	Quantity        float64   `gorm:"type:decimal(20,8);not null" json:"quantity"`
-	Price           float64   `gorm:"type:decimal(20,2);not null" json:"price"`
-	TotalAmount     float64   `gorm:"type:decimal(20,2);not null" json:"total_amount"`
-	SolanaSignature string    `gorm:"type:varchar(255)" json:"solana_signature"`
-	CreatedAt       time.Time `json:"created_at"`
+	ID              uuid.UUID       `gorm:"type:uuid;primary_key;default:gen_random_uuid()" json:"id"`
+	UserID          uuid.UUID       `gorm:"type:uuid;not null" json:"user_id"`
+	MarketID        uuid.UUID       `gorm:"type:uuid;index" json:"market_id"`
+	AssetID         uuid.UUID       `gorm:"type:uuid;not null" json:"asset_id"`
+	QuoteAssetID    uuid.UUID       `gorm:"type:uuid;index" json:"quote_asset_id"`
+	OrderID         *uuid.UUID      `gorm:"type:uuid;index" json:"order_id,omitempty"`
+	TradeType       string          `gorm:"not null" json:"trade_type"`        // BUY, SELL
+	Liquidity       string          `gorm:"type:varchar(10)" json:"liquidity"` // MAKER, TAKER
+	Quantity        decimal.Decimal `gorm:"type:decimal(20,8);not null" json:"quantity"`
+	Price           decimal.Decimal `gorm:"type:decimal(20,8);not null" json:"price"`              // in the quote asset
+	TotalAmount     decimal.Decimal `gorm:"type:decimal(28,8);not null" json:"total_amount"`       // in the quote asset
+	Fee             decimal.Decimal `gorm:"type:decimal(28,8);not null;default:0" json:"fee"`      // in the fee asset
+	FeeRate         decimal.Decimal `gorm:"type:decimal(12,8);not null;default:0" json:"fee_rate"` // after the user's tier discount
+	FeeAssetID      uuid.UUID       `gorm:"type:uuid" json:"fee_asset_id"`                         // the asset received: base for a buy, quote for a sell
+	SolanaSignature string          `gorm:"type:varchar(255)" json:"solana_signature"`
+	AnchorStatus    string          `gorm:"type:varchar(20);index" json:"anchor_status,omitempty"` // PENDING, SENT, CONFIRMED, FINALIZED, EXPIRED, FAILED
+	CreatedAt       time.Time       `json:"created_at"`
 
 	// Relationships
-	User  User  `gorm:"foreignKey:UserID" json:"user,omitempty"`
-	Asset Asset `gorm:"foreignKey:AssetID" json:"asset,omitempty"`
+	User       User         `gorm:"foreignKey:UserID" json:"user,omitempty"`
+	Market     Market       `gorm:"foreignKey:MarketID" json:"market,omitempty"`
+	Asset      Asset        `gorm:"foreignKey:AssetID" json:"asset,omitempty"`
+	QuoteAsset Asset        `gorm:"foreignKey:QuoteAssetID" json:"quote_asset,omitempty"`
+	FeeAsset   Asset        `gorm:"foreignKey:FeeAssetID" json:"fee_asset,omitempty"`
+	Anchor     *TradeOutbox `gorm:"foreignKey:TradeID" json:"anchor,omitempty"`
+}
+
+// TradeOutbox is a trade waiting to be recorded on Solana. It is written in
+// the same transaction as the trade and worked off in the background, so a
+// slow or failing RPC never holds up settlement.
+type TradeOutbox struct {
+	ID            uuid.UUID  `gorm:"type:uuid;primary_key;default:gen_random_uuid()" json:"id"`
+	TradeID       uuid.UUID  `gorm:"type:uuid;not null;uniqueIndex" json:"trade_id"`
+	BatchID       *uuid.UUID `gorm:"type:uuid;index" json:"batch_id,omitempty"` // the Merkle batch the trade was anchored in
+	LeafIndex     int        `gorm:"not null;default:0" json:"leaf_index"`
+	LeafHash      string     `gorm:"type:varchar(64)" json:"leaf_hash,omitempty"`
+	Proof         string     `gorm:"type:text" json:"-"`                                        // JSON inclusion proof from the leaf to the batch's root
+	Status        string     `gorm:"type:varchar(20);not null;default:'PENDING'" json:"status"` // PENDING, SENT, CONFIRMED, FINALIZED, EXPIRED, FAILED
+	Attempts      int        `gorm:"not null;default:0" json:"attempts"`
+	NextAttemptAt time.Time  `gorm:"not null;index" json:"next_attempt_at"`
+	LastError     string     `gorm:"type:text" json:"last_error,omitempty"`
+	Signature     string     `gorm:"type:varchar(255)" json:"signature,omitempty"`
+	SentAt        *time.Time `json:"sent_at,omitempty"`
+	ConfirmedAt   *time.Time `json:"confirmed_at,omitempty"`
+	FinalizedAt   *time.Time `json:"finalized_at,omitempty"`
+	ExpiredAt     *time.Time `json:"expired_at,omitempty"` // when the last signature was found dropped and the send was requeued
+	CreatedAt     time.Time  `json:"created_at"`
+	UpdatedAt     time.Time  `json:"updated_at"`
+
+	// Relationships
+	Trade Trade `gorm:"foreignKey:TradeID" json:"-"`
+}
+
+// AnchorBatch is a Merkle tree over a window of trades. Only its root is
+// recorded on Solana; each trade's outbox entry keeps its inclusion proof.
+type AnchorBatch struct {
+	ID            uuid.UUID  `gorm:"type:uuid;primary_key;default:gen_random_uuid()" json:"id"`
+	MerkleRoot    string     `gorm:"type:varchar(64);not null" json:"merkle_root"`
+	TradeCount    int        `gorm:"not null" json:"trade_count"`
+	Status        string     `gorm:"type:varchar(20);not null;default:'PENDING'" json:"status"` // PENDING, SENT, CONFIRMED, FINALIZED, EXPIRED, FAILED
+	Attempts      int        `gorm:"not null;default:0" json:"attempts"`
+	NextAttemptAt time.Time  `gorm:"not null;index" json:"next_attempt_at"`
+	LastError     string     `gorm:"type:text" json:"last_error,omitempty"`
+	Signature     string     `gorm:"type:varchar(255)" json:"signature,omitempty"`
+	SentAt        *time.Time `json:"sent_at,omitempty"`
+	ConfirmedAt   *time.Time `json:"confirmed_at,omitempty"`
+	FinalizedAt   *time.Time `json:"finalized_at,omitempty"`
+	ExpiredAt     *time.Time `json:"expired_at,omitempty"` // when the last signature was found dropped and the send was requeued
+	CreatedAt     time.Time  `json:"created_at"`
+	UpdatedAt     time.Time  `json:"updated_at"`
 }
 
 // FuturesPosition represents a futures position
 type FuturesPosition struct {
-	ID           uuid.UUID `gorm:"type:uuid;primary_key;default:gen_random_uuid()" json:"id"`
-	UserID       uuid.UUID `gorm:"type:uuid;not null" json:"user_id"`
-	AssetID      uuid.UUID `gorm:"type:uuid;not null" json:"asset_id"`
-	PositionType string    `gorm:"not null" json:"position_type"` // LONG, SHORT
-	Quantity     float64   `gorm:"type:decimal(20,8);not null" json:"quantity"`
-	EntryPrice   float64   `gorm:"type:decimal(20,2);not null" json:"entry_price"`
-	Leverage     int       `gorm:"not null" json:"leverage"`
-	Margin       float64   `gorm:"type:decimal(20,2);not null" json:"margin"`
-	Status       string    `gorm:"not null;default:'OPEN'" json:"status"` // OPEN, CLOSED
-	ClosePrice   *float64  `gorm:"type:decimal(20,2)" json:"close_price,omitempty"`
-	PnL          *float64  `gorm:"type:decimal(20,2)" json:"pnl,omitempty"`
-	CreatedAt    time.Time `json:"created_at"`
-	ClosedAt     *time.Time `json:"closed_at,omitempty"`
+	ID           uuid.UUID        `gorm:"type:uuid;primary_key;default:gen_random_uuid()" json:"id"`
+	UserID       uuid.UUID        `gorm:"type:uuid;not null" json:"user_id"`
+	AssetID      uuid.UUID        `gorm:"type:uuid;not null" json:"asset_id"`
+	PositionType string           `gorm:"not null" json:"position_type"` // LONG, SHORT
+	Quantity     decimal.Decimal  `gorm:"type:decimal(20,8);not null" json:"quantity"`
+	EntryPrice   decimal.Decimal  `gorm:"type:decimal(20,2);not null" json:"entry_price"`
+	Leverage     int              `gorm:"not null" json:"leverage"`
+	Margin       decimal.Decimal  `gorm:"type:decimal(20,2);not null" json:"margin"`
+	Status       string           `gorm:"not null;default:'OPEN'" json:"status"` // OPEN, CLOSED, LIQUIDATED
+	ClosePrice   *decimal.Decimal `gorm:"type:decimal(20,2)" json:"close_price,omitempty"`
+	PnL          *decimal.Decimal `gorm:"type:decimal(20,2)" json:"pnl,omitempty"`
+	CreatedAt    time.Time        `json:"created_at"`
+	ClosedAt     *time.Time       `json:"closed_at,omitempty"`
 
 	// Relationships
 	User  User  `gorm:"foreignKey:UserID" json:"user,omitempty"`
 	Asset Asset `gorm:"foreignKey:AssetID" json:"asset,omitempty"`
 }
 
+// ConditionalOrder rests server-side until the feed price crosses its
+// trigger, then places a spot order or closes a futures position
+type ConditionalOrder struct {
+	ID             uuid.UUID        `gorm:"type:uuid;primary_key;default:gen_random_uuid()" json:"id"`
+	UserID         uuid.UUID        `gorm:"type:uuid;not null;index" json:"user_id"`
+	Kind           string           `gorm:"type:varchar(20);not null" json:"kind"`            // STOP_MARKET, STOP_LIMIT, TAKE_PROFIT, TRAILING_STOP
+	MarketID       *uuid.UUID       `gorm:"type:uuid" json:"market_id,omitempty"`             // spot orders
+	PositionID     *uuid.UUID       `gorm:"type:uuid;index" json:"position_id,omitempty"`     // futures take-profit and stop-loss
+	Side           string           `gorm:"type:varchar(4);not null" json:"side"`             // BUY, SELL; the closing side for a position
+	Quantity       decimal.Decimal  `gorm:"type:decimal(20,8);not null" json:"quantity"`      // a position is always closed in full
+	TriggerPrice   decimal.Decimal  `gorm:"type:decimal(20,8);not null" json:"trigger_price"` // moves with the price for trailing stops
+	Condition      string           `gorm:"type:varchar(5);not null" json:"condition"`        // ABOVE, BELOW: the side of the trigger that fires
+	LimitPrice     *decimal.Decimal `gorm:"type:decimal(20,8)" json:"limit_price,omitempty"`  // STOP_LIMIT only
+	TrailingType   string           `gorm:"type:varchar(10)" json:"trailing_type,omitempty"`  // PERCENT, ABSOLUTE
+	TrailingOffset *decimal.Decimal `gorm:"type:decimal(20,8)" json:"trailing_offset,omitempty"`
+	ExtremePrice   *decimal.Decimal `gorm:"type:decimal(20,8)" json:"extreme_price,omitempty"`              // best price a trailing stop has seen
+	Status         string           `gorm:"type:varchar(20);not null;default:'ACTIVE';index" json:"status"` // ACTIVE, TRIGGERED, CANCELLED, FAILED
+	OrderID        *uuid.UUID       `gorm:"type:uuid" json:"order_id,omitempty"`                            // the spot order placed when triggered
+	Error          string           `gorm:"type:varchar(255)" json:"error,omitempty"`
+	CreatedAt      time.Time        `json:"created_at"`
+	UpdatedAt      time.Time        `json:"updated_at"`
+	TriggeredAt    *time.Time       `json:"triggered_at,omitempty"`
+
+	// Relationships
+	Market   *Market          `gorm:"foreignKey:MarketID" json:"market,omitempty"`
+	Position *FuturesPosition `gorm:"foreignKey:PositionID" json:"position,omitempty"`
+}
+
+// CancelTimer is a user's dead man's switch: unless it is refreshed
+// before TriggerAt, all of the user's resting orders are cancelled
+type CancelTimer struct {
+	UserID    uuid.UUID `gorm:"type:uuid;primary_key" json:"user_id"`
+	Timeout   int       `gorm:"not null" json:"timeout"` // seconds, as last armed
+	TriggerAt time.Time `gorm:"not null;index" json:"trigger_at"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// IdempotencyKey remembers a mutating request by a key the client chose,
+// so that a retry with the same key replays the first response instead of
+// repeating the request
+type IdempotencyKey struct {
+	ID          uuid.UUID `gorm:"type:uuid;primary_key;default:gen_random_uuid()" json:"id"`
+	UserID      uuid.UUID `gorm:"type:uuid;not null;uniqueIndex:idx_idempotency_user_key" json:"user_id"`
+	Key         string    `gorm:"type:varchar(255);not null;uniqueIndex:idx_idempotency_user_key" json:"key"`
+	RequestHash string    `gorm:"type:varchar(64);not null" json:"request_hash"` // method, path and body
+	StatusCode  int       `gorm:"not null;default:0" json:"status_code"`         // 0 while the first request is in flight
+	Response    string    `gorm:"type:text" json:"response"`
+	CreatedAt   time.Time `gorm:"index" json:"created_at"`
+}
+
+// LiquidationEvent records a position force-closed by the liquidation engine
+type LiquidationEvent struct {
+	ID                uuid.UUID       `gorm:"type:uuid;primary_key;default:gen_random_uuid()" json:"id"`
+	PositionID        uuid.UUID       `gorm:"type:uuid;not null;uniqueIndex" json:"position_id"`
+	UserID            uuid.UUID       `gorm:"type:uuid;not null;index" json:"user_id"`
+	AssetID           uuid.UUID       `gorm:"type:uuid;not null" json:"asset_id"`
+	MarkPrice         decimal.Decimal `gorm:"type:decimal(20,2);not null" json:"mark_price"`
+	Equity            decimal.Decimal `gorm:"type:decimal(20,2);not null" json:"equity"`
+	MaintenanceMargin decimal.Decimal `gorm:"type:decimal(20,2);not null" json:"maintenance_margin"`
+	PnL               decimal.Decimal `gorm:"type:decimal(20,2);not null" json:"pnl"`
+	CreatedAt         time.Time       `json:"created_at"`
+
+	// Relationships
+	Asset Asset `gorm:"foreignKey:AssetID" json:"asset,omitempty"`
+}
+
+// FundingRate is a perpetual's funding rate for one funding interval
+type FundingRate struct {
+	ID         uuid.UUID       `gorm:"type:uuid;primary_key;default:gen_random_uuid()" json:"id"`
+	AssetID    uuid.UUID       `gorm:"type:uuid;not null;index" json:"asset_id"`
+	Rate       decimal.Decimal `gorm:"type:decimal(12,8);not null" json:"rate"` // positive: longs pay shorts
+	MarkPrice  decimal.Decimal `gorm:"type:decimal(20,2);not null" json:"mark_price"`
+	IndexPrice decimal.Decimal `gorm:"type:decimal(20,2);not null" json:"index_price"`
+	CreatedAt  time.Time       `gorm:"index" json:"created_at"`
+
+	// Relationships
+	Asset Asset `gorm:"foreignKey:AssetID" json:"asset,omitempty"`
+}
+
+// FundingPayment is a funding amount paid or received by one position
+type FundingPayment struct {
+	ID            uuid.UUID       `gorm:"type:uuid;primary_key;default:gen_random_uuid()" json:"id"`
+	UserID        uuid.UUID       `gorm:"type:uuid;not null;index" json:"user_id"`
+	PositionID    uuid.UUID       `gorm:"type:uuid;not null;index" json:"position_id"`
+	AssetID       uuid.UUID       `gorm:"type:uuid;not null" json:"asset_id"`
+	FundingRateID uuid.UUID       `gorm:"type:uuid;not null" json:"funding_rate_id"`
+	Rate          decimal.Decimal `gorm:"type:decimal(12,8);not null" json:"rate"`
+	Amount        decimal.Decimal `gorm:"type:decimal(20,2);not null" json:"amount"` // positive: received
+	CreatedAt     time.Time       `json:"created_at"`
+
+	// Relationships
+	Asset Asset `gorm:"foreignKey:AssetID" json:"asset,omitempty"`
+}
+
+// Candle is an OHLCV bar for one asset over one interval (1m, 5m, 1h, 1d)
+type Candle struct {
+	ID         uuid.UUID       `gorm:"type:uuid;primary_key;default:gen_random_uuid()" json:"-"`
+	AssetID    uuid.UUID       `gorm:"type:uuid;not null;uniqueIndex:idx_candle_bucket" json:"-"`
+	Interval   string          `gorm:"not null;uniqueIndex:idx_candle_bucket" json:"interval"`
+	OpenTime   time.Time       `gorm:"not null;uniqueIndex:idx_candle_bucket" json:"open_time"`
+	Open       decimal.Decimal `gorm:"type:decimal(20,2);not null" json:"open"`
+	High       decimal.Decimal `gorm:"type:decimal(20,2);not null" json:"high"`
+	Low        decimal.Decimal `gorm:"type:decimal(20,2);not null" json:"low"`
+	Close      decimal.Decimal `gorm:"type:decimal(20,2);not null" json:"close"`
+	Volume     decimal.Decimal `gorm:"type:decimal(20,8);not null;default:0" json:"volume"`
+	TradeCount int             `gorm:"not null;default:0" json:"trade_count"`
+	UpdatedAt  time.Time       `json:"-"`
+}
+
+// JournalEntry is one balanced movement of funds in the double-entry
+// ledger. For every asset its postings sum to zero.
+type JournalEntry struct {
+	ID          uuid.UUID `gorm:"type:uuid;primary_key;default:gen_random_uuid()" json:"id"`
+	Type        string    `gorm:"not null;index" json:"type"`              // OPENING, DEPOSIT, TRADE, FEE, FUNDING, REALIZED_PNL, ADJUSTMENT
+	Reference   string    `gorm:"type:varchar(64);index" json:"reference"` // ID of the trade, position or payment behind the entry
+	Description string    `json:"description"`
+	CreatedAt   time.Time `json:"created_at"`
+
+	// Relationships
+	Postings []Posting `gorm:"foreignKey:EntryID" json:"postings,omitempty"`
+}
+
+// Posting credits (positive) or debits (negative) one ledger account in
+// one asset. User accounts carry the user's ID; platform accounts don't.
+type Posting struct {
+	ID        uuid.UUID       `gorm:"type:uuid;primary_key;default:gen_random_uuid()" json:"id"`
+	EntryID   uuid.UUID       `gorm:"type:uuid;not null;index" json:"entry_id"`
+	UserID    *uuid.UUID      `gorm:"type:uuid;index" json:"user_id,omitempty"`
+	Account   string          `gorm:"not null" json:"account"` // WALLET for users; CLEARING, DEPOSITS, FEES, ... for the platform
+	Asset     string          `gorm:"not null" json:"asset"`   // USD or an asset symbol
+	Amount    decimal.Decimal `gorm:"type:decimal(28,8);not null" json:"amount"`
+	CreatedAt time.Time       `json:"created_at"`
+
+	// BalanceAfter is the account's running balance, filled by ledger queries
+	BalanceAfter *decimal.Decimal `gorm:"->;-:migration" json:"balance_after,omitempty"`
+
+	// Relationships
+	Entry *JournalEntry `gorm:"foreignKey:EntryID" json:"entry,omitempty"`
+}
+
 // DTOs for API requests/responses
 
 type RegisterRequest struct {
@@ -99,29 +364,131 @@ type LoginResponse struct {
 }
 
 type TradeRequest struct {
-	AssetSymbol string  `json:"asset_symbol" binding:"required"`
-	Quantity    float64 `json:"quantity" binding:"required,gt=0"`
-	Price       float64 `json:"price" binding:"required,gt=0"`
+	Market         string          `json:"market"`                                            // e.g. ETH-BTC
+	AssetSymbol    string          `json:"asset_symbol" binding:"required_without=Market"`    // shorthand for the ASSET-QUOTE market
+	QuoteSymbol    string          `json:"quote_symbol"`                                      // USD by default
+	OrderType      string          `json:"order_type" binding:"omitempty,oneof=LIMIT MARKET"` // defaults to LIMIT when a price is given
+	Quantity       decimal.Decimal `json:"quantity"`
+	Price          decimal.Decimal `json:"price"`                                                   // limit price, LIMIT orders only
+	MaxSlippageBps int             `json:"max_slippage_bps" binding:"omitempty,min=1,max=1000"`     // MARKET orders only
+	TimeInForce    string          `json:"time_in_force" binding:"omitempty,oneof=GTC IOC FOK GTD"` // GTC for LIMIT and IOC for MARKET by default
+	ExpiresAt      *time.Time      `json:"expires_at"`                                              // GTD orders only
+	PostOnly       bool            `json:"post_only"`                                               // reject rather than take liquidity
+	ReduceOnly     bool            `json:"reduce_only"`                                             // only sell down an existing holding
+	ClientOrderID  string          `json:"client_order_id" binding:"omitempty,max=64"`              // the client's own reference, unique per user
+}
+
+// CancelAfterRequest arms, refreshes or, with a zero timeout, disarms
+// the dead man's switch
+type CancelAfterRequest struct {
+	Timeout *int `json:"timeout" binding:"required,min=0,max=86400"` // seconds
+}
+
+// AmendOrderRequest changes a resting order. Omitted fields keep their
+// current value.
+type AmendOrderRequest struct {
+	Price    decimal.Decimal `json:"price"`
+	Quantity decimal.Decimal `json:"quantity"` // the new total quantity, including what has filled
+}
+
+// FeeTier is a fee discount earned by trailing 30-day trading volume
+type FeeTier struct {
+	Level     int             `json:"level"`
+	MinVolume decimal.Decimal `json:"min_volume"` // in USD
+	Discount  decimal.Decimal `json:"discount"`   // fraction off each market's rates
+}
+
+// Rate applies the tier's discount to a market's fee rate
+func (t FeeTier) Rate(base decimal.Decimal) decimal.Decimal {
+	return base.Mul(decimal.NewFromInt(1).Sub(t.Discount))
+}
+
+// MarketFees is the rates a user pays on one market
+type MarketFees struct {
+	Market       string          `json:"market"`
+	MakerFeeRate decimal.Decimal `json:"maker_fee_rate"`
+	TakerFeeRate decimal.Decimal `json:"taker_fee_rate"`
+}
+
+// FeeSchedule is a user's volume, tier and resulting fee rates
+type FeeSchedule struct {
+	Volume   decimal.Decimal `json:"volume_30d"`
+	Tier     FeeTier         `json:"tier"`
+	NextTier *FeeTier        `json:"next_tier,omitempty"`
+	Tiers    []FeeTier       `json:"tiers"`
+	Markets  []MarketFees    `json:"markets"`
 }
 
 type FuturesTradeRequest struct {
-	AssetSymbol  string  `json:"asset_symbol" binding:"required"`
-	PositionType string  `json:"position_type" binding:"required,oneof=LONG SHORT"`
-	Quantity     float64 `json:"quantity" binding:"required,gt=0"`
-	Leverage     int     `json:"leverage" binding:"required,min=1,max=100"`
+	AssetSymbol  string          `json:"asset_symbol" binding:"required"`
+	PositionType string          `json:"position_type" binding:"required,oneof=LONG SHORT"`
+	Quantity     decimal.Decimal `json:"quantity"`
+	Leverage     int             `json:"leverage" binding:"required,min=1,max=100"`
+	StopLoss     decimal.Decimal `json:"stop_loss"`   // optional trigger price closing the position at a loss
+	TakeProfit   decimal.Decimal `json:"take_profit"` // optional trigger price closing the position at a profit
+}
+
+// ConditionalOrderRequest creates a conditional order on either a spot
+// market or an open futures position
+type ConditionalOrderRequest struct {
+	Kind           string          `json:"kind" binding:"required,oneof=STOP_MARKET STOP_LIMIT TAKE_PROFIT TRAILING_STOP"`
+	Market         string          `json:"market"` // spot orders, with side and quantity
+	Side           string          `json:"side" binding:"omitempty,oneof=BUY SELL"`
+	Quantity       decimal.Decimal `json:"quantity"`
+	PositionID     string          `json:"position_id" binding:"omitempty,uuid"` // futures positions instead of a market
+	TriggerPrice   decimal.Decimal `json:"trigger_price"`                        // not used by trailing stops
+	LimitPrice     decimal.Decimal `json:"limit_price"`                          // STOP_LIMIT only
+	TrailingType   string          `json:"trailing_type" binding:"omitempty,oneof=PERCENT ABSOLUTE"`
+	TrailingOffset decimal.Decimal `json:"trailing_offset"` // percent of the price, or an amount in the quote asset
+}
+
+type FuturesCloseRequest struct {
+	PositionID string `json:"position_id" binding:"required,uuid"`
+}
+
+type FuturesPositionWithDetails struct {
+	FuturesPosition
+	MarkPrice     decimal.Decimal `json:"mark_price"`
+	UnrealizedPnL decimal.Decimal `json:"unrealized_pnl"`
+	PnLPercent    float64         `json:"pnl_percent"`
 }
 
 type PortfolioResponse struct {
-	TotalValue float64              `json:"total_value"`
-	Cash       float64              `json:"cash"`
+	TotalValue decimal.Decimal      `json:"total_value"`
+	Cash       decimal.Decimal      `json:"cash"`
 	Holdings   []HoldingWithDetails `json:"holdings"`
-	PnL        float64              `json:"pnl"`
+	PnL        decimal.Decimal      `json:"pnl"`
 }
 
+// HoldingWithDetails is a non-cash wallet valued in USD
 type HoldingWithDetails struct {
-	Holding
-	CurrentPrice float64 `json:"current_price"`
-	Value        float64 `json:"value"`
-	PnL          float64 `json:"pnl"`
-	PnLPercent   float64 `json:"pnl_percent"`
+	Wallet
+	CurrentPrice decimal.Decimal `json:"current_price"`
+	Value        decimal.Decimal `json:"value"`
+	PnL          decimal.Decimal `json:"pnl"`
+	PnLPercent   float64         `json:"pnl_percent"`
+}
+
+// WalletBalance is a wallet's balance as shown to its owner
+type WalletBalance struct {
+	Asset     string          `json:"asset"`
+	Balance   decimal.Decimal `json:"balance"`
+	Locked    decimal.Decimal `json:"locked"`
+	Available decimal.Decimal `json:"available"`
+}
+
+// Ticker is an asset's current price and rolling 24h trade statistics
+type Ticker struct {
+	Symbol           string          `json:"symbol"`
+	AssetType        string          `json:"asset_type"`
+	Price            decimal.Decimal `json:"price"`
+	Open24h          decimal.Decimal `json:"open_24h"`
+	High24h          decimal.Decimal `json:"high_24h"`
+	Low24h           decimal.Decimal `json:"low_24h"`
+	Change24h        decimal.Decimal `json:"change_24h"`
+	ChangePercent24h float64         `json:"change_percent_24h"`
+	Volume24h        decimal.Decimal `json:"volume_24h"`       // in the asset
+	QuoteVolume24h   decimal.Decimal `json:"quote_volume_24h"` // in cash
+	TradeCount24h    int64           `json:"trade_count_24h"`
+	Timestamp        time.Time       `json:"timestamp"`
 }
@@ -0,0 +1,245 @@
+package orderbook
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/shopspring/decimal"
+)
+
+const (
+	Buy  = "BUY"
+	Sell = "SELL"
+)
+
+// Order is a resting order as seen by the book
+type Order struct {
+	ID        uuid.UUID
+	UserID    uuid.UUID
+	Side      string
+	Price     decimal.Decimal
+	Remaining decimal.Decimal
+	ExpiresAt *time.Time // when a good-till-date order stops trading
+}
+
+// Fill is a planned execution of a taker against a resting maker order
+type Fill struct {
+	Maker    *Order
+	Quantity decimal.Decimal
+	Price    decimal.Decimal
+}
+
+// Level is the aggregated resting quantity at one price
+type Level struct {
+	Price    decimal.Decimal `json:"price"`
+	Quantity decimal.Decimal `json:"quantity"`
+	Orders   int             `json:"orders"`
+}
+
+type level struct {
+	price  decimal.Decimal
+	orders []*Order
+}
+
+// Book is an in-memory limit order book for a single symbol with
+// price-time priority. Callers hold Lock while planning and applying
+// matches so the book and the database stay in step.
+type Book struct {
+	sync.Mutex
+
+	Symbol  string
+	bids    []*level // best (highest) price first
+	asks    []*level // best (lowest) price first
+	orders  map[uuid.UUID]*Order
+	version uint64 // bumped on every change to the resting orders
+}
+
+func NewBook(symbol string) *Book {
+	return &Book{
+		Symbol: symbol,
+		orders: make(map[uuid.UUID]*Order),
+	}
+}
+
+// Match plans the fills for an incoming order without modifying the book.
+// A limit of zero or less means the order accepts any price.
+func (b *Book) Match(side string, limit decimal.Decimal, quantity decimal.Decimal) []Fill {
+	fills, _ := b.MatchSkipping(side, limit, quantity, nil)
+	return fills
+}
+
+// MatchSkipping plans fills like Match, passing over the resting orders
+// skip reports true for, and returns the orders it passed over so the
+// caller can take them off the book
+func (b *Book) MatchSkipping(side string, limit decimal.Decimal, quantity decimal.Decimal, skip func(*Order) bool) (fills []Fill, skipped []*Order) {
+	levels := b.asks
+	if side == Sell {
+		levels = b.bids
+	}
+
+	remaining := quantity
+	for _, lvl := range levels {
+		if !remaining.IsPositive() || !crosses(side, limit, lvl.price) {
+			break
+		}
+		for _, maker := range lvl.orders {
+			if !remaining.IsPositive() {
+				break
+			}
+			if skip != nil && skip(maker) {
+				skipped = append(skipped, maker)
+				continue
+			}
+			qty := decimal.Min(maker.Remaining, remaining)
+			fills = append(fills, Fill{Maker: maker, Quantity: qty, Price: lvl.price})
+			remaining = remaining.Sub(qty)
+		}
+	}
+	return fills, skipped
+}
+
+// Apply consumes planned fills from the resting makers
+func (b *Book) Apply(fills []Fill) {
+	if len(fills) > 0 {
+		b.version++
+	}
+	for _, f := range fills {
+		f.Maker.Remaining = f.Maker.Remaining.Sub(f.Quantity)
+		if !f.Maker.Remaining.IsPositive() {
+			b.Remove(f.Maker.ID)
+		}
+	}
+}
+
+// Add rests an order at the back of its price level's queue
+func (b *Book) Add(o *Order) {
+	b.orders[o.ID] = o
+	b.version++
+
+	levels := &b.bids
+	if o.Side == Sell {
+		levels = &b.asks
+	}
+
+	i := b.search(o.Side, o.Price)
+	if i < len(*levels) && (*levels)[i].price.Equal(o.Price) {
+		(*levels)[i].orders = append((*levels)[i].orders, o)
+		return
+	}
+
+	*levels = append(*levels, nil)
+	copy((*levels)[i+1:], (*levels)[i:])
+	(*levels)[i] = &level{price: o.Price, orders: []*Order{o}}
+}
+
+// Remove takes an order off the book, reporting whether it was resting
+func (b *Book) Remove(id uuid.UUID) bool {
+	o, ok := b.orders[id]
+	if !ok {
+		return false
+	}
+	delete(b.orders, id)
+	b.version++
+
+	levels := &b.bids
+	if o.Side == Sell {
+		levels = &b.asks
+	}
+
+	i := b.search(o.Side, o.Price)
+	if i >= len(*levels) || !(*levels)[i].price.Equal(o.Price) {
+		return true
+	}
+	lvl := (*levels)[i]
+	for j, r := range lvl.orders {
+		if r.ID == id {
+			lvl.orders = append(lvl.orders[:j], lvl.orders[j+1:]...)
+			break
+		}
+	}
+	if len(lvl.orders) == 0 {
+		*levels = append((*levels)[:i], (*levels)[i+1:]...)
+	}
+	return true
+}
+
+// Resize changes a resting order's remaining quantity in place, keeping
+// its place in the queue, and reports whether it was resting
+func (b *Book) Resize(id uuid.UUID, remaining decimal.Decimal) bool {
+	o, ok := b.orders[id]
+	if !ok {
+		return false
+	}
+	o.Remaining = remaining
+	b.version++
+	return true
+}
+
+// Get returns a resting order by ID
+func (b *Book) Get(id uuid.UUID) (*Order, bool) {
+	o, ok := b.orders[id]
+	return o, ok
+}
+
+// BestBid returns the highest resting bid price
+func (b *Book) BestBid() (decimal.Decimal, bool) {
+	if len(b.bids) == 0 {
+		return decimal.Zero, false
+	}
+	return b.bids[0].price, true
+}
+
+// BestAsk returns the lowest resting ask price
+func (b *Book) BestAsk() (decimal.Decimal, bool) {
+	if len(b.asks) == 0 {
+		return decimal.Zero, false
+	}
+	return b.asks[0].price, true
+}
+
+// Depth aggregates up to n price levels per side, best prices first
+func (b *Book) Depth(n int) (bids []Level, asks []Level) {
+	return aggregate(b.bids, n), aggregate(b.asks, n)
+}
+
+// Version changes whenever the resting orders change, so readers can
+// skip publishing an unchanged book
+func (b *Book) Version() uint64 {
+	return b.version
+}
+
+func aggregate(levels []*level, n int) []Level {
+	if n > len(levels) {
+		n = len(levels)
+	}
+	out := make([]Level, 0, n)
+	for _, lvl := range levels[:n] {
+		agg := Level{Price: lvl.price, Orders: len(lvl.orders)}
+		for _, o := range lvl.orders {
+			agg.Quantity = agg.Quantity.Add(o.Remaining)
+		}
+		out = append(out, agg)
+	}
+	return out
+}
+
+// search returns the index of the level for price on the given side, or
+// the index at which it would be inserted
+func (b *Book) search(side string, price decimal.Decimal) int {
+	if side == Sell {
+		return sort.Search(len(b.asks), func(i int) bool { return b.asks[i].price.GreaterThanOrEqual(price) })
+	}
+	return sort.Search(len(b.bids), func(i int) bool { return b.bids[i].price.LessThanOrEqual(price) })
+}
+
+func crosses(side string, limit decimal.Decimal, price decimal.Decimal) bool {
+	if !limit.IsPositive() {
+		return true
+	}
+	if side == Buy {
+		return price.LessThanOrEqual(limit)
+	}
+	return price.GreaterThanOrEqual(limit)
+}
@@ -0,0 +1,173 @@
+package orderbook
+
+import (
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/shopspring/decimal"
+)
+
+func d(s string) decimal.Decimal {
+	return decimal.RequireFromString(s)
+}
+
+func rest(b *Book, side string, price string, quantity string) *Order {
+	o := &Order{ID: uuid.New(), UserID: uuid.New(), Side: side, Price: d(price), Remaining: d(quantity)}
+	b.Add(o)
+	return o
+}
+
+// fillsEqual compares fills by maker, quantity and price
+func fillsEqual(t *testing.T, got []Fill, want []Fill) {
+	t.Helper()
+	if len(got) != len(want) {
+		t.Fatalf("got %d fills, want %d: %+v", len(got), len(want), got)
+	}
+	for i := range want {
+		if got[i].Maker != want[i].Maker || !got[i].Quantity.Equal(want[i].Quantity) || !got[i].Price.Equal(want[i].Price) {
+			t.Errorf("fill %d: got %s @ %s from %s, want %s @ %s from %s", i,
+				got[i].Quantity, got[i].Price, got[i].Maker.ID, want[i].Quantity, want[i].Price, want[i].Maker.ID)
+		}
+	}
+}
+
+func TestMatchPriceTimePriority(t *testing.T) {
+	b := NewBook("SOL-USD")
+	worse := rest(b, Sell, "101", "1")
+	first := rest(b, Sell, "100", "0.5")
+	second := rest(b, Sell, "100", "2")
+	rest(b, Buy, "99", "5") // the other side never matches a buy
+
+	// Best price first, and oldest first within a price
+	fills := b.Match(Buy, d("101"), d("3"))
+	fillsEqual(t, fills, []Fill{
+		{Maker: first, Quantity: d("0.5"), Price: d("100")},
+		{Maker: second, Quantity: d("2"), Price: d("100")},
+		{Maker: worse, Quantity: d("0.5"), Price: d("101")},
+	})
+}
+
+func TestMatchStopsAtLimit(t *testing.T) {
+	b := NewBook("SOL-USD")
+	near := rest(b, Buy, "100", "1")
+	rest(b, Buy, "99", "1")
+
+	fills := b.Match(Sell, d("99.5"), d("5"))
+	fillsEqual(t, fills, []Fill{{Maker: near, Quantity: d("1"), Price: d("100")}})
+
+	if fills := b.Match(Sell, d("100.01"), d("1")); len(fills) != 0 {
+		t.Errorf("sell above the best bid matched: %+v", fills)
+	}
+}
+
+func TestMatchWithoutLimitSweeps(t *testing.T) {
+	b := NewBook("SOL-USD")
+	a := rest(b, Sell, "100", "1")
+	c := rest(b, Sell, "150", "1")
+
+	fills := b.Match(Buy, decimal.Zero, d("1.5"))
+	fillsEqual(t, fills, []Fill{
+		{Maker: a, Quantity: d("1"), Price: d("100")},
+		{Maker: c, Quantity: d("0.5"), Price: d("150")},
+	})
+}
+
+// Skipped makers are passed over without stopping the walk, and only
+// those the walk reached are reported
+func TestMatchSkipping(t *testing.T) {
+	b := NewBook("SOL-USD")
+	stale := rest(b, Sell, "100", "1")
+	live := rest(b, Sell, "100", "1")
+	next := rest(b, Sell, "101", "1")
+	beyond := rest(b, Sell, "101", "1")
+
+	fills, skipped := b.MatchSkipping(Buy, d("101"), d("1.5"), func(o *Order) bool {
+		return o == stale || o == beyond
+	})
+	fillsEqual(t, fills, []Fill{
+		{Maker: live, Quantity: d("1"), Price: d("100")},
+		{Maker: next, Quantity: d("0.5"), Price: d("101")},
+	})
+	if len(skipped) != 1 || skipped[0] != stale {
+		t.Errorf("skipped %+v, want only the maker ahead of the fills", skipped)
+	}
+}
+
+func TestMatchLeavesBookUnchanged(t *testing.T) {
+	b := NewBook("SOL-USD")
+	maker := rest(b, Sell, "100", "1")
+	version := b.Version()
+
+	b.Match(Buy, d("100"), d("1"))
+	if !maker.Remaining.Equal(d("1")) || b.Version() != version {
+		t.Errorf("Match changed the book: remaining %s, version %d -> %d", maker.Remaining, version, b.Version())
+	}
+	if _, ok := b.Get(maker.ID); !ok {
+		t.Error("Match removed the maker")
+	}
+}
+
+func TestApply(t *testing.T) {
+	b := NewBook("SOL-USD")
+	filled := rest(b, Sell, "100", "1")
+	partial := rest(b, Sell, "100", "2")
+	untouched := rest(b, Sell, "101", "1")
+	version := b.Version()
+
+	b.Apply(b.Match(Buy, d("100"), d("1.5")))
+
+	if b.Version() == version {
+		t.Error("Apply didn't bump the version")
+	}
+	if _, ok := b.Get(filled.ID); ok {
+		t.Error("fully filled maker is still resting")
+	}
+	if got, ok := b.Get(partial.ID); !ok || !got.Remaining.Equal(d("1.5")) {
+		t.Errorf("partially filled maker: resting %v, remaining %s, want 1.5", ok, partial.Remaining)
+	}
+	if !untouched.Remaining.Equal(d("1")) {
+		t.Errorf("maker at a worse price changed to %s", untouched.Remaining)
+	}
+
+	// The partial fill keeps its place at the front of the level
+	ask, _ := b.BestAsk()
+	_, asks := b.Depth(10)
+	if !ask.Equal(d("100")) || len(asks) != 2 || !asks[0].Quantity.Equal(d("1.5")) || asks[0].Orders != 1 {
+		t.Errorf("unexpected asks after apply: %+v", asks)
+	}
+	fills := b.Match(Buy, d("101"), d("2"))
+	fillsEqual(t, fills, []Fill{
+		{Maker: partial, Quantity: d("1.5"), Price: d("100")},
+		{Maker: untouched, Quantity: d("0.5"), Price: d("101")},
+	})
+}
+
+func TestApplyEmptyKeepsVersion(t *testing.T) {
+	b := NewBook("SOL-USD")
+	rest(b, Buy, "100", "1")
+	version := b.Version()
+
+	b.Apply(nil)
+	if b.Version() != version {
+		t.Error("applying no fills bumped the version")
+	}
+}
+
+func TestRemoveAndBest(t *testing.T) {
+	b := NewBook("SOL-USD")
+	best := rest(b, Buy, "100", "1")
+	rest(b, Buy, "99", "1")
+
+	if !b.Remove(best.ID) {
+		t.Fatal("Remove didn't find a resting order")
+	}
+	if b.Remove(best.ID) {
+		t.Error("Remove found an order twice")
+	}
+	if bid, ok := b.BestBid(); !ok || !bid.Equal(d("99")) {
+		t.Errorf("best bid after removing the top level is %s, want 99", bid)
+	}
+	if _, ok := b.BestAsk(); ok {
+		t.Error("empty ask side has a best ask")
+	}
+}
@@ -0,0 +1,159 @@
+// Package solanatest is a stand-in Solana JSON-RPC node for tests and
+// local runs. It serves the methods the trade recorder calls, keeps every
+// transaction it accepts and reports those as finalized.
+package solanatest
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"sync"
+
+	"github.com/gagliardetto/solana-go"
+)
+
+// RentPerByte stands in for the cluster's rent exemption price. An account
+// of n bytes costs (n + 128) * RentPerByte lamports.
+const RentPerByte = 6960
+
+// Node is the RPC node. Transactions must be correctly signed, and pass
+// the node's validate function if it has one.
+type Node struct {
+	validate func(tx *solana.Transaction) error
+
+	mu  sync.Mutex
+	txs []*solana.Transaction
+}
+
+type request struct {
+	ID     json.RawMessage   `json:"id"`
+	Method string            `json:"method"`
+	Params []json.RawMessage `json:"params"`
+}
+
+type rpcError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+// NewNode returns a node that accepts transactions validate allows. A nil
+// validate accepts any signed transaction.
+func NewNode(validate func(tx *solana.Transaction) error) *Node {
+	return &Node{validate: validate}
+}
+
+func (n *Node) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var req request
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid JSON-RPC request", http.StatusBadRequest)
+		return
+	}
+
+	result, err := n.call(req)
+	resp := map[string]interface{}{"jsonrpc": "2.0", "id": req.ID}
+	if err != nil {
+		log.Printf("Rejected %s: %v", req.Method, err)
+		resp["error"] = rpcError{Code: -32002, Message: err.Error()}
+	} else {
+		resp["result"] = result
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+func (n *Node) call(req request) (interface{}, error) {
+	slot := map[string]interface{}{"slot": 1}
+	switch req.Method {
+	case "getLatestBlockhash":
+		return map[string]interface{}{
+			"context": slot,
+			"value": map[string]interface{}{
+				"blockhash":            solana.HashFromBytes(make([]byte, 32)).String(),
+				"lastValidBlockHeight": 150,
+			},
+		}, nil
+
+	case "getMinimumBalanceForRentExemption":
+		var space uint64
+		if len(req.Params) == 0 || json.Unmarshal(req.Params[0], &space) != nil {
+			return nil, errors.New("missing account size")
+		}
+		return (space + 128) * RentPerByte, nil
+
+	case "sendTransaction":
+		var encoded string
+		if len(req.Params) == 0 || json.Unmarshal(req.Params[0], &encoded) != nil {
+			return nil, errors.New("missing transaction")
+		}
+		data, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil {
+			return nil, fmt.Errorf("transaction is not base64: %w", err)
+		}
+		tx, err := n.accept(data)
+		if err != nil {
+			return nil, err
+		}
+		return tx.Signatures[0].String(), nil
+
+	case "getSignatureStatuses":
+		var sigs []string
+		if len(req.Params) == 0 || json.Unmarshal(req.Params[0], &sigs) != nil {
+			return nil, errors.New("missing signatures")
+		}
+		statuses := make([]interface{}, len(sigs))
+		for i, sig := range sigs {
+			if n.Sent(sig) {
+				statuses[i] = map[string]interface{}{"slot": 1, "confirmations": nil, "err": nil, "confirmationStatus": "finalized"}
+			}
+		}
+		return map[string]interface{}{"context": slot, "value": statuses}, nil
+
+	default:
+		return nil, fmt.Errorf("method %s not supported", req.Method)
+	}
+}
+
+// accept decodes and checks a signed transaction, keeping it if it passes
+func (n *Node) accept(data []byte) (*solana.Transaction, error) {
+	tx, err := solana.TransactionFromBytes(data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode transaction: %w", err)
+	}
+	if err := tx.VerifySignatures(); err != nil {
+		return nil, fmt.Errorf("bad signature: %w", err)
+	}
+	if n.validate != nil {
+		if err := n.validate(tx); err != nil {
+			return nil, err
+		}
+	}
+
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.txs = append(n.txs, tx)
+	return tx, nil
+}
+
+// Sent reports whether a transaction with the signature was accepted
+func (n *Node) Sent(sig string) bool {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	for _, tx := range n.txs {
+		if tx.Signatures[0].String() == sig {
+			return true
+		}
+	}
+	return false
+}
+
+// Transactions returns what was accepted so far
+func (n *Node) Transactions() []*solana.Transaction {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	return append([]*solana.Transaction(nil), n.txs...)
+}
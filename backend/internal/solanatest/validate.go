@@ -0,0 +1,107 @@
+package solanatest
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/Enuma3lish/LUNG_CEX/backend/pkg/blockchain"
+	"github.com/Enuma3lish/LUNG_CEX/backend/pkg/merkle"
+	"github.com/gagliardetto/solana-go"
+	"github.com/gagliardetto/solana-go/programs/system"
+)
+
+// Validate returns a check for NewNode that accepts transactions which
+// only record trades, through the TradeRecord program with the given id or
+// the Memo program. Every instruction's bytes must be what those programs
+// expect. A zero program id accepts memos alone.
+func Validate(programID solana.PublicKey) func(tx *solana.Transaction) error {
+	return func(tx *solana.Transaction) error {
+		// Accounts created in this transaction, by the owner and size they
+		// were created with
+		type created struct {
+			owner solana.PublicKey
+			space uint64
+		}
+		accounts := make(map[solana.PublicKey]created)
+
+		var records []blockchain.TradeRecord
+		var memos []string
+		for i, ix := range tx.Message.Instructions {
+			program, err := tx.Message.Program(ix.ProgramIDIndex)
+			if err != nil {
+				return fmt.Errorf("instruction %d: %w", i, err)
+			}
+			metas, err := ix.ResolveInstructionAccounts(&tx.Message)
+			if err != nil {
+				return fmt.Errorf("instruction %d: %w", i, err)
+			}
+
+			switch {
+			case program.Equals(solana.SystemProgramID):
+				decoded, err := system.DecodeInstruction(metas, ix.Data)
+				if err != nil {
+					return fmt.Errorf("instruction %d: %w", i, err)
+				}
+				create, ok := decoded.Impl.(*system.CreateAccount)
+				if !ok {
+					return fmt.Errorf("instruction %d: unexpected system instruction", i)
+				}
+				accounts[create.GetNewAccount().PublicKey] = created{owner: *create.Owner, space: *create.Space}
+
+			case program.Equals(solana.MemoProgramID):
+				memo := string(ix.Data)
+				if !utf8.Valid(ix.Data) || !validMemo(memo) {
+					return fmt.Errorf("instruction %d: malformed trade memo %q", i, memo)
+				}
+				memos = append(memos, memo)
+
+			case !programID.IsZero() && program.Equals(programID):
+				record, err := blockchain.DecodeRecordTrade(ix.Data)
+				if err != nil {
+					return fmt.Errorf("instruction %d: %w", i, err)
+				}
+				if len(metas) != 2 || !metas[0].IsSigner || !metas[1].IsWritable {
+					return fmt.Errorf("instruction %d: expected a signer and a writable record account", i)
+				}
+				account, ok := accounts[metas[1].PublicKey]
+				if !ok || !account.owner.Equals(programID) || account.space != blockchain.RecordSize(record) {
+					return fmt.Errorf("instruction %d: record account is not created for the program with room for the record", i)
+				}
+				records = append(records, record)
+
+			default:
+				return fmt.Errorf("instruction %d: unknown program %s", i, program)
+			}
+		}
+		if len(records)+len(memos) == 0 {
+			return errors.New("transaction records no trade")
+		}
+
+		for _, record := range records {
+			log.Printf("Recorded %s %s %s @ %s for %s", record.TradeType, record.Quantity, record.AssetSymbol, record.Price, record.UserID)
+		}
+		for _, memo := range memos {
+			log.Printf("Recorded memo %s", memo)
+		}
+		return nil
+	}
+}
+
+// validMemo accepts a single trade's memo or a batch's Merkle root
+func validMemo(memo string) bool {
+	fields := strings.Split(memo, ":")
+	switch fields[0] {
+	case "TRADE":
+		return len(fields) == 7
+	case "ANCHOR":
+		if len(fields) != 4 {
+			return false
+		}
+		_, err := merkle.ParseHash(fields[2])
+		return err == nil
+	}
+	return false
+}
@@ -0,0 +1,103 @@
+package solanatest
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Enuma3lish/LUNG_CEX/backend/pkg/blockchain"
+	"github.com/gagliardetto/solana-go"
+	"github.com/gagliardetto/solana-go/programs/system"
+	"github.com/google/uuid"
+	"github.com/shopspring/decimal"
+)
+
+// signed builds a transaction from the instructions, signed by the payer
+// and the record account
+func signed(t *testing.T, payer, account solana.PrivateKey, instructions ...solana.Instruction) *solana.Transaction {
+	t.Helper()
+
+	tx, err := solana.NewTransaction(instructions, solana.Hash{}, solana.TransactionPayer(payer.PublicKey()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := tx.Sign(func(key solana.PublicKey) *solana.PrivateKey {
+		for _, k := range []solana.PrivateKey{payer, account} {
+			if key.Equals(k.PublicKey()) {
+				return &k
+			}
+		}
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	return tx
+}
+
+// Only well-formed memos and RecordTrade instructions written to an
+// account created for the program get through
+func TestValidate(t *testing.T) {
+	payer, account := solana.NewWallet().PrivateKey, solana.NewWallet().PrivateKey
+	programID, otherProgram := solana.NewWallet().PublicKey(), solana.NewWallet().PublicKey()
+
+	record := blockchain.TradeRecord{
+		UserID:      uuid.New(),
+		AssetSymbol: "BTC-USD",
+		TradeType:   "BUY",
+		Quantity:    decimal.RequireFromString("0.5"),
+		Price:       decimal.RequireFromString("45000"),
+		Timestamp:   time.Unix(1700000000, 0).UTC(),
+	}
+	data, err := blockchain.EncodeRecordTrade(record)
+	if err != nil {
+		t.Fatal(err)
+	}
+	space := blockchain.RecordSize(record)
+
+	create := func(owner solana.PublicKey, space uint64) solana.Instruction {
+		return system.NewCreateAccountInstruction((space+128)*RentPerByte, space, owner, payer.PublicKey(), account.PublicKey()).Build()
+	}
+	recordTrade := func(program solana.PublicKey, data []byte) solana.Instruction {
+		return solana.NewInstruction(program, solana.AccountMetaSlice{
+			solana.NewAccountMeta(payer.PublicKey(), false, true),
+			solana.NewAccountMeta(account.PublicKey(), true, false),
+		}, data)
+	}
+	memo := func(text string) solana.Instruction {
+		return solana.NewInstruction(solana.MemoProgramID, solana.AccountMetaSlice{
+			solana.NewAccountMeta(payer.PublicKey(), false, true),
+		}, []byte(text))
+	}
+	anchor := "ANCHOR:5f0c1a4e-8f2b-4d8e-9a57-2c7b3f1d6e90:" + strings.Repeat("ab", 32) + ":3"
+
+	tests := []struct {
+		name         string
+		instructions []solana.Instruction
+		valid        bool
+	}{
+		{"record", []solana.Instruction{create(programID, space), recordTrade(programID, data)}, true},
+		{"trade memo", []solana.Instruction{memo(blockchain.Memo(record))}, true},
+		{"anchor memo", []solana.Instruction{memo(anchor)}, true},
+
+		{"memo missing fields", []solana.Instruction{memo("TRADE:" + record.UserID.String() + ":BTC-USD:BUY")}, false},
+		{"anchor with a bad root", []solana.Instruction{memo("ANCHOR:5f0c1a4e-8f2b-4d8e-9a57-2c7b3f1d6e90:nothex:3")}, false},
+		{"free text memo", []solana.Instruction{memo("hello")}, false},
+		{"record with trailing bytes", []solana.Instruction{create(programID, space), recordTrade(programID, append(data, 0))}, false},
+		{"truncated record", []solana.Instruction{create(programID, space), recordTrade(programID, data[:len(data)-1])}, false},
+		{"record without its account", []solana.Instruction{recordTrade(programID, data)}, false},
+		{"record account owned elsewhere", []solana.Instruction{create(otherProgram, space), recordTrade(programID, data)}, false},
+		{"record account too small", []solana.Instruction{create(programID, space-1), recordTrade(programID, data)}, false},
+		{"unknown program", []solana.Instruction{create(otherProgram, space), recordTrade(otherProgram, data)}, false},
+		{"no trade", []solana.Instruction{create(programID, space)}, false},
+	}
+	validate := Validate(programID)
+	for _, tt := range tests {
+		err := validate(signed(t, payer, account, tt.instructions...))
+		if tt.valid && err != nil {
+			t.Errorf("%s: rejected: %v", tt.name, err)
+		}
+		if !tt.valid && err == nil {
+			t.Errorf("%s: accepted", tt.name)
+		}
+	}
+}
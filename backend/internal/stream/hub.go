@@ -0,0 +1,426 @@
+package stream
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Enuma3lish/LUNG_CEX/backend/internal/middleware"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/gorilla/websocket"
+)
+
+const (
+	writeWait      = 10 * time.Second
+	pongWait       = 60 * time.Second
+	pingPeriod     = 30 * time.Second
+	maxMessageSize = 4096
+	sendBufferSize = 256
+)
+
+// UserChannel is the private channel carrying a client's own fills,
+// balance changes and position updates
+const UserChannel = "user"
+
+// ErrUnknownChannel is returned for channel names that are malformed or
+// refer to an unknown symbol or interval
+var ErrUnknownChannel = errors.New("unknown channel")
+
+// Message is a server-to-client frame. Data messages carry a channel;
+// control replies (subscribed, pong, error) do not.
+type Message struct {
+	Channel string      `json:"channel,omitempty"`
+	Type    string      `json:"type"`
+	Data    interface{} `json:"data,omitempty"`
+	Error   string      `json:"error,omitempty"`
+}
+
+// request is a client-to-server frame
+type request struct {
+	Op       string   `json:"op"` // subscribe, unsubscribe, auth, cancel_on_disconnect, ping
+	Channels []string `json:"channels"`
+	Token    string   `json:"token"`
+	Enabled  bool     `json:"enabled"`
+}
+
+// DisconnectListener is called with the user of a cancel-on-disconnect
+// session once its connection has closed
+type DisconnectListener func(userID uuid.UUID)
+
+// Snapshotter validates a public channel name and returns its current
+// state, which is sent to a client as soon as it subscribes
+type Snapshotter interface {
+	Snapshot(channel string) (*Message, error)
+}
+
+type client struct {
+	conn   *websocket.Conn
+	send   chan []byte
+	userID *uuid.UUID
+	subs   map[string]bool // hub keys; the private channel is "user:<id>"
+	closed bool
+	reason string // close reason sent to the client, if any
+
+	cancelOnDisconnect bool
+}
+
+// Hub fans published messages out to the WebSocket clients subscribed to
+// each channel. Every client has a bounded send buffer; a client that
+// falls a full buffer behind is disconnected rather than allowed to slow
+// down publishers.
+type Hub struct {
+	mu          sync.RWMutex
+	subscribers map[string]map[*client]bool
+	snapshots   Snapshotter
+	upgrader    websocket.Upgrader
+	disconnects []DisconnectListener
+}
+
+func NewHub() *Hub {
+	return &Hub{
+		subscribers: make(map[string]map[*client]bool),
+		upgrader: websocket.Upgrader{
+			ReadBufferSize:  1024,
+			WriteBufferSize: 1024,
+			CheckOrigin:     func(r *http.Request) bool { return true },
+		},
+	}
+}
+
+// SetSnapshotter installs the source of channel validation and snapshots
+func (h *Hub) SetSnapshotter(s Snapshotter) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.snapshots = s
+}
+
+// OnDisconnect registers a listener for cancel-on-disconnect sessions
+// closing. Register listeners before serving connections.
+func (h *Hub) OnDisconnect(listener DisconnectListener) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.disconnects = append(h.disconnects, listener)
+}
+
+// HasSubscribers reports whether any client is subscribed to channel
+func (h *Hub) HasSubscribers(channel string) bool {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	return len(h.subscribers[channel]) > 0
+}
+
+// HasUserSubscribers reports whether a user has a private channel open
+func (h *Hub) HasUserSubscribers(userID uuid.UUID) bool {
+	return h.HasSubscribers(userKey(userID))
+}
+
+// Channels returns every channel with at least one subscriber
+func (h *Hub) Channels() []string {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	channels := make([]string, 0, len(h.subscribers))
+	for channel := range h.subscribers {
+		channels = append(channels, channel)
+	}
+	return channels
+}
+
+// Publish sends a message to every subscriber of a public channel
+func (h *Hub) Publish(channel string, msgType string, data interface{}) {
+	h.broadcast(channel, Message{Channel: channel, Type: msgType, Data: data})
+}
+
+// PublishUser sends a message on one user's private channel
+func (h *Hub) PublishUser(userID uuid.UUID, msgType string, data interface{}) {
+	h.broadcast(userKey(userID), Message{Channel: UserChannel, Type: msgType, Data: data})
+}
+
+func (h *Hub) broadcast(key string, msg Message) {
+	h.mu.RLock()
+	if len(h.subscribers[key]) == 0 {
+		h.mu.RUnlock()
+		return
+	}
+	h.mu.RUnlock()
+
+	payload, err := json.Marshal(msg)
+	if err != nil {
+		log.Printf("Warning: Failed to encode %s message: %v", msg.Type, err)
+		return
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for c := range h.subscribers[key] {
+		h.enqueue(c, payload)
+	}
+}
+
+// enqueue queues a frame without blocking; callers hold h.mu
+func (h *Hub) enqueue(c *client, payload []byte) {
+	if c.closed {
+		return
+	}
+	select {
+	case c.send <- payload:
+	default:
+		// Slow consumer: drop the connection instead of the publisher
+		log.Printf("Warning: Dropping slow WebSocket client %s", c.conn.RemoteAddr())
+		h.drop(c, "slow consumer")
+	}
+}
+
+// drop unsubscribes a client and closes its send queue; callers hold h.mu
+func (h *Hub) drop(c *client, reason string) {
+	if c.closed {
+		return
+	}
+	c.closed = true
+	c.reason = reason
+	for key := range c.subs {
+		h.unsubscribe(c, key)
+	}
+	close(c.send)
+}
+
+func (h *Hub) unsubscribe(c *client, key string) {
+	delete(c.subs, key)
+	if subs, ok := h.subscribers[key]; ok {
+		delete(subs, c)
+		if len(subs) == 0 {
+			delete(h.subscribers, key)
+		}
+	}
+}
+
+// ServeWS upgrades the request to a WebSocket. A JWT may be passed as a
+// Bearer Authorization header or a token query parameter, or later with an
+// auth op; it is only needed for the private user channel.
+func (h *Hub) ServeWS(c *gin.Context) {
+	var userID *uuid.UUID
+	token := c.Query("token")
+	if header := c.GetHeader("Authorization"); strings.HasPrefix(header, "Bearer ") {
+		token = strings.TrimPrefix(header, "Bearer ")
+	}
+	if token != "" {
+		claims, err := middleware.ParseToken(token)
+		if err != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired token"})
+			return
+		}
+		userID = &claims.UserID
+	}
+
+	conn, err := h.upgrader.Upgrade(c.Writer, c.Request, nil)
+	if err != nil {
+		log.Printf("Warning: WebSocket upgrade failed: %v", err)
+		return
+	}
+
+	cl := &client{
+		conn:   conn,
+		send:   make(chan []byte, sendBufferSize),
+		userID: userID,
+		subs:   make(map[string]bool),
+	}
+
+	go h.writePump(cl)
+	h.readPump(cl)
+}
+
+// readPump handles client requests until the connection fails or stops
+// answering pings
+func (h *Hub) readPump(c *client) {
+	defer func() {
+		h.mu.Lock()
+		h.drop(c, "")
+		var listeners []DisconnectListener
+		if c.cancelOnDisconnect && c.userID != nil {
+			listeners = h.disconnects
+		}
+		userID := c.userID
+		h.mu.Unlock()
+		c.conn.Close()
+
+		for _, listener := range listeners {
+			listener(*userID)
+		}
+	}()
+
+	c.conn.SetReadLimit(maxMessageSize)
+	c.conn.SetReadDeadline(time.Now().Add(pongWait))
+	c.conn.SetPongHandler(func(string) error {
+		return c.conn.SetReadDeadline(time.Now().Add(pongWait))
+	})
+
+	for {
+		_, data, err := c.conn.ReadMessage()
+		if err != nil {
+			return
+		}
+		c.conn.SetReadDeadline(time.Now().Add(pongWait))
+
+		var req request
+		if err := json.Unmarshal(data, &req); err != nil {
+			h.reply(c, Message{Type: "error", Error: "Invalid message"})
+			continue
+		}
+		h.handle(c, req)
+	}
+}
+
+func (h *Hub) handle(c *client, req request) {
+	switch req.Op {
+	case "ping":
+		h.reply(c, Message{Type: "pong"})
+	case "auth":
+		claims, err := middleware.ParseToken(req.Token)
+		if err != nil {
+			h.reply(c, Message{Type: "error", Error: "Invalid or expired token"})
+			return
+		}
+		h.mu.Lock()
+		if c.userID != nil && *c.userID != claims.UserID {
+			// The previous user's private updates and cancel-on-disconnect
+			// don't carry over to the new one
+			h.unsubscribe(c, userKey(*c.userID))
+			c.cancelOnDisconnect = false
+		}
+		c.userID = &claims.UserID
+		h.mu.Unlock()
+		h.reply(c, Message{Type: "authenticated"})
+	case "cancel_on_disconnect":
+		h.mu.Lock()
+		authenticated := c.userID != nil
+		if authenticated {
+			c.cancelOnDisconnect = req.Enabled
+		}
+		h.mu.Unlock()
+		if !authenticated {
+			h.reply(c, Message{Type: "error", Error: "Authentication required for cancel on disconnect"})
+			return
+		}
+		h.reply(c, Message{Type: "cancel_on_disconnect", Data: gin.H{"enabled": req.Enabled}})
+	case "subscribe":
+		h.subscribe(c, req.Channels)
+	case "unsubscribe":
+		h.mu.Lock()
+		for _, channel := range req.Channels {
+			if channel == UserChannel && c.userID != nil {
+				channel = userKey(*c.userID)
+			}
+			h.unsubscribe(c, channel)
+		}
+		h.mu.Unlock()
+		h.reply(c, Message{Type: "unsubscribed", Data: req.Channels})
+	default:
+		h.reply(c, Message{Type: "error", Error: "Unknown op"})
+	}
+}
+
+func (h *Hub) subscribe(c *client, channels []string) {
+	h.mu.RLock()
+	snapshots := h.snapshots
+	userID := c.userID
+	h.mu.RUnlock()
+
+	var initial []*Message
+	for _, channel := range channels {
+		key := channel
+		if channel == UserChannel {
+			if userID == nil {
+				h.reply(c, Message{Type: "error", Error: "Authentication required for user channel"})
+				return
+			}
+			key = userKey(*userID)
+		} else {
+			if snapshots == nil {
+				h.reply(c, Message{Type: "error", Error: "Unknown channel " + channel})
+				return
+			}
+			snapshot, err := snapshots.Snapshot(channel)
+			if err != nil {
+				h.reply(c, Message{Type: "error", Error: "Unknown channel " + channel})
+				return
+			}
+			if snapshot != nil {
+				initial = append(initial, snapshot)
+			}
+		}
+
+		h.mu.Lock()
+		if c.closed {
+			h.mu.Unlock()
+			return
+		}
+		if h.subscribers[key] == nil {
+			h.subscribers[key] = make(map[*client]bool)
+		}
+		h.subscribers[key][c] = true
+		c.subs[key] = true
+		h.mu.Unlock()
+	}
+
+	h.reply(c, Message{Type: "subscribed", Data: channels})
+	for _, snapshot := range initial {
+		h.reply(c, *snapshot)
+	}
+}
+
+// reply sends a frame to a single client
+func (h *Hub) reply(c *client, msg Message) {
+	payload, err := json.Marshal(msg)
+	if err != nil {
+		return
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.enqueue(c, payload)
+}
+
+// writePump is the only writer on the connection. It drains the send
+// queue and pings the client every pingPeriod.
+func (h *Hub) writePump(c *client) {
+	ticker := time.NewTicker(pingPeriod)
+	defer func() {
+		ticker.Stop()
+		c.conn.Close()
+	}()
+
+	for {
+		select {
+		case payload, ok := <-c.send:
+			c.conn.SetWriteDeadline(time.Now().Add(writeWait))
+			if !ok {
+				if c.reason != "" {
+					c.conn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.ClosePolicyViolation, c.reason))
+				}
+				return
+			}
+			if err := c.conn.WriteMessage(websocket.TextMessage, payload); err != nil {
+				return
+			}
+		case <-ticker.C:
+			c.conn.SetWriteDeadline(time.Now().Add(writeWait))
+			if err := c.conn.WriteMessage(websocket.PingMessage, nil); err != nil {
+				return
+			}
+		}
+	}
+}
+
+func userKey(userID uuid.UUID) string {
+	return UserChannel + ":" + userID.String()
+}
@@ -0,0 +1,75 @@
+package stream
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/Enuma3lish/LUNG_CEX/backend/internal/middleware"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+)
+
+func token(t *testing.T, userID uuid.UUID) string {
+	t.Helper()
+
+	signed, err := jwt.NewWithClaims(jwt.SigningMethodHS256, middleware.Claims{UserID: userID}).SignedString([]byte("test-secret"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signed
+}
+
+// received drains the frames queued for a client
+func received(t *testing.T, c *client) []Message {
+	t.Helper()
+
+	var msgs []Message
+	for {
+		select {
+		case payload := <-c.send:
+			var msg Message
+			if err := json.Unmarshal(payload, &msg); err != nil {
+				t.Fatal(err)
+			}
+			msgs = append(msgs, msg)
+		default:
+			return msgs
+		}
+	}
+}
+
+// Authenticating as someone else drops the first user's private channel
+// and cancel-on-disconnect
+func TestReauthenticate(t *testing.T) {
+	t.Setenv("JWT_SECRET", "test-secret")
+	h := NewHub()
+	c := &client{send: make(chan []byte, 16), subs: make(map[string]bool)}
+	first, second := uuid.New(), uuid.New()
+
+	h.handle(c, request{Op: "auth", Token: token(t, first)})
+	h.handle(c, request{Op: "subscribe", Channels: []string{UserChannel}})
+	h.handle(c, request{Op: "cancel_on_disconnect", Enabled: true})
+	received(t, c)
+
+	h.handle(c, request{Op: "auth", Token: token(t, second)})
+	if msgs := received(t, c); len(msgs) != 1 || msgs[0].Type != "authenticated" {
+		t.Fatalf("re-authenticating replied %+v, want authenticated", msgs)
+	}
+	if h.HasUserSubscribers(first) || c.cancelOnDisconnect {
+		t.Errorf("first user still subscribed %v, cancel on disconnect %v", h.HasUserSubscribers(first), c.cancelOnDisconnect)
+	}
+
+	h.PublishUser(first, "fill", "first")
+	h.PublishUser(second, "fill", "second")
+	if msgs := received(t, c); len(msgs) != 0 {
+		t.Errorf("received %+v before subscribing as the second user", msgs)
+	}
+
+	h.handle(c, request{Op: "subscribe", Channels: []string{UserChannel}})
+	received(t, c)
+	h.PublishUser(first, "fill", "first")
+	h.PublishUser(second, "fill", "second")
+	if msgs := received(t, c); len(msgs) != 1 || msgs[0].Data != "second" {
+		t.Errorf("received %+v, want only the second user's fill", msgs)
+	}
+}
@@ -0,0 +1,335 @@
+package stream
+
+import (
+	"context"
+	"log"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Enuma3lish/LUNG_CEX/backend/internal/candles"
+	"github.com/Enuma3lish/LUNG_CEX/backend/internal/exchange"
+	"github.com/Enuma3lish/LUNG_CEX/backend/internal/models"
+	"github.com/Enuma3lish/LUNG_CEX/backend/internal/orderbook"
+	"github.com/Enuma3lish/LUNG_CEX/backend/internal/wallet"
+	"github.com/Enuma3lish/LUNG_CEX/backend/pkg/pricefeed"
+	"github.com/Enuma3lish/LUNG_CEX/backend/pkg/utils"
+	"github.com/google/uuid"
+	"github.com/shopspring/decimal"
+	"gorm.io/gorm"
+)
+
+const (
+	defaultStreamInterval = time.Second
+	bookInterval          = 250 * time.Millisecond
+	bookDepth             = 20
+	balanceQueueSize      = 1024
+)
+
+// Ticker is the payload of a ticker:<symbol> message
+type Ticker struct {
+	Symbol    string           `json:"symbol"`
+	Price     decimal.Decimal  `json:"price"`
+	BestBid   *decimal.Decimal `json:"best_bid,omitempty"`
+	BestAsk   *decimal.Decimal `json:"best_ask,omitempty"`
+	Timestamp time.Time        `json:"timestamp"`
+}
+
+// Book is the payload of a book:<symbol> message
+type Book struct {
+	Symbol    string            `json:"symbol"`
+	Bids      []orderbook.Level `json:"bids"`
+	Asks      []orderbook.Level `json:"asks"`
+	Timestamp time.Time         `json:"timestamp"`
+}
+
+// Candle is the payload of a candles:<symbol>:<interval> message
+type Candle struct {
+	Symbol string `json:"symbol"`
+	models.Candle
+}
+
+// Fill is the payload of a user channel fill message
+type Fill struct {
+	Symbol string `json:"symbol"`
+	models.Trade
+}
+
+// Publisher feeds the hub: it polls prices, books and open candles for
+// channels that have subscribers, and pushes fills, balances and
+// positions to users' private channels.
+type Publisher struct {
+	db         *gorm.DB
+	hub        *Hub
+	engine     *exchange.Engine
+	aggregator *candles.Aggregator
+	priceFeed  pricefeed.PriceFeed
+	interval   time.Duration
+	balances   chan uuid.UUID
+
+	mu           sync.Mutex
+	assets       map[string]models.Asset
+	markets      map[string]bool
+	bookVersions map[string]uint64
+	lastCandles  map[string]models.Candle
+}
+
+func NewPublisher(db *gorm.DB, hub *Hub, engine *exchange.Engine, aggregator *candles.Aggregator, priceFeed pricefeed.PriceFeed) *Publisher {
+	interval := defaultStreamInterval
+	if v, err := time.ParseDuration(os.Getenv("STREAM_INTERVAL")); err == nil && v > 0 {
+		interval = v
+	}
+
+	p := &Publisher{
+		db:           db,
+		hub:          hub,
+		engine:       engine,
+		aggregator:   aggregator,
+		priceFeed:    priceFeed,
+		interval:     interval,
+		balances:     make(chan uuid.UUID, balanceQueueSize),
+		assets:       make(map[string]models.Asset),
+		markets:      make(map[string]bool),
+		bookVersions: make(map[string]uint64),
+		lastCandles:  make(map[string]models.Candle),
+	}
+	hub.SetSnapshotter(p)
+	return p
+}
+
+// Run publishes market data and balance updates until ctx is cancelled
+func (p *Publisher) Run(ctx context.Context) {
+	var assets []models.Asset
+	if err := p.db.Find(&assets).Error; err != nil {
+		log.Printf("Warning: Stream publisher failed to load assets: %v", err)
+		return
+	}
+	var markets []models.Market
+	if err := p.db.Find(&markets).Error; err != nil {
+		log.Printf("Warning: Stream publisher failed to load markets: %v", err)
+		return
+	}
+	p.mu.Lock()
+	for _, asset := range assets {
+		p.assets[asset.Symbol] = asset
+	}
+	for _, market := range markets {
+		p.markets[market.Symbol] = true
+	}
+	p.mu.Unlock()
+
+	market := time.NewTicker(p.interval)
+	defer market.Stop()
+	books := time.NewTicker(bookInterval)
+	defer books.Stop()
+
+	log.Printf("Stream publisher started (interval %s)", p.interval)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-market.C:
+			p.publishMarket()
+		case <-books.C:
+			p.publishBooks()
+		case userID := <-p.balances:
+			p.publishBalance(userID)
+		}
+	}
+}
+
+// Snapshot validates a public channel and returns its current state.
+// Books are per market; tickers and candles are per asset, in USD.
+func (p *Publisher) Snapshot(channel string) (*Message, error) {
+	parts := strings.Split(channel, ":")
+	if len(parts) < 2 {
+		return nil, ErrUnknownChannel
+	}
+	symbol := parts[1]
+	if parts[0] == "book" {
+		if !p.market(symbol) {
+			return nil, ErrUnknownChannel
+		}
+	} else if _, ok := p.asset(symbol); !ok {
+		return nil, ErrUnknownChannel
+	}
+
+	switch {
+	case parts[0] == "ticker" && len(parts) == 2:
+		ticker, ok := p.ticker(symbol)
+		if !ok {
+			return nil, nil
+		}
+		return &Message{Channel: channel, Type: "ticker", Data: ticker}, nil
+	case parts[0] == "book" && len(parts) == 2:
+		book, _ := p.book(symbol)
+		return &Message{Channel: channel, Type: "book", Data: book}, nil
+	case parts[0] == "candles" && len(parts) == 3:
+		if _, ok := candles.Intervals[parts[2]]; !ok {
+			return nil, ErrUnknownChannel
+		}
+		candle, ok := p.aggregator.Current(symbol, parts[2])
+		if !ok {
+			return nil, nil
+		}
+		return &Message{Channel: channel, Type: "candle", Data: Candle{Symbol: symbol, Candle: candle}}, nil
+	}
+	return nil, ErrUnknownChannel
+}
+
+// OnTrade pushes fills to the users on both sides of an execution. It is
+// registered as an exchange.TradeListener.
+func (p *Publisher) OnTrade(symbol string, exec *exchange.Execution) {
+	taker := exec.Order.UserID
+	p.hub.PublishUser(taker, "order", exec.Order)
+	for _, trade := range exec.Trades {
+		p.hub.PublishUser(taker, "fill", Fill{Symbol: symbol, Trade: trade})
+	}
+	p.BalanceChanged(taker)
+
+	for _, trade := range exec.MakerTrades {
+		p.hub.PublishUser(trade.UserID, "fill", Fill{Symbol: symbol, Trade: trade})
+		p.BalanceChanged(trade.UserID)
+	}
+}
+
+// PositionChanged pushes a futures position update to its owner
+func (p *Publisher) PositionChanged(position models.FuturesPosition) {
+	p.hub.PublishUser(position.UserID, "position", position)
+	p.BalanceChanged(position.UserID)
+}
+
+// BalanceChanged queues a balance refresh for a user's private channel.
+// It never blocks; refreshes are dropped while the queue is full.
+func (p *Publisher) BalanceChanged(userID uuid.UUID) {
+	if !p.hub.HasUserSubscribers(userID) {
+		return
+	}
+	select {
+	case p.balances <- userID:
+	default:
+		log.Printf("Warning: Balance update queue full, dropping update for %s", userID)
+	}
+}
+
+// publishBalance sends every wallet of a user
+func (p *Publisher) publishBalance(userID uuid.UUID) {
+	wallets, err := wallet.List(p.db, userID)
+	if err != nil {
+		return
+	}
+	p.hub.PublishUser(userID, "balance", wallet.Balances(wallets))
+}
+
+// publishMarket sends tickers and changed open candles
+func (p *Publisher) publishMarket() {
+	for _, channel := range p.hub.Channels() {
+		parts := strings.Split(channel, ":")
+		switch {
+		case parts[0] == "ticker" && len(parts) == 2:
+			if ticker, ok := p.ticker(parts[1]); ok {
+				p.hub.Publish(channel, "ticker", ticker)
+			}
+		case parts[0] == "candles" && len(parts) == 3:
+			candle, ok := p.aggregator.Current(parts[1], parts[2])
+			if !ok {
+				continue
+			}
+			p.mu.Lock()
+			last, seen := p.lastCandles[channel]
+			unchanged := seen && sameCandle(last, candle)
+			p.lastCandles[channel] = candle
+			p.mu.Unlock()
+			if !unchanged {
+				p.hub.Publish(channel, "candle", Candle{Symbol: parts[1], Candle: candle})
+			}
+		}
+	}
+}
+
+// sameCandle reports whether two candles hold the same values. Decimals
+// and times don't compare by value with ==.
+func sameCandle(a models.Candle, b models.Candle) bool {
+	return a.AssetID == b.AssetID &&
+		a.Interval == b.Interval &&
+		a.OpenTime.Equal(b.OpenTime) &&
+		a.Open.Equal(b.Open) &&
+		a.High.Equal(b.High) &&
+		a.Low.Equal(b.Low) &&
+		a.Close.Equal(b.Close) &&
+		a.Volume.Equal(b.Volume) &&
+		a.TradeCount == b.TradeCount
+}
+
+// publishBooks sends a depth snapshot of every subscribed book that
+// changed since it was last published
+func (p *Publisher) publishBooks() {
+	for _, channel := range p.hub.Channels() {
+		if !strings.HasPrefix(channel, "book:") {
+			continue
+		}
+		symbol := strings.TrimPrefix(channel, "book:")
+
+		book, version := p.book(symbol)
+		p.mu.Lock()
+		unchanged := p.bookVersions[symbol] == version
+		p.bookVersions[symbol] = version
+		p.mu.Unlock()
+		if !unchanged {
+			p.hub.Publish(channel, "book", book)
+		}
+	}
+}
+
+func (p *Publisher) ticker(symbol string) (Ticker, bool) {
+	asset, ok := p.asset(symbol)
+	if !ok {
+		return Ticker{}, false
+	}
+	price, err := p.priceFeed.Price(symbol)
+	if err != nil {
+		return Ticker{}, false
+	}
+	ticker := Ticker{Symbol: symbol, Price: utils.FeedPrice(price, asset.TickSize), Timestamp: time.Now().UTC()}
+
+	// Best bid and ask come from the asset's USD market, if it has one
+	book, ok := p.engine.FindBook(exchange.MarketSymbol(symbol, pricefeed.USD))
+	if !ok {
+		return ticker, true
+	}
+	book.Lock()
+	if bid, ok := book.BestBid(); ok {
+		ticker.BestBid = &bid
+	}
+	if ask, ok := book.BestAsk(); ok {
+		ticker.BestAsk = &ask
+	}
+	book.Unlock()
+	return ticker, true
+}
+
+func (p *Publisher) book(symbol string) (Book, uint64) {
+	book := p.engine.Book(symbol)
+	book.Lock()
+	defer book.Unlock()
+
+	bids, asks := book.Depth(bookDepth)
+	return Book{Symbol: symbol, Bids: bids, Asks: asks, Timestamp: time.Now().UTC()}, book.Version()
+}
+
+func (p *Publisher) asset(symbol string) (models.Asset, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	asset, ok := p.assets[symbol]
+	return asset, ok
+}
+
+func (p *Publisher) market(symbol string) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return p.markets[symbol]
+}
@@ -0,0 +1,49 @@
+package stream
+
+import (
+	"testing"
+	"time"
+
+	"github.com/Enuma3lish/LUNG_CEX/backend/internal/models"
+	"github.com/google/uuid"
+	"github.com/shopspring/decimal"
+)
+
+func TestSameCandle(t *testing.T) {
+	openTime := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	candle := models.Candle{
+		AssetID:    uuid.New(),
+		Interval:   "1m",
+		OpenTime:   openTime,
+		Open:       decimal.RequireFromString("45000.00"),
+		High:       decimal.RequireFromString("45010.50"),
+		Low:        decimal.RequireFromString("44990.00"),
+		Close:      decimal.RequireFromString("45005.25"),
+		Volume:     decimal.RequireFromString("0.5"),
+		TradeCount: 3,
+	}
+
+	// The same values as freshly parsed decimals and a time in another zone
+	reloaded := candle
+	reloaded.OpenTime = openTime.In(time.FixedZone("UTC+8", 8*60*60))
+	reloaded.Open = decimal.RequireFromString("45000")
+	reloaded.High = decimal.RequireFromString("45010.5")
+	reloaded.Low = decimal.RequireFromString("44990")
+	reloaded.Close = decimal.RequireFromString("45005.250")
+	reloaded.Volume = decimal.RequireFromString("0.50000000")
+	if !sameCandle(candle, reloaded) {
+		t.Error("candles with equal values compare as different")
+	}
+
+	changed := candle
+	changed.Close = decimal.RequireFromString("45005.26")
+	if sameCandle(candle, changed) {
+		t.Error("candles with different closes compare as equal")
+	}
+
+	traded := candle
+	traded.TradeCount++
+	if sameCandle(candle, traded) {
+		t.Error("candles with different trade counts compare as equal")
+	}
+}
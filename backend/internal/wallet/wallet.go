@@ -0,0 +1,191 @@
+package wallet
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/Enuma3lish/LUNG_CEX/backend/internal/models"
+	"github.com/Enuma3lish/LUNG_CEX/backend/pkg/utils"
+	"github.com/google/uuid"
+	"github.com/shopspring/decimal"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// CashSymbol is the asset new users are funded in and futures are
+// margined and settled in
+const CashSymbol = "USD"
+
+// InitialDeposit is the cash every new user starts with
+var InitialDeposit = decimal.NewFromInt(10000)
+
+var (
+	ErrInsufficientBalance = errors.New("insufficient available balance")
+	ErrAssetNotFound       = errors.New("asset not found")
+)
+
+// CashAsset loads the cash asset
+func CashAsset(tx *gorm.DB) (models.Asset, error) {
+	var asset models.Asset
+	if err := tx.Where("symbol = ?", CashSymbol).First(&asset).Error; err != nil {
+		return models.Asset{}, ErrAssetNotFound
+	}
+	return asset, nil
+}
+
+// Key names a user's wallet in one asset
+type Key struct {
+	UserID  uuid.UUID
+	AssetID uuid.UUID
+}
+
+// Get loads a user's wallet for an asset without locking it, for reads.
+// A user who never held the asset gets an empty, unsaved wallet.
+func Get(tx *gorm.DB, userID uuid.UUID, assetID uuid.UUID) (models.Wallet, error) {
+	var w models.Wallet
+	result := tx.Where("user_id = ? AND asset_id = ?", userID, assetID).First(&w)
+	if result.Error == gorm.ErrRecordNotFound {
+		return models.Wallet{UserID: userID, AssetID: assetID}, nil
+	}
+	if result.Error != nil {
+		return models.Wallet{}, fmt.Errorf("failed to load wallet: %w", result.Error)
+	}
+	return w, nil
+}
+
+// List returns a user's wallets with their assets, cash first
+func List(tx *gorm.DB, userID uuid.UUID) ([]models.Wallet, error) {
+	var wallets []models.Wallet
+	if err := tx.Preload("Asset").Where("user_id = ?", userID).Find(&wallets).Error; err != nil {
+		return nil, fmt.Errorf("failed to fetch wallets: %w", err)
+	}
+	sort.Slice(wallets, func(i, j int) bool {
+		a, b := wallets[i].Asset.Symbol, wallets[j].Asset.Symbol
+		if (a == CashSymbol) != (b == CashSymbol) {
+			return a == CashSymbol
+		}
+		return a < b
+	})
+	return wallets, nil
+}
+
+// Balances summarizes wallets for their owner
+func Balances(wallets []models.Wallet) []models.WalletBalance {
+	balances := make([]models.WalletBalance, 0, len(wallets))
+	for _, w := range wallets {
+		balances = append(balances, models.WalletBalance{
+			Asset:     w.Asset.Symbol,
+			Balance:   w.Balance,
+			Locked:    w.Locked,
+			Available: w.Available(),
+		})
+	}
+	return balances
+}
+
+// LockAll locks several wallets' rows until the transaction ends,
+// creating wallets that don't exist yet. Rows are always locked in the
+// same order, so transactions locking overlapping wallets can't deadlock;
+// a transaction that changes more than one wallet should lock them all
+// here first.
+func LockAll(tx *gorm.DB, keys []Key) error {
+	sorted := append([]Key(nil), keys...)
+	sort.Slice(sorted, func(i, j int) bool {
+		if c := bytes.Compare(sorted[i].UserID[:], sorted[j].UserID[:]); c != 0 {
+			return c < 0
+		}
+		return bytes.Compare(sorted[i].AssetID[:], sorted[j].AssetID[:]) < 0
+	})
+
+	for i, key := range sorted {
+		if i > 0 && key == sorted[i-1] {
+			continue
+		}
+		if _, err := lock(tx, key.UserID, key.AssetID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// lock loads a wallet with its row locked until the transaction ends,
+// creating it on first use. Every balance change goes through here, so two
+// transactions can never both pass a balance check on the same wallet.
+func lock(tx *gorm.DB, userID uuid.UUID, assetID uuid.UUID) (models.Wallet, error) {
+	var w models.Wallet
+	find := func() (bool, error) {
+		result := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("user_id = ? AND asset_id = ?", userID, assetID).
+			Limit(1).
+			Find(&w)
+		if result.Error != nil {
+			return false, fmt.Errorf("failed to lock wallet: %w", result.Error)
+		}
+		return result.RowsAffected > 0, nil
+	}
+
+	if found, err := find(); err != nil || found {
+		return w, err
+	}
+
+	// A concurrent first deposit may create the row first; either way it
+	// exists once this returns
+	if err := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&models.Wallet{UserID: userID, AssetID: assetID}).Error; err != nil {
+		return models.Wallet{}, fmt.Errorf("failed to create wallet: %w", err)
+	}
+	found, err := find()
+	if err != nil {
+		return models.Wallet{}, err
+	}
+	if !found {
+		return models.Wallet{}, fmt.Errorf("failed to create wallet for asset %s", assetID)
+	}
+	return w, nil
+}
+
+// Adjust changes a wallet's balance and locked amount, creating the wallet
+// on first use. It fails with ErrInsufficientBalance rather than leave the
+// balance below what is locked or either below zero.
+func Adjust(tx *gorm.DB, userID uuid.UUID, assetID uuid.UUID, delta decimal.Decimal, lockedDelta decimal.Decimal) (models.Wallet, error) {
+	w, err := lock(tx, userID, assetID)
+	if err != nil {
+		return models.Wallet{}, err
+	}
+
+	w.Balance = w.Balance.Add(delta)
+	w.Locked = w.Locked.Add(lockedDelta)
+	if w.Locked.IsNegative() || w.Balance.LessThan(w.Locked) {
+		return models.Wallet{}, ErrInsufficientBalance
+	}
+	if err := tx.Save(&w).Error; err != nil {
+		return models.Wallet{}, fmt.Errorf("failed to update wallet: %w", err)
+	}
+	return w, nil
+}
+
+// Lock reserves part of a wallet's available balance
+func Lock(tx *gorm.DB, userID uuid.UUID, assetID uuid.UUID, amount decimal.Decimal) (models.Wallet, error) {
+	return Adjust(tx, userID, assetID, decimal.Zero, amount)
+}
+
+// Credit adds quantity bought at unitCost USD to a wallet, folding it into
+// the wallet's average cost
+func Credit(tx *gorm.DB, userID uuid.UUID, assetID uuid.UUID, quantity decimal.Decimal, unitCost decimal.Decimal) (models.Wallet, error) {
+	w, err := lock(tx, userID, assetID)
+	if err != nil {
+		return models.Wallet{}, err
+	}
+
+	total := w.Balance.Add(quantity)
+	if total.IsPositive() {
+		cost := w.AvgPrice.Mul(w.Balance).Add(unitCost.Mul(quantity))
+		w.AvgPrice = utils.RoundCents(cost.Div(total))
+	}
+	w.Balance = total
+	if err := tx.Save(&w).Error; err != nil {
+		return models.Wallet{}, fmt.Errorf("failed to update wallet: %w", err)
+	}
+	return w, nil
+}
@@ -0,0 +1,176 @@
+package blockchain
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/google/uuid"
+	"github.com/shopspring/decimal"
+)
+
+// Fixed-point scales of the on-chain record's quantity and price. Both keep
+// the 8 decimals orders and trades are stored with, so the record holds
+// every market's tick and lot exactly.
+const (
+	QuantityDecimals = 8
+	PriceDecimals    = 8
+)
+
+// recordTradeTag is TradeInstruction::RecordTrade's Borsh enum variant
+const recordTradeTag = 0
+
+// Borsh variants of the program's TradeType enum
+const (
+	tradeTypeBuy  = 0
+	tradeTypeSell = 1
+)
+
+var ErrInvalidInstruction = errors.New("invalid RecordTrade instruction")
+
+// TradeRecord is a trade as the TradeRecord program stores it. Quantity and
+// Price are truncated to QuantityDecimals and PriceDecimals on chain, which
+// bounds the price at about 1.8e11.
+type TradeRecord struct {
+	UserID      uuid.UUID
+	AssetSymbol string
+	TradeType   string // BUY, SELL
+	Quantity    decimal.Decimal
+	Price       decimal.Decimal
+	Timestamp   time.Time
+}
+
+// EncodeRecordTrade serializes a TradeInstruction::RecordTrade as the
+// program in solana-program/src/lib.rs expects it: the variant tag, then
+// the record's fields in Borsh layout
+func EncodeRecordTrade(record TradeRecord) ([]byte, error) {
+	var tradeType byte
+	switch strings.ToUpper(record.TradeType) {
+	case "BUY":
+		tradeType = tradeTypeBuy
+	case "SELL":
+		tradeType = tradeTypeSell
+	default:
+		return nil, fmt.Errorf("%w: unknown trade type %q", ErrInvalidInstruction, record.TradeType)
+	}
+	quantity, err := fixedPoint(record.Quantity, QuantityDecimals)
+	if err != nil {
+		return nil, fmt.Errorf("%w: quantity: %v", ErrInvalidInstruction, err)
+	}
+	price, err := fixedPoint(record.Price, PriceDecimals)
+	if err != nil {
+		return nil, fmt.Errorf("%w: price: %v", ErrInvalidInstruction, err)
+	}
+
+	data := make([]byte, 0, 1+16+4+len(record.AssetSymbol)+1+8+8+8)
+	data = append(data, recordTradeTag)
+	data = append(data, record.UserID[:]...)
+	data = binary.LittleEndian.AppendUint32(data, uint32(len(record.AssetSymbol)))
+	data = append(data, record.AssetSymbol...)
+	data = append(data, tradeType)
+	data = binary.LittleEndian.AppendUint64(data, quantity)
+	data = binary.LittleEndian.AppendUint64(data, price)
+	data = binary.LittleEndian.AppendUint64(data, uint64(record.Timestamp.Unix()))
+	return data, nil
+}
+
+// DecodeRecordTrade parses a TradeInstruction::RecordTrade, rejecting any
+// other instruction or trailing bytes
+func DecodeRecordTrade(data []byte) (TradeRecord, error) {
+	var record TradeRecord
+	r := reader{data: data}
+
+	if tag := r.byte(); tag != recordTradeTag {
+		return record, fmt.Errorf("%w: unknown instruction %d", ErrInvalidInstruction, tag)
+	}
+	copy(record.UserID[:], r.bytes(16))
+	symbol := r.bytes(int(r.uint32()))
+	if !utf8.Valid(symbol) {
+		return record, fmt.Errorf("%w: asset symbol is not UTF-8", ErrInvalidInstruction)
+	}
+	record.AssetSymbol = string(symbol)
+	switch r.byte() {
+	case tradeTypeBuy:
+		record.TradeType = "BUY"
+	case tradeTypeSell:
+		record.TradeType = "SELL"
+	default:
+		return record, fmt.Errorf("%w: unknown trade type", ErrInvalidInstruction)
+	}
+	record.Quantity = decimal.NewFromBigInt(new(big.Int).SetUint64(r.uint64()), -QuantityDecimals)
+	record.Price = decimal.NewFromBigInt(new(big.Int).SetUint64(r.uint64()), -PriceDecimals)
+	record.Timestamp = time.Unix(int64(r.uint64()), 0).UTC()
+
+	if r.err != nil {
+		return record, fmt.Errorf("%w: %v", ErrInvalidInstruction, r.err)
+	}
+	if len(r.data) > 0 {
+		return record, fmt.Errorf("%w: %d trailing bytes", ErrInvalidInstruction, len(r.data))
+	}
+	return record, nil
+}
+
+// RecordSize is the size of the account the program writes a record into
+func RecordSize(record TradeRecord) uint64 {
+	return uint64(16 + 4 + len(record.AssetSymbol) + 1 + 8 + 8 + 8)
+}
+
+// fixedPoint scales a non-negative decimal to an integer with the given
+// decimals, truncating the rest
+func fixedPoint(value decimal.Decimal, decimals int32) (uint64, error) {
+	scaled := value.Shift(decimals).Truncate(0)
+	if scaled.IsNegative() {
+		return 0, errors.New("must not be negative")
+	}
+	if !scaled.BigInt().IsUint64() {
+		return 0, errors.New("out of range")
+	}
+	return scaled.BigInt().Uint64(), nil
+}
+
+// reader consumes Borsh fields, remembering the first short read
+type reader struct {
+	data []byte
+	err  error
+}
+
+func (r *reader) bytes(n int) []byte {
+	if r.err != nil {
+		return nil
+	}
+	if n < 0 || n > len(r.data) {
+		r.err = errors.New("unexpected end of data")
+		return nil
+	}
+	out := r.data[:n]
+	r.data = r.data[n:]
+	return out
+}
+
+func (r *reader) byte() byte {
+	b := r.bytes(1)
+	if b == nil {
+		return 0
+	}
+	return b[0]
+}
+
+func (r *reader) uint32() uint32 {
+	b := r.bytes(4)
+	if b == nil {
+		return 0
+	}
+	return binary.LittleEndian.Uint32(b)
+}
+
+func (r *reader) uint64() uint64 {
+	b := r.bytes(8)
+	if b == nil {
+		return 0
+	}
+	return binary.LittleEndian.Uint64(b)
+}
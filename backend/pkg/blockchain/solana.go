@@ -9,12 +9,20 @@ import (
 	"github.com/gagliardetto/solana-go"
 	"github.com/gagliardetto/solana-go/programs/system"
 	"github.com/gagliardetto/solana-go/rpc"
-	"github.com/google/uuid"
+)
+
+// Recording modes: write each trade with the TradeRecord program, or as
+// a text memo with the SPL Memo program
+const (
+	ModeProgram = "program"
+	ModeMemo    = "memo"
 )
 
 type SolanaClient struct {
 	rpcClient *rpc.Client
 	payer     solana.PrivateKey
+	mode      string
+	programID solana.PublicKey
 }
 
 func NewSolanaClient() (*SolanaClient, error) {
@@ -38,55 +46,97 @@ func NewSolanaClient() (*SolanaClient, error) {
 		}
 	} else {
 		// Generate a new keypair for testing
-		payer = solana.NewWallet()
+		payer = solana.NewWallet().PrivateKey
 		log.Printf("Generated new Solana keypair. Public key: %s", payer.PublicKey())
 		log.Printf("Private key (save this): %s", payer.String())
 	}
 
+	// Record with the deployed program when there is one, otherwise fall
+	// back to memos
+	var programID solana.PublicKey
+	if v := os.Getenv("SOLANA_PROGRAM_ID"); v != "" {
+		programID, err = solana.PublicKeyFromBase58(v)
+		if err != nil {
+			return nil, fmt.Errorf("invalid program id: %w", err)
+		}
+	}
+	mode := os.Getenv("SOLANA_RECORD_MODE")
+	switch {
+	case mode == "" && programID.IsZero():
+		mode = ModeMemo
+	case mode == "":
+		mode = ModeProgram
+	case mode == ModeProgram && programID.IsZero():
+		return nil, fmt.Errorf("SOLANA_RECORD_MODE=%s requires SOLANA_PROGRAM_ID", ModeProgram)
+	case mode != ModeProgram && mode != ModeMemo:
+		return nil, fmt.Errorf("unknown SOLANA_RECORD_MODE %q", mode)
+	}
+
 	return &SolanaClient{
 		rpcClient: client,
 		payer:     payer,
+		mode:      mode,
+		programID: programID,
 	}, nil
 }
 
+// Mode returns how trades are recorded, ModeProgram or ModeMemo
+func (s *SolanaClient) Mode() string {
+	return s.mode
+}
+
 // RecordTradeOnChain records a trade transaction on Solana blockchain
-func (s *SolanaClient) RecordTradeOnChain(
-	userID uuid.UUID,
-	assetSymbol string,
-	tradeType string,
-	quantity float64,
-	price float64,
-) (string, error) {
+func (s *SolanaClient) RecordTradeOnChain(record TradeRecord) (string, error) {
 	ctx := context.Background()
 
-	// For this virtual CEX, we'll create a simple memo transaction
-	// In production, you would interact with your custom program
+	signers := []solana.PrivateKey{s.payer}
+	var instructions []solana.Instruction
+	if s.mode == ModeProgram {
+		data, err := EncodeRecordTrade(record)
+		if err != nil {
+			return "", err
+		}
+
+		// The program writes the record into a fresh account it owns,
+		// funded to be rent exempt
+		account := solana.NewWallet().PrivateKey
+		space := RecordSize(record)
+		rent, err := s.rpcClient.GetMinimumBalanceForRentExemption(ctx, space, rpc.CommitmentFinalized)
+		if err != nil {
+			return "", fmt.Errorf("failed to get rent exemption: %w", err)
+		}
+		signers = append(signers, account)
+		instructions = []solana.Instruction{
+			system.NewCreateAccountInstruction(rent, space, s.programID, s.payer.PublicKey(), account.PublicKey()).Build(),
+			solana.NewInstruction(s.programID, solana.AccountMetaSlice{
+				solana.NewAccountMeta(s.payer.PublicKey(), false, true),
+				solana.NewAccountMeta(account.PublicKey(), true, false),
+			}, data),
+		}
+	} else {
+		instructions = []solana.Instruction{memoInstruction(s.payer.PublicKey(), Memo(record))}
+	}
 
+	return s.send(ctx, instructions, signers, Memo(record))
+}
+
+// RecordMemo writes text on chain with the SPL Memo program
+func (s *SolanaClient) RecordMemo(text string) (string, error) {
+	return s.send(context.Background(), []solana.Instruction{memoInstruction(s.payer.PublicKey(), text)}, []solana.PrivateKey{s.payer}, text)
+}
+
+// send signs instructions into a transaction paid for by the payer and
+// submits it. desc names the transaction in logs.
+func (s *SolanaClient) send(ctx context.Context, instructions []solana.Instruction, signers []solana.PrivateKey, desc string) (string, error) {
 	// Get recent blockhash
-	recent, err := s.rpcClient.GetRecentBlockhash(ctx, rpc.CommitmentFinalized)
+	recent, err := s.rpcClient.GetLatestBlockhash(ctx, rpc.CommitmentFinalized)
 	if err != nil {
 		return "", fmt.Errorf("failed to get recent blockhash: %w", err)
 	}
 
-	// Create a memo with trade data
-	memo := fmt.Sprintf("TRADE:%s:%s:%s:%.8f:%.2f",
-		userID.String(),
-		assetSymbol,
-		tradeType,
-		quantity,
-		price,
-	)
-
 	// Create transaction
 	tx, err := solana.NewTransaction(
-		[]solana.Instruction{
-			system.NewTransferInstruction(
-				0, // Zero lamports transfer, just for recording
-				s.payer.PublicKey(),
-				s.payer.PublicKey(),
-			).Build(),
-			// You can add a memo program instruction here
-		},
+		instructions,
 		recent.Value.Blockhash,
 		solana.TransactionPayer(s.payer.PublicKey()),
 	)
@@ -97,8 +147,10 @@ func (s *SolanaClient) RecordTradeOnChain(
 
 	// Sign transaction
 	_, err = tx.Sign(func(key solana.PublicKey) *solana.PrivateKey {
-		if key.Equals(s.payer.PublicKey()) {
-			return &s.payer
+		for i := range signers {
+			if key.Equals(signers[i].PublicKey()) {
+				return &signers[i]
+			}
 		}
 		return nil
 	})
@@ -118,32 +170,72 @@ func (s *SolanaClient) RecordTradeOnChain(
 	)
 
 	if err != nil {
-		// Log error but don't fail the trade
-		log.Printf("Warning: Failed to record trade on Solana: %v (memo: %s)", err, memo)
+		// Log error; the outbox retries the send
+		log.Printf("Warning: Failed to send transaction to Solana: %v (%s)", err, desc)
 		return "", fmt.Errorf("failed to send transaction: %w", err)
 	}
 
-	log.Printf("Trade recorded on Solana. Signature: %s", sig.String())
+	log.Printf("Recorded on Solana. Signature: %s", sig.String())
 	return sig.String(), nil
 }
 
+// memoInstruction writes text with the SPL Memo program, which takes the
+// raw UTF-8 as its data. solana-go's memo builder length-prefixes it,
+// which would end up in the memo.
+func memoInstruction(signer solana.PublicKey, text string) solana.Instruction {
+	return solana.NewInstruction(solana.MemoProgramID, solana.AccountMetaSlice{
+		solana.NewAccountMeta(signer, false, true),
+	}, []byte(text))
+}
+
+// Memo is the text a trade is recorded as in memo mode
+func Memo(record TradeRecord) string {
+	return fmt.Sprintf("TRADE:%s:%s:%s:%s:%s:%d",
+		record.UserID.String(),
+		record.AssetSymbol,
+		record.TradeType,
+		record.Quantity.StringFixed(QuantityDecimals),
+		record.Price.StringFixed(PriceDecimals),
+		record.Timestamp.Unix(),
+	)
+}
+
+// Transaction statuses reported by GetTransactionStatus
+const (
+	TxUnknown   = ""          // not seen by the cluster: still in flight, or dropped
+	TxProcessed = "processed" // in a block that may still be skipped
+	TxConfirmed = "confirmed" // voted on by a supermajority
+	TxFinalized = "finalized" // rooted, can no longer be rolled back
+	TxFailed    = "failed"    // landed, but the transaction returned an error
+)
+
 // GetTransactionStatus checks the status of a transaction
-func (s *SolanaClient) GetTransactionStatus(signature string) (bool, error) {
+func (s *SolanaClient) GetTransactionStatus(signature string) (string, error) {
 	ctx := context.Background()
 
 	sig, err := solana.SignatureFromBase58(signature)
 	if err != nil {
-		return false, err
+		return TxUnknown, err
 	}
 
 	status, err := s.rpcClient.GetSignatureStatuses(ctx, true, sig)
 	if err != nil {
-		return false, err
+		return TxUnknown, err
 	}
 
 	if len(status.Value) == 0 || status.Value[0] == nil {
-		return false, nil
+		return TxUnknown, nil
+	}
+	if status.Value[0].Err != nil {
+		return TxFailed, nil
 	}
 
-	return status.Value[0].ConfirmationStatus == rpc.ConfirmationStatusFinalized, nil
+	switch status.Value[0].ConfirmationStatus {
+	case rpc.ConfirmationStatusFinalized:
+		return TxFinalized, nil
+	case rpc.ConfirmationStatusConfirmed:
+		return TxConfirmed, nil
+	default:
+		return TxProcessed, nil
+	}
 }
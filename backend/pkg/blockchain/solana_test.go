@@ -0,0 +1,249 @@
+package blockchain_test
+
+import (
+	"bytes"
+	"errors"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/Enuma3lish/LUNG_CEX/backend/internal/solanatest"
+	"github.com/Enuma3lish/LUNG_CEX/backend/pkg/blockchain"
+	"github.com/gagliardetto/solana-go"
+	"github.com/gagliardetto/solana-go/programs/system"
+	"github.com/google/uuid"
+	"github.com/shopspring/decimal"
+)
+
+// goldenTrade is encoded in goldenRecordTrade
+var goldenTrade = blockchain.TradeRecord{
+	UserID:      uuid.MustParse("00112233-4455-6677-8899-aabbccddeeff"),
+	AssetSymbol: "ETH-USD",
+	TradeType:   "SELL",
+	Quantity:    decimal.RequireFromString("1.23456789"),
+	Price:       decimal.RequireFromString("3012.45678901"),
+	Timestamp:   time.Unix(1700000000, 0).UTC(),
+}
+
+// goldenRecordTrade is TradeInstruction::RecordTrade for goldenTrade, laid
+// out by hand from solana-program/src/lib.rs
+var goldenRecordTrade = []byte{
+	0x00,                                           // RecordTrade variant
+	0x00, 0x11, 0x22, 0x33, 0x44, 0x55, 0x66, 0x77, // user_id: [u8; 16]
+	0x88, 0x99, 0xaa, 0xbb, 0xcc, 0xdd, 0xee, 0xff,
+	0x07, 0x00, 0x00, 0x00, // asset_symbol: u32 length
+	'E', 'T', 'H', '-', 'U', 'S', 'D', // then UTF-8 bytes
+	0x01,                                           // trade_type: TradeType::Sell
+	0x15, 0xcd, 0x5b, 0x07, 0x00, 0x00, 0x00, 0x00, // quantity: u64, 123456789 * 10^-8
+	0x35, 0x45, 0xa4, 0x23, 0x46, 0x00, 0x00, 0x00, // price: u64, 301245678901 * 10^-8
+	0x00, 0xf1, 0x53, 0x65, 0x00, 0x00, 0x00, 0x00, // timestamp: i64, 1700000000
+}
+
+// goldenMemo is goldenTrade in memo mode
+const goldenMemo = "TRADE:00112233-4455-6677-8899-aabbccddeeff:ETH-USD:SELL:1.23456789:3012.45678901:1700000000"
+
+// newTestClient returns a client in the given mode sending to a stub node,
+// which checks every transaction as the TradeRecord and Memo programs would
+func newTestClient(t *testing.T, mode string) (*blockchain.SolanaClient, *solanatest.Node, solana.PublicKey) {
+	t.Helper()
+
+	programID := solana.NewWallet().PublicKey()
+	stub := solanatest.NewNode(solanatest.Validate(programID))
+	server := httptest.NewServer(stub)
+	t.Cleanup(server.Close)
+
+	t.Setenv("SOLANA_RPC_URL", server.URL)
+	t.Setenv("SOLANA_PRIVATE_KEY", solana.NewWallet().PrivateKey.String())
+	t.Setenv("SOLANA_PROGRAM_ID", programID.String())
+	t.Setenv("SOLANA_RECORD_MODE", mode)
+
+	client, err := blockchain.NewSolanaClient()
+	if err != nil {
+		t.Fatalf("failed to create client: %v", err)
+	}
+	return client, stub, programID
+}
+
+// onlyTransaction returns the one transaction the stub received
+func onlyTransaction(t *testing.T, stub *solanatest.Node) *solana.Transaction {
+	t.Helper()
+
+	txs := stub.Transactions()
+	if len(txs) != 1 {
+		t.Fatalf("stub received %d transactions, want 1", len(txs))
+	}
+	return txs[0]
+}
+
+func TestEncodeRecordTrade(t *testing.T) {
+	data, err := blockchain.EncodeRecordTrade(goldenTrade)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(data, goldenRecordTrade) {
+		t.Errorf("encoded\n%x\nwant\n%x", data, goldenRecordTrade)
+	}
+	if size := blockchain.RecordSize(goldenTrade); size != uint64(len(goldenRecordTrade)-1) {
+		t.Errorf("record size %d, want %d", size, len(goldenRecordTrade)-1)
+	}
+
+	record, err := blockchain.DecodeRecordTrade(goldenRecordTrade)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if record.UserID != goldenTrade.UserID || record.AssetSymbol != goldenTrade.AssetSymbol || record.TradeType != goldenTrade.TradeType ||
+		!record.Quantity.Equal(goldenTrade.Quantity) || !record.Price.Equal(goldenTrade.Price) || !record.Timestamp.Equal(goldenTrade.Timestamp) {
+		t.Errorf("decoded %+v, want %+v", record, goldenTrade)
+	}
+}
+
+func TestEncodeRecordTradePrecision(t *testing.T) {
+	tests := []struct {
+		price string
+		want  string
+	}{
+		{"0.0000123", "0.0000123"},    // on SOL-BTC's 10^-7 tick
+		{"45000.01", "45000.01"},      // a cent
+		{"1.123456789", "1.12345678"}, // past 8 decimals is truncated
+	}
+	for _, tt := range tests {
+		trade := goldenTrade
+		trade.Price = decimal.RequireFromString(tt.price)
+		data, err := blockchain.EncodeRecordTrade(trade)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.price, err)
+		}
+		record, err := blockchain.DecodeRecordTrade(data)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.price, err)
+		}
+		if !record.Price.Equal(decimal.RequireFromString(tt.want)) {
+			t.Errorf("price %s recorded as %s, want %s", tt.price, record.Price, tt.want)
+		}
+	}
+}
+
+func TestEncodeRecordTradeRejects(t *testing.T) {
+	unknown := goldenTrade
+	unknown.TradeType = "HOLD"
+	negative := goldenTrade
+	negative.Quantity = decimal.RequireFromString("-1")
+
+	for _, trade := range []blockchain.TradeRecord{unknown, negative} {
+		if _, err := blockchain.EncodeRecordTrade(trade); !errors.Is(err, blockchain.ErrInvalidInstruction) {
+			t.Errorf("encoding %+v: got %v, want ErrInvalidInstruction", trade, err)
+		}
+	}
+	if _, err := blockchain.DecodeRecordTrade(append(goldenRecordTrade, 0)); !errors.Is(err, blockchain.ErrInvalidInstruction) {
+		t.Errorf("decoding trailing bytes: got %v, want ErrInvalidInstruction", err)
+	}
+	if _, err := blockchain.DecodeRecordTrade(goldenRecordTrade[:len(goldenRecordTrade)-1]); !errors.Is(err, blockchain.ErrInvalidInstruction) {
+		t.Errorf("decoding a short record: got %v, want ErrInvalidInstruction", err)
+	}
+}
+
+func TestRecordTradeProgramMode(t *testing.T) {
+	client, stub, programID := newTestClient(t, blockchain.ModeProgram)
+
+	sig, err := client.RecordTradeOnChain(goldenTrade)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tx := onlyTransaction(t, stub)
+	if tx.Signatures[0].String() != sig {
+		t.Errorf("returned signature %s, stub received %s", sig, tx.Signatures[0])
+	}
+	if len(tx.Message.Instructions) != 2 {
+		t.Fatalf("got %d instructions, want account creation and RecordTrade", len(tx.Message.Instructions))
+	}
+	// The key newTestClient gave the client
+	payer := solana.MustPrivateKeyFromBase58(os.Getenv("SOLANA_PRIVATE_KEY")).PublicKey()
+
+	// The record account is created for the program with room for the record
+	create, record := tx.Message.Instructions[0], tx.Message.Instructions[1]
+	if program, _ := tx.Message.Program(create.ProgramIDIndex); !program.Equals(solana.SystemProgramID) {
+		t.Fatalf("first instruction is for %s, want the system program", program)
+	}
+	createMetas, err := create.ResolveInstructionAccounts(&tx.Message)
+	if err != nil {
+		t.Fatal(err)
+	}
+	decoded, err := system.DecodeInstruction(createMetas, create.Data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	account, ok := decoded.Impl.(*system.CreateAccount)
+	if !ok {
+		t.Fatalf("first instruction is %T, want CreateAccount", decoded.Impl)
+	}
+	space := uint64(len(goldenRecordTrade) - 1)
+	if !account.Owner.Equals(programID) || *account.Space != space || *account.Lamports != (space+128)*solanatest.RentPerByte {
+		t.Errorf("account created for %s with %d bytes and %d lamports, want %s, %d and %d",
+			account.Owner, *account.Space, *account.Lamports, programID, space, (space+128)*solanatest.RentPerByte)
+	}
+	if !account.GetFundingAccount().PublicKey.Equals(payer) {
+		t.Errorf("account funded by %s, want the payer", account.GetFundingAccount().PublicKey)
+	}
+
+	// RecordTrade carries the golden bytes, signed by the payer, writing
+	// the new account
+	if program, _ := tx.Message.Program(record.ProgramIDIndex); !program.Equals(programID) {
+		t.Fatalf("second instruction is for %s, want the TradeRecord program", program)
+	}
+	if !bytes.Equal(record.Data, goldenRecordTrade) {
+		t.Errorf("instruction data\n%x\nwant\n%x", []byte(record.Data), goldenRecordTrade)
+	}
+	metas, err := record.ResolveInstructionAccounts(&tx.Message)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(metas) != 2 || !metas[0].PublicKey.Equals(payer) || !metas[0].IsSigner ||
+		!metas[1].PublicKey.Equals(account.GetNewAccount().PublicKey) || !metas[1].IsWritable {
+		t.Errorf("RecordTrade accounts %v, want the signing payer and the writable record account", metas)
+	}
+
+	status, err := client.GetTransactionStatus(sig)
+	if err != nil || status != blockchain.TxFinalized {
+		t.Errorf("status %q, %v, want %q", status, err, blockchain.TxFinalized)
+	}
+}
+
+func TestRecordTradeMemoMode(t *testing.T) {
+	client, stub, _ := newTestClient(t, blockchain.ModeMemo)
+
+	if _, err := client.RecordTradeOnChain(goldenTrade); err != nil {
+		t.Fatal(err)
+	}
+	tx := onlyTransaction(t, stub)
+	if len(tx.Message.Instructions) != 1 {
+		t.Fatalf("got %d instructions, want one memo", len(tx.Message.Instructions))
+	}
+	memo := tx.Message.Instructions[0]
+	if program, _ := tx.Message.Program(memo.ProgramIDIndex); !program.Equals(solana.MemoProgramID) {
+		t.Fatalf("instruction is for %s, want the memo program", program)
+	}
+	if string(memo.Data) != goldenMemo {
+		t.Errorf("memo %q, want %q", memo.Data, goldenMemo)
+	}
+}
+
+func TestRecordMemo(t *testing.T) {
+	client, stub, _ := newTestClient(t, blockchain.ModeProgram)
+
+	text := "ANCHOR:5f0c1a4e-8f2b-4d8e-9a57-2c7b3f1d6e90:" +
+		"9f86d081884c7d659a2feaa0c55ad015a3bf4f1b2b0b822cd15d6c15b0f00a08:3"
+	if _, err := client.RecordMemo(text); err != nil {
+		t.Fatal(err)
+	}
+	tx := onlyTransaction(t, stub)
+	if len(tx.Message.Instructions) != 1 || string(tx.Message.Instructions[0].Data) != text {
+		t.Errorf("memo transaction %v, want the raw text %q", tx.Message.Instructions, text)
+	}
+
+	// A signature the cluster never saw is still unknown
+	status, err := client.GetTransactionStatus(solana.Signature{1}.String())
+	if err != nil || status != blockchain.TxUnknown {
+		t.Errorf("status of an unseen signature %q, %v, want unknown", status, err)
+	}
+}
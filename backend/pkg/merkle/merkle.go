@@ -0,0 +1,116 @@
+// Package merkle builds SHA-256 Merkle trees over fixed-size leaves and the
+// inclusion proofs for them.
+//
+// Leaves and inner nodes are hashed with distinct prefixes, 0x00 and 0x01,
+// so a leaf can never pass for an inner node. A node without a sibling on
+// its level is carried up unchanged rather than paired with itself.
+package merkle
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+)
+
+// Hash is a leaf or node of a tree
+type Hash [32]byte
+
+func (h Hash) String() string {
+	return hex.EncodeToString(h[:])
+}
+
+// ParseHash reads a hash in the hex form String writes
+func ParseHash(s string) (Hash, error) {
+	var h Hash
+	b, err := hex.DecodeString(s)
+	if err != nil || len(b) != len(h) {
+		return h, errors.New("invalid hash")
+	}
+	copy(h[:], b)
+	return h, nil
+}
+
+// Sibling positions in a proof step
+const (
+	Left  = "left"
+	Right = "right"
+)
+
+// Step is one level of a proof: the sibling to combine with, and which side
+// of the running hash it goes on
+type Step struct {
+	Hash     string `json:"hash"`
+	Position string `json:"position"`
+}
+
+// Leaf hashes a leaf's data
+func Leaf(data []byte) Hash {
+	return sha256.Sum256(append([]byte{0x00}, data...))
+}
+
+func node(left Hash, right Hash) Hash {
+	buf := make([]byte, 0, 1+2*len(left))
+	buf = append(buf, 0x01)
+	buf = append(buf, left[:]...)
+	buf = append(buf, right[:]...)
+	return sha256.Sum256(buf)
+}
+
+// Build returns the root of a tree over leaves, in order, and each leaf's
+// proof. A single leaf is its own root with an empty proof.
+func Build(leaves []Hash) (Hash, [][]Step) {
+	if len(leaves) == 0 {
+		return Hash{}, nil
+	}
+
+	proofs := make([][]Step, len(leaves))
+	// positions[i] is the index of leaf i's ancestor on the current level
+	positions := make([]int, len(leaves))
+	for i := range positions {
+		positions[i] = i
+	}
+
+	level := leaves
+	for len(level) > 1 {
+		for i, pos := range positions {
+			switch {
+			case pos%2 == 1:
+				proofs[i] = append(proofs[i], Step{Hash: level[pos-1].String(), Position: Left})
+			case pos+1 < len(level):
+				proofs[i] = append(proofs[i], Step{Hash: level[pos+1].String(), Position: Right})
+			}
+			positions[i] = pos / 2
+		}
+
+		next := make([]Hash, 0, (len(level)+1)/2)
+		for i := 0; i < len(level); i += 2 {
+			if i+1 < len(level) {
+				next = append(next, node(level[i], level[i+1]))
+			} else {
+				next = append(next, level[i])
+			}
+		}
+		level = next
+	}
+	return level[0], proofs
+}
+
+// Verify reports whether proof leads from leaf to root
+func Verify(leaf Hash, proof []Step, root Hash) bool {
+	h := leaf
+	for _, step := range proof {
+		sibling, err := ParseHash(step.Hash)
+		if err != nil {
+			return false
+		}
+		switch step.Position {
+		case Left:
+			h = node(sibling, h)
+		case Right:
+			h = node(h, sibling)
+		default:
+			return false
+		}
+	}
+	return h == root
+}
@@ -0,0 +1,113 @@
+package pricefeed
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+var ErrUnknownSymbol = errors.New("unknown symbol")
+
+// PriceFeed supplies the current price for a symbol. Implementations
+// return the same price for every call within one tick, so a request
+// that reads a price twice sees a consistent market.
+type PriceFeed interface {
+	Price(symbol string) (float64, error)
+}
+
+// USD is the currency feed prices are quoted in
+const USD = "USD"
+
+// USDPrice is the USD price of any asset, including USD itself, which
+// feeds don't quote
+func USDPrice(feed PriceFeed, symbol string) (float64, error) {
+	if symbol == USD {
+		return 1, nil
+	}
+	return feed.Price(symbol)
+}
+
+// Runner is implemented by feeds that drive their own tick clock and must
+// be started alongside the server
+type Runner interface {
+	Run(ctx context.Context)
+}
+
+// DefaultPrices are the starting prices for virtual trading
+var DefaultPrices = map[string]float64{
+	"BTC":      45000.00,
+	"ETH":      2500.00,
+	"SOL":      100.00,
+	"USDC":     1.00,
+	"USDT":     1.00,
+	"BTC-PERP": 45000.00,
+	"ETH-PERP": 2500.00,
+	"SOL-PERP": 100.00,
+}
+
+// Stablecoins never move from their peg
+var stablecoins = map[string]bool{
+	"USDC": true,
+	"USDT": true,
+}
+
+const defaultTickInterval = time.Second
+
+// FromEnv builds the price feed selected by PRICE_FEED:
+//
+//	simulator (default) - jump-diffusion market simulator, published to Redis
+//	random              - seeded random walk, PRICE_FEED_SEED and PRICE_FEED_VOLATILITY
+//	static              - DefaultPrices, never moving
+//	replay              - historical prices from PRICE_FEED_FILE (.csv or .json)
+//	redis               - prices published by a simulator in another process
+//
+// Ticking feeds advance every PRICE_FEED_INTERVAL (default 1s).
+func FromEnv(redisClient *redis.Client) (PriceFeed, error) {
+	interval := defaultTickInterval
+	if v, err := time.ParseDuration(os.Getenv("PRICE_FEED_INTERVAL")); err == nil && v > 0 {
+		interval = v
+	}
+
+	seed := time.Now().UnixNano()
+	if v, err := strconv.ParseInt(os.Getenv("PRICE_FEED_SEED"), 10, 64); err == nil {
+		seed = v
+	}
+
+	switch kind := os.Getenv("PRICE_FEED"); kind {
+	case "", "simulator":
+		params := DefaultSimulatorParams
+		if path := os.Getenv("SIMULATOR_PARAMS_FILE"); path != "" {
+			var err error
+			if params, err = LoadSimulatorParams(path); err != nil {
+				return nil, err
+			}
+		}
+		timeScale := 1.0
+		if v, err := strconv.ParseFloat(os.Getenv("SIMULATOR_TIME_SCALE"), 64); err == nil && v > 0 {
+			timeScale = v
+		}
+		return NewSimulator(DefaultPrices, params, seed, interval, timeScale, redisClient)
+	case "random":
+		volatility := defaultVolatility
+		if v, err := strconv.ParseFloat(os.Getenv("PRICE_FEED_VOLATILITY"), 64); err == nil && v > 0 {
+			volatility = v
+		}
+		return NewRandomWalk(DefaultPrices, seed, volatility, interval), nil
+	case "static":
+		return NewStatic(DefaultPrices), nil
+	case "replay":
+		return LoadReplay(os.Getenv("PRICE_FEED_FILE"), interval)
+	case "redis":
+		if redisClient == nil {
+			return nil, fmt.Errorf("redis price feed requires a Redis connection")
+		}
+		return NewRedisFeed(redisClient), nil
+	default:
+		return nil, fmt.Errorf("unknown price feed %q", kind)
+	}
+}
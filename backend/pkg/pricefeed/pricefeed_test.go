@@ -0,0 +1,117 @@
+package pricefeed
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestStatic(t *testing.T) {
+	feed := NewStatic(DefaultPrices)
+	for i := 0; i < 3; i++ {
+		if price, err := feed.Price("BTC"); err != nil || price != 45000 {
+			t.Fatalf("BTC is %v (%v), want 45000 on every read", price, err)
+		}
+	}
+
+	feed.Set("BTC", 46000)
+	if price, _ := feed.Price("BTC"); price != 46000 {
+		t.Errorf("BTC is %v after Set, want 46000", price)
+	}
+	if DefaultPrices["BTC"] != 45000 {
+		t.Errorf("Set changed DefaultPrices to %v", DefaultPrices["BTC"])
+	}
+	if _, err := feed.Price("DOGE"); !errors.Is(err, ErrUnknownSymbol) {
+		t.Errorf("unknown symbol returned %v, want ErrUnknownSymbol", err)
+	}
+
+	if price, err := USDPrice(feed, USD); err != nil || price != 1 {
+		t.Errorf("USD is %v (%v), want 1", price, err)
+	}
+}
+
+// The seed alone determines the path, and stablecoins hold their peg
+func TestRandomWalkSeeded(t *testing.T) {
+	walk := func(seed int64) *RandomWalk {
+		w := NewRandomWalk(DefaultPrices, seed, 0.01, time.Hour)
+		w.advance(50)
+		return w
+	}
+
+	a, b, c := walk(1), walk(1), walk(2)
+	for symbol := range DefaultPrices {
+		if a.prices[symbol] != b.prices[symbol] {
+			t.Errorf("%s diverged under one seed: %v and %v", symbol, a.prices[symbol], b.prices[symbol])
+		}
+	}
+	if a.prices["BTC"] == c.prices["BTC"] {
+		t.Errorf("seeds 1 and 2 both walked BTC to %v", a.prices["BTC"])
+	}
+	if a.prices["BTC"] == DefaultPrices["BTC"] {
+		t.Error("BTC never moved")
+	}
+	if a.prices["USDC"] != 1 || a.prices["USDT"] != 1 {
+		t.Errorf("stablecoins moved to USDC %v, USDT %v", a.prices["USDC"], a.prices["USDT"])
+	}
+}
+
+// Replay steps through timestamps in order, carrying forward symbols a
+// timestamp doesn't mention, and loops at the end
+func TestReplayCSV(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "prices.csv")
+	history := "timestamp,symbol,price\n" +
+		"2024-01-01T00:01:00Z,BTC,41000\n" +
+		"2024-01-01T00:00:00Z,BTC,40000\n" +
+		"2024-01-01T00:00:00Z,ETH,2000\n"
+	if err := os.WriteFile(path, []byte(history), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	r, err := LoadReplay(path, time.Hour)
+	if err != nil {
+		t.Fatalf("failed to load replay: %v", err)
+	}
+
+	tests := []struct {
+		tick     int
+		btc, eth float64
+	}{
+		{0, 40000, 2000},
+		{1, 41000, 2000},
+		{2, 40000, 2000},
+	}
+	for _, tt := range tests {
+		r.start = time.Now().Add(-time.Duration(tt.tick)*r.interval - time.Minute)
+		btc, _ := r.Price("BTC")
+		eth, _ := r.Price("ETH")
+		if btc != tt.btc || eth != tt.eth {
+			t.Errorf("tick %d: BTC %v ETH %v, want %v and %v", tt.tick, btc, eth, tt.btc, tt.eth)
+		}
+	}
+	if _, err := r.Price("SOL"); !errors.Is(err, ErrUnknownSymbol) {
+		t.Errorf("unknown symbol returned %v, want ErrUnknownSymbol", err)
+	}
+}
+
+func TestFromEnv(t *testing.T) {
+	t.Setenv("PRICE_FEED", "static")
+	feed, err := FromEnv(nil)
+	if err != nil {
+		t.Fatalf("static feed failed: %v", err)
+	}
+	if _, ok := feed.(*Static); !ok {
+		t.Errorf("PRICE_FEED=static built a %T", feed)
+	}
+
+	t.Setenv("PRICE_FEED", "redis")
+	if _, err := FromEnv(nil); err == nil {
+		t.Error("redis feed without a Redis connection succeeded")
+	}
+
+	t.Setenv("PRICE_FEED", "nope")
+	if _, err := FromEnv(nil); err == nil {
+		t.Error("unknown feed succeeded")
+	}
+}
@@ -0,0 +1,67 @@
+package pricefeed
+
+import (
+	"math"
+	"math/rand"
+	"sort"
+	"sync"
+	"time"
+)
+
+// defaultVolatility is the standard deviation of each step's log return
+const defaultVolatility = 0.001
+
+// RandomWalk is a seeded geometric random walk that takes one step per
+// tick interval. Steps are computed lazily, so the same seed always
+// produces the same path regardless of how often prices are read.
+type RandomWalk struct {
+	mu         sync.Mutex
+	rng        *rand.Rand
+	symbols    []string
+	prices     map[string]float64
+	volatility float64
+	interval   time.Duration
+	start      time.Time
+	steps      int64
+}
+
+func NewRandomWalk(base map[string]float64, seed int64, volatility float64, interval time.Duration) *RandomWalk {
+	w := &RandomWalk{
+		rng:        rand.New(rand.NewSource(seed)),
+		prices:     make(map[string]float64, len(base)),
+		volatility: volatility,
+		interval:   interval,
+		start:      time.Now(),
+	}
+	for symbol, price := range base {
+		w.symbols = append(w.symbols, symbol)
+		w.prices[symbol] = price
+	}
+	// Step symbols in a fixed order so the seed fully determines the path
+	sort.Strings(w.symbols)
+	return w
+}
+
+func (w *RandomWalk) Price(symbol string) (float64, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.advance(int64(time.Since(w.start) / w.interval))
+
+	price, ok := w.prices[symbol]
+	if !ok {
+		return 0, ErrUnknownSymbol
+	}
+	return price, nil
+}
+
+func (w *RandomWalk) advance(steps int64) {
+	for ; w.steps < steps; w.steps++ {
+		for _, symbol := range w.symbols {
+			if stablecoins[symbol] {
+				continue
+			}
+			w.prices[symbol] *= math.Exp(w.volatility * w.rng.NormFloat64())
+		}
+	}
+}
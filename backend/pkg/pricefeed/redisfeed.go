@@ -0,0 +1,30 @@
+package pricefeed
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// RedisFeed reads the prices a Simulator publishes to Redis, so several
+// API instances can share one simulated market
+type RedisFeed struct {
+	client *redis.Client
+}
+
+func NewRedisFeed(client *redis.Client) *RedisFeed {
+	return &RedisFeed{client: client}
+}
+
+func (f *RedisFeed) Price(symbol string) (float64, error) {
+	value, err := f.client.HGet(context.Background(), LatestPricesKey, symbol).Result()
+	if err == redis.Nil {
+		return 0, ErrUnknownSymbol
+	}
+	if err != nil {
+		return 0, fmt.Errorf("failed to read price: %w", err)
+	}
+	return strconv.ParseFloat(value, 64)
+}
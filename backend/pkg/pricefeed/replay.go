@@ -0,0 +1,113 @@
+package pricefeed
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Observation is a single historical price
+type Observation struct {
+	Timestamp time.Time `json:"timestamp"`
+	Symbol    string    `json:"symbol"`
+	Price     float64   `json:"price"`
+}
+
+// Replay plays back historical prices, moving to the next timestamp on
+// every tick interval and looping once the history runs out. Symbols
+// missing from a timestamp keep their previous price.
+type Replay struct {
+	frames   []map[string]float64
+	interval time.Duration
+	start    time.Time
+}
+
+// LoadReplay reads a .csv (timestamp,symbol,price) or .json (array of
+// observations) history file. Timestamps are RFC 3339.
+func LoadReplay(path string, interval time.Duration) (*Replay, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open price history: %w", err)
+	}
+	defer file.Close()
+
+	var observations []Observation
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".json":
+		if err := json.NewDecoder(file).Decode(&observations); err != nil {
+			return nil, fmt.Errorf("failed to parse price history: %w", err)
+		}
+	case ".csv":
+		records, err := csv.NewReader(file).ReadAll()
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse price history: %w", err)
+		}
+		for i, record := range records {
+			if len(record) != 3 {
+				return nil, fmt.Errorf("price history line %d: expected timestamp,symbol,price", i+1)
+			}
+			ts, err := time.Parse(time.RFC3339, record[0])
+			if err != nil {
+				if i == 0 {
+					continue // header
+				}
+				return nil, fmt.Errorf("price history line %d: %w", i+1, err)
+			}
+			price, err := strconv.ParseFloat(record[2], 64)
+			if err != nil {
+				return nil, fmt.Errorf("price history line %d: %w", i+1, err)
+			}
+			observations = append(observations, Observation{Timestamp: ts, Symbol: record[1], Price: price})
+		}
+	default:
+		return nil, fmt.Errorf("unsupported price history format %q", filepath.Ext(path))
+	}
+
+	return NewReplay(observations, interval)
+}
+
+func NewReplay(observations []Observation, interval time.Duration) (*Replay, error) {
+	if len(observations) == 0 {
+		return nil, fmt.Errorf("price history is empty")
+	}
+
+	sort.SliceStable(observations, func(i, j int) bool {
+		return observations[i].Timestamp.Before(observations[j].Timestamp)
+	})
+
+	// Collapse observations into one frame per timestamp, carrying
+	// forward the last known price of every symbol
+	var frames []map[string]float64
+	current := make(map[string]float64)
+	for i, o := range observations {
+		current[o.Symbol] = o.Price
+		if i == len(observations)-1 || !observations[i+1].Timestamp.Equal(o.Timestamp) {
+			frame := make(map[string]float64, len(current))
+			for symbol, price := range current {
+				frame[symbol] = price
+			}
+			frames = append(frames, frame)
+		}
+	}
+
+	return &Replay{
+		frames:   frames,
+		interval: interval,
+		start:    time.Now(),
+	}, nil
+}
+
+func (r *Replay) Price(symbol string) (float64, error) {
+	frame := r.frames[int(time.Since(r.start)/r.interval)%len(r.frames)]
+	price, ok := frame[symbol]
+	if !ok {
+		return 0, ErrUnknownSymbol
+	}
+	return price, nil
+}
@@ -0,0 +1,264 @@
+package pricefeed
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"math"
+	"math/rand"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	redisClient "github.com/Enuma3lish/LUNG_CEX/backend/pkg/redis"
+	"github.com/go-redis/redis/v8"
+)
+
+// LatestPricesKey is the Redis hash the simulator publishes every tick to.
+// It holds one field per symbol plus a "tick" counter.
+const LatestPricesKey = "prices:latest"
+
+const secondsPerYear = 365 * 24 * 60 * 60
+
+// AssetParams are the jump-diffusion parameters of one spot asset, in
+// annualized terms
+type AssetParams struct {
+	Drift         float64 `json:"drift"`
+	Volatility    float64 `json:"volatility"`
+	JumpIntensity float64 `json:"jump_intensity"` // expected jumps per year
+	JumpMean      float64 `json:"jump_mean"`      // mean log jump size
+	JumpStdDev    float64 `json:"jump_stddev"`
+}
+
+// SimulatorParams configure the market simulator. Correlation keys are
+// symbol pairs such as "BTC/ETH". Perpetuals follow their spot index with
+// a mean-reverting basis.
+type SimulatorParams struct {
+	Assets          map[string]AssetParams `json:"assets"`
+	Correlation     map[string]float64     `json:"correlation"`
+	BasisReversion  float64                `json:"basis_reversion"`  // fraction of the basis closed per tick
+	BasisVolatility float64                `json:"basis_volatility"` // std dev of the basis per tick
+}
+
+// DefaultSimulatorParams model BTC, ETH and SOL as strongly correlated
+// with occasional jumps
+var DefaultSimulatorParams = SimulatorParams{
+	Assets: map[string]AssetParams{
+		"BTC": {Drift: 0.05, Volatility: 0.60, JumpIntensity: 20, JumpStdDev: 0.02},
+		"ETH": {Drift: 0.05, Volatility: 0.75, JumpIntensity: 25, JumpStdDev: 0.025},
+		"SOL": {Drift: 0.05, Volatility: 1.00, JumpIntensity: 30, JumpStdDev: 0.035},
+	},
+	Correlation: map[string]float64{
+		"BTC/ETH": 0.80,
+		"BTC/SOL": 0.70,
+		"ETH/SOL": 0.75,
+	},
+	BasisReversion:  0.05,
+	BasisVolatility: 0.0002,
+}
+
+// Simulator evolves spot prices with correlated geometric Brownian motion
+// plus Poisson jumps on a tick clock, and publishes each tick's prices to
+// Redis. Prices only change between ticks, so every reader sees the same
+// price for the whole tick.
+type Simulator struct {
+	mu     sync.RWMutex
+	rng    *rand.Rand
+	prices map[string]float64
+	basis  map[string]float64 // log basis of each perpetual over its index
+	ticks  int64
+
+	params    SimulatorParams
+	spot      []string    // correlated symbols in a fixed order
+	cholesky  [][]float64 // lower triangular factor of the correlation matrix
+	tick      time.Duration
+	timeScale float64 // simulated seconds per real second
+	redis     *redis.Client
+}
+
+func NewSimulator(base map[string]float64, params SimulatorParams, seed int64, tick time.Duration, timeScale float64, client *redis.Client) (*Simulator, error) {
+	s := &Simulator{
+		rng:       rand.New(rand.NewSource(seed)),
+		prices:    make(map[string]float64, len(base)),
+		basis:     make(map[string]float64),
+		params:    params,
+		tick:      tick,
+		timeScale: timeScale,
+		redis:     client,
+	}
+	for symbol, price := range base {
+		s.prices[symbol] = price
+		if strings.HasSuffix(symbol, "-PERP") {
+			s.basis[symbol] = 0
+		}
+	}
+	for symbol := range params.Assets {
+		if _, ok := base[symbol]; !ok {
+			return nil, fmt.Errorf("no starting price for %s", symbol)
+		}
+		s.spot = append(s.spot, symbol)
+	}
+	sort.Strings(s.spot)
+
+	corr := make([][]float64, len(s.spot))
+	for i, a := range s.spot {
+		corr[i] = make([]float64, len(s.spot))
+		for j, b := range s.spot {
+			if i == j {
+				corr[i][j] = 1
+			} else if rho, ok := params.Correlation[a+"/"+b]; ok {
+				corr[i][j] = rho
+			} else {
+				corr[i][j] = params.Correlation[b+"/"+a]
+			}
+		}
+	}
+	chol, err := choleskyDecompose(corr)
+	if err != nil {
+		return nil, err
+	}
+	s.cholesky = chol
+
+	return s, nil
+}
+
+// LoadSimulatorParams reads simulator parameters from a JSON file
+func LoadSimulatorParams(path string) (SimulatorParams, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return SimulatorParams{}, fmt.Errorf("failed to read simulator params: %w", err)
+	}
+	var params SimulatorParams
+	if err := json.Unmarshal(data, &params); err != nil {
+		return SimulatorParams{}, fmt.Errorf("failed to parse simulator params: %w", err)
+	}
+	return params, nil
+}
+
+func (s *Simulator) Price(symbol string) (float64, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	price, ok := s.prices[symbol]
+	if !ok {
+		return 0, ErrUnknownSymbol
+	}
+	return price, nil
+}
+
+// Run advances the simulation every tick until ctx is cancelled
+func (s *Simulator) Run(ctx context.Context) {
+	ticker := time.NewTicker(s.tick)
+	defer ticker.Stop()
+
+	log.Printf("Market simulator started (tick %s, time scale %.0fx)", s.tick, s.timeScale)
+	s.publish(ctx)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			s.Step()
+			s.publish(ctx)
+		}
+	}
+}
+
+// Step advances every symbol by one tick
+func (s *Simulator) Step() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	dt := s.tick.Seconds() * s.timeScale / secondsPerYear
+
+	// Correlated standard normal shocks for the spot assets
+	z := make([]float64, len(s.spot))
+	for i := range z {
+		z[i] = s.rng.NormFloat64()
+	}
+	for i, symbol := range s.spot {
+		var shock float64
+		for j := 0; j <= i; j++ {
+			shock += s.cholesky[i][j] * z[j]
+		}
+
+		p := s.params.Assets[symbol]
+		logReturn := (p.Drift-0.5*p.Volatility*p.Volatility)*dt + p.Volatility*math.Sqrt(dt)*shock
+		if s.rng.Float64() < p.JumpIntensity*dt {
+			logReturn += p.JumpMean + p.JumpStdDev*s.rng.NormFloat64()
+		}
+		s.prices[symbol] *= math.Exp(logReturn)
+	}
+
+	// Perpetuals trade at their index plus a mean-reverting basis
+	perps := make([]string, 0, len(s.basis))
+	for symbol := range s.basis {
+		perps = append(perps, symbol)
+	}
+	sort.Strings(perps)
+	for _, symbol := range perps {
+		index, ok := s.prices[strings.TrimSuffix(symbol, "-PERP")]
+		if !ok {
+			continue
+		}
+		s.basis[symbol] = s.basis[symbol]*(1-s.params.BasisReversion) + s.params.BasisVolatility*s.rng.NormFloat64()
+		s.prices[symbol] = index * math.Exp(s.basis[symbol])
+	}
+
+	s.ticks++
+}
+
+// publish writes the current tick's prices to Redis in one transaction
+func (s *Simulator) publish(ctx context.Context) {
+	if s.redis == nil {
+		return
+	}
+
+	s.mu.RLock()
+	fields := make(map[string]interface{}, len(s.prices)+1)
+	for symbol, price := range s.prices {
+		fields[symbol] = strconv.FormatFloat(price, 'f', 8, 64)
+	}
+	fields["tick"] = s.ticks
+	s.mu.RUnlock()
+
+	_, err := s.redis.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.HSet(ctx, LatestPricesKey, fields)
+		pipe.Expire(ctx, LatestPricesKey, redisClient.PriceCacheTTL)
+		return nil
+	})
+	if err != nil {
+		log.Printf("Warning: Failed to publish prices: %v", err)
+	}
+}
+
+// choleskyDecompose factors a symmetric positive definite matrix
+func choleskyDecompose(m [][]float64) ([][]float64, error) {
+	n := len(m)
+	l := make([][]float64, n)
+	for i := range l {
+		l[i] = make([]float64, n)
+	}
+	for i := 0; i < n; i++ {
+		for j := 0; j <= i; j++ {
+			sum := m[i][j]
+			for k := 0; k < j; k++ {
+				sum -= l[i][k] * l[j][k]
+			}
+			if i == j {
+				if sum <= 0 {
+					return nil, fmt.Errorf("correlation matrix is not positive definite")
+				}
+				l[i][i] = math.Sqrt(sum)
+			} else {
+				l[i][j] = sum / l[j][j]
+			}
+		}
+	}
+	return l, nil
+}
@@ -0,0 +1,37 @@
+package pricefeed
+
+import "sync"
+
+// Static is a fixed price feed for tests and deterministic runs. Prices
+// only change when Set is called.
+type Static struct {
+	mu     sync.RWMutex
+	prices map[string]float64
+}
+
+func NewStatic(prices map[string]float64) *Static {
+	s := &Static{prices: make(map[string]float64, len(prices))}
+	for symbol, price := range prices {
+		s.prices[symbol] = price
+	}
+	return s
+}
+
+func (s *Static) Price(symbol string) (float64, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	price, ok := s.prices[symbol]
+	if !ok {
+		return 0, ErrUnknownSymbol
+	}
+	return price, nil
+}
+
+// Set moves a symbol to a new price
+func (s *Static) Set(symbol string, price float64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.prices[symbol] = price
+}
@@ -41,4 +41,5 @@ const (
 	PortfolioCacheTTL = 30 * time.Second
 	HoldingsCacheTTL  = 30 * time.Second
 	PriceCacheTTL     = 5 * time.Second
+	TickerCacheTTL    = 5 * time.Second
 )
@@ -1,47 +1,66 @@
 package utils
 
 import (
-	"math/rand"
-	"time"
+	"github.com/shopspring/decimal"
 )
 
-// Mock prices for virtual trading
-var basePrices = map[string]float64{
-	"BTC":      45000.00,
-	"ETH":      2500.00,
-	"SOL":      100.00,
-	"USDC":     1.00,
-	"USDT":     1.00,
-	"BTC-PERP": 45000.00,
-	"ETH-PERP": 2500.00,
-	"SOL-PERP": 100.00,
+// CashPlaces is the number of decimal places balances and amounts are
+// stored with
+const CashPlaces = 2
+
+// RoundCents rounds half away from zero to the cent
+func RoundCents(value decimal.Decimal) decimal.Decimal {
+	return value.Round(CashPlaces)
 }
 
-func init() {
-	rand.Seed(time.Now().UnixNano())
+// CeilCents rounds up to the cent. Reservations use it so the funds held
+// for an order always cover what it can spend.
+func CeilCents(value decimal.Decimal) decimal.Decimal {
+	return value.RoundCeil(CashPlaces)
 }
 
-// GetMockPrice returns a mock price with slight random variation
-func GetMockPrice(symbol string) float64 {
-	basePrice, exists := basePrices[symbol]
-	if !exists {
-		return 1.00
+// RoundToStep rounds half away from zero to the nearest multiple of step
+func RoundToStep(value decimal.Decimal, step decimal.Decimal) decimal.Decimal {
+	if !step.IsPositive() {
+		return value
 	}
+	return value.Div(step).Round(0).Mul(step)
+}
+
+// FloorToStep rounds down to a multiple of step
+func FloorToStep(value decimal.Decimal, step decimal.Decimal) decimal.Decimal {
+	if !step.IsPositive() {
+		return value
+	}
+	return value.Div(step).Floor().Mul(step)
+}
 
-	// Add random variation (-2% to +2%) for non-stablecoins
-	if symbol != "USDC" && symbol != "USDT" {
-		variation := (rand.Float64() - 0.5) * 0.04 // -2% to +2%
-		return basePrice * (1 + variation)
+// CeilToStep rounds up to a multiple of step
+func CeilToStep(value decimal.Decimal, step decimal.Decimal) decimal.Decimal {
+	if !step.IsPositive() {
+		return value
 	}
+	return value.Div(step).Ceil().Mul(step)
+}
+
+// IsMultiple reports whether value is a whole multiple of step
+func IsMultiple(value decimal.Decimal, step decimal.Decimal) bool {
+	if !step.IsPositive() {
+		return true
+	}
+	return value.Mod(step).IsZero()
+}
 
-	return basePrice
+// FeedPrice converts a price feed quote to a decimal on the asset's tick
+func FeedPrice(price float64, tickSize decimal.Decimal) decimal.Decimal {
+	return RoundToStep(decimal.NewFromFloat(price), tickSize)
 }
 
-// GetAllPrices returns all current mock prices
-func GetAllPrices() map[string]float64 {
-	prices := make(map[string]float64)
-	for symbol := range basePrices {
-		prices[symbol] = GetMockPrice(symbol)
+// Percent is part as a percentage of whole, or zero when whole is zero.
+// Percentages are for display only, so they are returned as floats.
+func Percent(part decimal.Decimal, whole decimal.Decimal) float64 {
+	if whole.IsZero() {
+		return 0
 	}
-	return prices
+	return part.Div(whole).Mul(decimal.NewFromInt(100)).InexactFloat64()
 }
@@ -63,7 +63,7 @@ const Navbar = () => {
             <div className="text-sm text-gray-300">
               <span className="font-medium">{user?.username}</span>
               <span className="mx-2">|</span>
-              <span className="text-green-400">${user?.balance?.toFixed(2)}</span>
+              <span className="text-green-400">${user?.wallets?.find((w) => w.asset?.symbol === 'USD')?.balance?.toFixed(2)}</span>
             </div>
             <button
               onClick={logout}
@@ -79,7 +79,7 @@ const Dashboard = () => {
                 {portfolio?.holdings?.map((holding) => (
                   <tr key={holding.id} className="border-b border-slate-700">
                     <td className="py-4 font-medium">{holding.asset?.symbol}</td>
-                    <td className="py-4">{holding.quantity?.toFixed(4)}</td>
+                    <td className="py-4">{holding.balance?.toFixed(4)}</td>
                     <td className="py-4">${holding.avg_price?.toFixed(2)}</td>
                     <td className="py-4">${holding.current_price?.toFixed(2)}</td>
                     <td className="py-4">${holding.value?.toFixed(2)}</td>
@@ -158,7 +158,7 @@ const Portfolio = () => {
                         <div className="text-sm text-gray-400">{holding.asset?.name}</div>
                       </div>
                     </td>
-                    <td className="py-4 text-right">{holding.quantity?.toFixed(4)}</td>
+                    <td className="py-4 text-right">{holding.balance?.toFixed(4)}</td>
                     <td className="py-4 text-right">${holding.avg_price?.toFixed(2)}</td>
                     <td className="py-4 text-right">${holding.current_price?.toFixed(2)}</td>
                     <td className="py-4 text-right font-semibold">
@@ -24,7 +24,7 @@ const Trading = () => {
   const [error, setError] = useState('')
 
   const buyMutation = useMutation(
-    ({ asset_symbol, quantity, price }) => tradeService.buy(asset_symbol, quantity, price),
+    ({ asset_symbol, quantity }) => tradeService.buy(asset_symbol, quantity),
     {
       onSuccess: (data) => {
         setMessage(`Successfully bought ${quantity} ${selectedAsset.symbol}`)
@@ -41,7 +41,7 @@ const Trading = () => {
   )
 
   const sellMutation = useMutation(
-    ({ asset_symbol, quantity, price }) => tradeService.sell(asset_symbol, quantity, price),
+    ({ asset_symbol, quantity }) => tradeService.sell(asset_symbol, quantity),
     {
       onSuccess: (data) => {
         setMessage(`Successfully sold ${quantity} ${selectedAsset.symbol}`)
@@ -71,7 +71,6 @@ const Trading = () => {
     const tradeData = {
       asset_symbol: selectedAsset.symbol,
       quantity: qty,
-      price: selectedAsset.price,
     }
 
     if (tradeType === 'BUY') {
@@ -148,7 +147,7 @@ const Trading = () => {
               </div>
 
               <div>
-                <label className="block text-sm font-medium text-gray-300 mb-2">Price</label>
+                <label className="block text-sm font-medium text-gray-300 mb-2">Estimated Price</label>
                 <input
                   type="text"
                   value={`$${selectedAsset.price.toFixed(2)}`}
@@ -171,12 +170,12 @@ const Trading = () => {
 
               <div className="bg-slate-700 rounded-lg p-4">
                 <div className="flex justify-between mb-2">
-                  <span className="text-gray-400">Total Cost:</span>
+                  <span className="text-gray-400">Estimated Total:</span>
                   <span className="font-semibold">${totalCost}</span>
                 </div>
                 <div className="flex justify-between">
                   <span className="text-gray-400">Available Balance:</span>
-                  <span className="font-semibold">${user?.balance?.toFixed(2)}</span>
+                  <span className="font-semibold">${user?.wallets?.find((w) => w.asset?.symbol === 'USD')?.balance?.toFixed(2)}</span>
                 </div>
               </div>
 
@@ -42,12 +42,16 @@ export const authService = {
   },
 }
 
+// A fresh key per order lets a retried request replay the first response
+// instead of trading twice
+const idempotent = () => ({ headers: { 'Idempotency-Key': crypto.randomUUID() } })
+
 export const tradeService = {
-  buy: async (asset_symbol, quantity, price) => {
-    return api.post('/trade/buy', { asset_symbol, quantity, price })
+  buy: async (asset_symbol, quantity) => {
+    return api.post('/trade/buy', { asset_symbol, quantity, order_type: 'MARKET' }, idempotent())
   },
-  sell: async (asset_symbol, quantity, price) => {
-    return api.post('/trade/sell', { asset_symbol, quantity, price })
+  sell: async (asset_symbol, quantity) => {
+    return api.post('/trade/sell', { asset_symbol, quantity, order_type: 'MARKET' }, idempotent())
   },
   getHistory: async () => {
     return api.get('/trades/history')
@@ -15,7 +15,7 @@ pub struct TradeRecord {
     pub asset_symbol: String,    // Asset symbol (BTC, ETH, etc.)
     pub trade_type: TradeType,   // BUY or SELL
     pub quantity: u64,           // Quantity * 10^8 for precision
-    pub price: u64,              // Price * 10^2 for precision
+    pub price: u64,              // Price * 10^8 for precision
     pub timestamp: i64,          // Unix timestamp
 }
 
@@ -170,7 +170,7 @@ mod tests {
         let asset_symbol = "BTC".to_string();
         let trade_type = TradeType::Buy;
         let quantity = 100000000; // 1 BTC
-        let price = 4500000; // $45,000
+        let price = 4500000000000; // $45,000
         let timestamp = 1234567890;
 
         let result = record_trade(